@@ -1,4 +1,147 @@
 package main
 
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/service"
+	"github.com/finkabaj/squid/back/internal/storage"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: cli <command> [flags]
+
+Commands:
+  delete-user    delete account of a user, handing over or deleting owned projects
+  grant-admin    grant or revoke system administration of a user
+`
+
+// transfersFlag collects repeated -transfer project_id=new_owner_id flags
+type transfersFlag []types.ProjectTransfer
+
+func (t *transfersFlag) String() string {
+	return fmt.Sprint(*t)
+}
+
+func (t *transfersFlag) Set(value string) error {
+	projectID, newOwnerID, ok := strings.Cut(value, "=")
+	if !ok || projectID == "" || newOwnerID == "" {
+		return fmt.Errorf("expected project_id=new_owner_id, got %q", value)
+	}
+
+	*t = append(*t, types.ProjectTransfer{ProjectID: projectID, NewOwnerID: newOwnerID})
+	return nil
+}
+
 func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "delete-user":
+		deleteUser(os.Args[2:])
+	case "grant-admin":
+		grantAdmin(os.Args[2:])
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+func deleteUser(args []string) {
+	fs := flag.NewFlagSet("delete-user", flag.ExitOnError)
+	email := fs.String("email", "", "email of the user to delete")
+	deleteProjects := fs.Bool("delete-projects", false, "delete owned projects that are not transferred explicitly")
+	var transfers transfersFlag
+	fs.Var(&transfers, "transfer", "hand project over to its admin or member, project_id=new_owner_id (repeatable)")
+	fs.Parse(args)
+
+	if *email == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	initialize()
+	defer repository.Close()
+
+	user, err := service.GetUserByEmail(email)
+	if err != nil {
+		fail(err)
+	}
+
+	deleted, err := service.AdminDeleteAccount(&user.ID, &types.DeleteAccount{
+		DeleteOwnedProjects: *deleteProjects,
+		Transfers:           transfers,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	out, _ := json.MarshalIndent(deleted, "", "  ")
+	fmt.Println(string(out))
+}
+
+func grantAdmin(args []string) {
+	fs := flag.NewFlagSet("grant-admin", flag.ExitOnError)
+	email := fs.String("email", "", "email of the user")
+	revoke := fs.Bool("revoke", false, "revoke administration instead of granting it")
+	fs.Parse(args)
+
+	if *email == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	initialize()
+	defer repository.Close()
+
+	user, err := service.SetUserAdmin(email, !*revoke)
+	if err != nil {
+		fail(err)
+	}
+
+	out, _ := json.MarshalIndent(user, "", "  ")
+	fmt.Println(string(out))
+}
+
+func initialize() {
+	if err := godotenv.Load(".env"); err != nil {
+		fail(fmt.Errorf("error loading env variables: %w", err))
+	}
+
+	if err := config.Initialize(); err != nil {
+		fail(fmt.Errorf("error initializing config: %w", err))
+	}
+
+	logger.InitLogger(os.Stderr)
+
+	dbCredentials := types.DBCredentials{
+		Host:     config.Data.PostgresHost,
+		Port:     config.Data.PostgresPort,
+		User:     config.Data.PostgresUser,
+		Password: config.Data.PostgresPassword,
+		Database: config.Data.PostgresDatabase,
+	}
+
+	if err := repository.Connect(dbCredentials); err != nil {
+		fail(fmt.Errorf("error connecting to database: %w", err))
+	}
+
+	if err := storage.InitStorage(); err != nil {
+		fail(fmt.Errorf("error initializing storage: %w", err))
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+	os.Exit(1)
 }
@@ -8,7 +8,16 @@ import (
 
 	"github.com/finkabaj/squid/back/internal/config"
 	"github.com/finkabaj/squid/back/internal/controller"
+	"github.com/finkabaj/squid/back/internal/mailer"
 	myMiddleware "github.com/finkabaj/squid/back/internal/middleware"
+	"github.com/finkabaj/squid/back/internal/oidc"
+	"github.com/finkabaj/squid/back/internal/passhash"
+	"github.com/finkabaj/squid/back/internal/revocation"
+	"github.com/finkabaj/squid/back/internal/sessions"
+	"github.com/finkabaj/squid/back/internal/signing"
+	"github.com/finkabaj/squid/back/internal/storage"
+	"github.com/finkabaj/squid/back/internal/throttle"
+	"github.com/finkabaj/squid/back/internal/trash"
 	"github.com/finkabaj/squid/back/internal/websocket"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/cors"
@@ -41,6 +50,18 @@ func main() {
 	defer fs.Close()
 	logger.InitLogger(fs)
 
+	if err = mailer.InitMailer(); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing mailer")
+	}
+
+	if err = oidc.InitOIDC(); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing oidc")
+	}
+
+	if err = passhash.InitHasher(); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing password hasher")
+	}
+
 	dbCredentials := types.DBCredentials{
 		Host:     config.Data.PostgresHost,
 		Port:     config.Data.PostgresPort,
@@ -55,6 +76,30 @@ func main() {
 
 	defer repository.Close()
 
+	if err = signing.InitSigning(repository.SigningKeyStore{}); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing signing keys")
+	}
+
+	if err = storage.InitStorage(); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing storage")
+	}
+
+	if err = revocation.InitRevocation(); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing access token revocation")
+	}
+
+	if err = throttle.InitThrottle(); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing throttle")
+	}
+
+	if err = trash.InitTrash(); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing trash")
+	}
+
+	if err = sessions.InitSessions(); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Error initializing session purge")
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -63,6 +108,7 @@ func main() {
 		AllowedOrigins:   []string{"http://localhost:5173"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"X-CSRF-Token"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -71,10 +117,15 @@ func main() {
 	wsServer := websocket.NewServer()
 
 	controller.NewKanbanController(wsServer).RegisterKanbanRoutes(r)
-	controller.NewAuthController().RegisterAuthRoutes(r)
+	controller.NewAuthController(wsServer).RegisterAuthRoutes(r)
+	controller.NewAdminController(wsServer).RegisterAdminRoutes(r)
 
 	r.With(myMiddleware.ValidateJWT).HandleFunc("/ws", wsServer.HandleWs)
 
+	if local, ok := storage.Default.(*storage.LocalStorage); ok {
+		r.Handle(storage.LocalURLPath+"*", http.StripPrefix(storage.LocalURLPath, local.Handler()))
+	}
+
 	server := http.Server{
 		Addr:         fmt.Sprintf("%s:%d", config.Data.Host, config.Data.Port),
 		Handler:      r,
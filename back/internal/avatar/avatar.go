@@ -0,0 +1,161 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Sizes are edge lengths in pixels of square renditions of every avatar
+var Sizes = []int{64, 128, 256}
+
+const (
+	// maxPixels guards against decompression bombs, dimensions are checked before decoding
+	maxPixels = 40_000_000
+	minEdge   = 16
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("avatar must be a jpeg, png or gif image")
+	ErrInvalidDimensions = errors.New("avatar dimensions are out of bounds")
+)
+
+// Rendition is an avatar resized to one of Sizes
+type Rendition struct {
+	Size        int
+	ContentType string
+	Extension   string
+	Data        []byte
+}
+
+// Render decodes the image, rotates it upright, crops it to a square and encodes it in every size.
+// Re-encoding drops EXIF and any other metadata of the upload. Transparent formats stay png, others become jpeg
+func Render(data []byte) ([]Rendition, error) {
+	contentType := http.DetectContentType(data)
+
+	var decode func([]byte) (image.Image, error)
+	var decodeConfig func([]byte) (image.Config, error)
+	switch contentType {
+	case "image/jpeg":
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+	case "image/png":
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+	case "image/gif":
+		decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) }
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	cfg, err := decodeConfig(data)
+	if err != nil {
+		return nil, errors.Wrap(ErrUnsupportedFormat, err.Error())
+	}
+
+	if cfg.Width < minEdge || cfg.Height < minEdge || cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrInvalidDimensions
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return nil, errors.Wrap(ErrUnsupportedFormat, err.Error())
+	}
+
+	src := toRGBA(img)
+	if contentType == "image/jpeg" {
+		src = orient(src, exifOrientation(data))
+	}
+	src = cropSquare(src)
+
+	renditions := make([]Rendition, 0, len(Sizes))
+	for _, size := range Sizes {
+		resized := resize(src, size)
+
+		var buf bytes.Buffer
+		rendition := Rendition{Size: size}
+
+		if contentType == "image/jpeg" {
+			rendition.ContentType, rendition.Extension = "image/jpeg", "jpg"
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			rendition.ContentType, rendition.Extension = "image/png", "png"
+			err = png.Encode(&buf, resized)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "error encoding avatar of size %d", size)
+		}
+
+		rendition.Data = buf.Bytes()
+		renditions = append(renditions, rendition)
+	}
+
+	return renditions, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	return rgba
+}
+
+func cropSquare(img *image.RGBA) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	edge := min(w, h)
+	x0, y0 := (w-edge)/2, (h-edge)/2
+
+	return toRGBA(img.SubImage(image.Rect(x0, y0, x0+edge, y0+edge)))
+}
+
+// resize scales the square image to size by averaging source pixels covered by each destination pixel.
+// Images smaller than size are scaled up by nearest neighbour
+func resize(src *image.RGBA, size int) *image.RGBA {
+	edge := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		sy0, sy1 := span(y, size, edge)
+		for x := 0; x < size; x++ {
+			sx0, sx1 := span(x, size, edge)
+
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				offset := src.PixOffset(sx0, sy)
+				for sx := sx0; sx < sx1; sx++ {
+					r += uint32(src.Pix[offset])
+					g += uint32(src.Pix[offset+1])
+					b += uint32(src.Pix[offset+2])
+					a += uint32(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// span returns source pixels [from, to) covered by destination pixel i, always at least one
+func span(i, dstSize, srcSize int) (int, int) {
+	from := i * srcSize / dstSize
+	to := (i + 1) * srcSize / dstSize
+
+	return from, max(to, from+1)
+}
@@ -0,0 +1,162 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtures in testdata are the same 32x16 jpeg, red on the left and blue on the right, with EXIF orientation
+// in little endian unless the name says otherwise
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestExifOrientation(t *testing.T) {
+	cases := []struct {
+		fixture     string
+		orientation int
+	}{
+		{"no-exif.jpg", 1},
+		{"orientation-1.jpg", 1},
+		{"orientation-3.jpg", 3},
+		{"orientation-6.jpg", 6},
+		{"orientation-8.jpg", 8},
+		{"orientation-6-big-endian.jpg", 6},
+	}
+
+	for _, tc := range cases {
+		if got := exifOrientation(readFixture(t, tc.fixture)); got != tc.orientation {
+			t.Errorf("exifOrientation(%s) = %d, want %d", tc.fixture, got, tc.orientation)
+		}
+	}
+}
+
+func TestExifOrientationMalformed(t *testing.T) {
+	valid := readFixture(t, "orientation-6.jpg")
+
+	cases := map[string][]byte{
+		"empty":     nil,
+		"not jpeg":  []byte("\x89PNG\r\n\x1a\n"),
+		"truncated": valid[:10],
+		// length of the EXIF segment points past the end of the data
+		"bad segment length": append(append([]byte{}, valid[:4]...), append([]byte{0xFF, 0xFF}, valid[6:]...)...),
+	}
+
+	for name, data := range cases {
+		if got := exifOrientation(data); got != 1 {
+			t.Errorf("exifOrientation(%s) = %d, want 1", name, got)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	const w, h = 3, 2
+
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			src.SetRGBA(x, y, pixel(x, y))
+		}
+	}
+
+	// to maps a pixel of the stored image to where it is shown once the image is upright
+	cases := []struct {
+		orientation int
+		to          func(x, y int) (int, int)
+	}{
+		{1, func(x, y int) (int, int) { return x, y }},
+		{2, func(x, y int) (int, int) { return w - 1 - x, y }},
+		{3, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }},
+		{4, func(x, y int) (int, int) { return x, h - 1 - y }},
+		{5, func(x, y int) (int, int) { return y, x }},
+		{6, func(x, y int) (int, int) { return h - 1 - y, x }},
+		{7, func(x, y int) (int, int) { return h - 1 - y, w - 1 - x }},
+		{8, func(x, y int) (int, int) { return y, w - 1 - x }},
+	}
+
+	for _, tc := range cases {
+		dst := orient(src, tc.orientation)
+
+		dw, dh := w, h
+		if tc.orientation >= 5 {
+			dw, dh = h, w
+		}
+
+		if dst.Bounds().Dx() != dw || dst.Bounds().Dy() != dh {
+			t.Errorf("orient(%d) is %dx%d, want %dx%d", tc.orientation, dst.Bounds().Dx(), dst.Bounds().Dy(), dw, dh)
+			continue
+		}
+
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				dx, dy := tc.to(x, y)
+				if got := dst.RGBAAt(dx, dy); got != pixel(x, y) {
+					t.Errorf("orient(%d) at %d,%d = %v, want pixel %d,%d", tc.orientation, dx, dy, got, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderOrientsJPEG(t *testing.T) {
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+
+	// colors at the corners of the upright avatar, which is the middle of the image cropped to a square
+	cases := []struct {
+		fixture                       string
+		topLeft, topRight, bottomLeft color.RGBA
+	}{
+		{"orientation-1.jpg", red, blue, red},
+		{"orientation-3.jpg", blue, red, blue},
+		{"orientation-6.jpg", red, red, blue},
+		{"orientation-8.jpg", blue, blue, red},
+	}
+
+	for _, tc := range cases {
+		renditions, err := Render(readFixture(t, tc.fixture))
+		if err != nil {
+			t.Fatalf("Render(%s): %v", tc.fixture, err)
+		}
+
+		rendition := renditions[len(renditions)-1]
+		img, err := jpeg.Decode(bytes.NewReader(rendition.Data))
+		if err != nil {
+			t.Fatalf("decoding rendition of %s: %v", tc.fixture, err)
+		}
+
+		near, far := rendition.Size/8, rendition.Size-1-rendition.Size/8
+		checkColor(t, tc.fixture, "top left", img.At(near, near), tc.topLeft)
+		checkColor(t, tc.fixture, "top right", img.At(far, near), tc.topRight)
+		checkColor(t, tc.fixture, "bottom left", img.At(near, far), tc.bottomLeft)
+	}
+}
+
+func pixel(x, y int) color.RGBA {
+	return color.RGBA{R: uint8(x * 50), G: uint8(y * 50), B: 100, A: 255}
+}
+
+// checkColor compares loosely, jpeg compression shifts colors a little
+func checkColor(t *testing.T, fixture, where string, got color.Color, want color.RGBA) {
+	t.Helper()
+
+	r, g, b, _ := got.RGBA()
+	near := func(v uint32, want uint8) bool {
+		return int(v>>8)-int(want) < 64 && int(want)-int(v>>8) < 64
+	}
+
+	if !near(r, want.R) || !near(g, want.G) || !near(b, want.B) {
+		t.Errorf("%s: %s is %v, want about %v", fixture, where, got, want)
+	}
+}
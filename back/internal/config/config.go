@@ -8,19 +8,81 @@ import (
 )
 
 type Config struct {
-	Env                   string
-	Host                  string
-	Port                  int
-	SaltRounds            int
+	Env  string
+	Host string
+	Port int
+	// SaltRounds is the bcrypt cost
+	SaltRounds int
+	// PasswordHasher is argon2id or bcrypt, hashes of the other one are upgraded on login
+	PasswordHasher        string
+	Argon2MemoryKiB       int
+	Argon2Iterations      int
+	Argon2Parallelism     int
 	RefreshTokenExpHours  int
 	AccessTokenExpMinutes int
 	FilenameLogOutput     string
-	JWTSecret             []byte
-	PostgresHost          string
-	PostgresPort          int
-	PostgresUser          string
-	PostgresPassword      string
-	PostgresDatabase      string
+	// JWTSecret only verifies HS256 tokens issued before asymmetric signing, leave empty once they expired
+	JWTSecret []byte
+	// JWTAlgorithm is RS256 or EdDSA
+	JWTAlgorithm              string
+	JWTKeyRotationHours       int
+	PostgresHost              string
+	PostgresPort              int
+	PostgresUser              string
+	PostgresPassword          string
+	PostgresDatabase          string
+	FrontendURL               string
+	Mailer                    string
+	MailFrom                  string
+	MailFile                  string
+	SMTPHost                  string
+	SMTPPort                  int
+	SMTPUsername              string
+	SMTPPassword              string
+	PasswordResetExpMinutes   int
+	EmailVerificationExpHours int
+	// RequireVerifiedEmailLogin blocks login of users with unverified email
+	RequireVerifiedEmailLogin bool
+	// RequireVerifiedEmailMembership blocks adding users with unverified email to projects, on unless turned off
+	RequireVerifiedEmailMembership bool
+	// ProjectInvitationExpHours is how long invitations to projects can be accepted
+	ProjectInvitationExpHours int
+	// ProjectTransferExpHours is how long the new owner has to accept transfer of a project
+	ProjectTransferExpHours int
+	// TrashRetentionDays is how long projects, columns and rows stay in trash before they are deleted for good
+	TrashRetentionDays int
+	// TOTPIssuer is the account issuer shown in authenticator apps
+	TOTPIssuer                   string
+	TwoFactorChallengeExpMinutes int
+	// OIDCIssuer enables single sign-on with the OpenID Connect provider when set
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is the public url of /auth/oidc/callback registered at the provider
+	OIDCRedirectURL string
+	// OIDCScopes is space separated list of requested scopes
+	OIDCScopes string
+	// ThrottleStore is memory or postgres, the latter shares counters between instances
+	ThrottleStore                  string
+	ThrottleIPFreeAttempts         int
+	ThrottleIPLockoutAttempts      int
+	ThrottleAccountFreeAttempts    int
+	ThrottleAccountLockoutAttempts int
+	ThrottleBaseDelaySeconds       int
+	ThrottleLockoutMinutes         int
+	// ThrottleWindowMinutes is how long failures are remembered
+	ThrottleWindowMinutes int
+	// Storage is local or s3
+	Storage         string
+	StorageLocalDir string
+	// StoragePublicURL is the url stored files are read from, for s3 it defaults to endpoint/bucket
+	StoragePublicURL  string
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	AvatarMaxBytes    int
 }
 
 var Data Config
@@ -38,6 +100,21 @@ func Initialize() error {
 		return errors.Wrap(err, "salt rounds is not a number")
 	}
 
+	argon2MemoryKiBInt, err := getEnvInt("ARGON2_MEMORY_KIB", 19456)
+	if err != nil {
+		return errors.Wrap(err, "argon2 memory is not a number")
+	}
+
+	argon2IterationsInt, err := getEnvInt("ARGON2_ITERATIONS", 2)
+	if err != nil {
+		return errors.Wrap(err, "argon2 iterations is not a number")
+	}
+
+	argon2ParallelismInt, err := getEnvInt("ARGON2_PARALLELISM", 1)
+	if err != nil {
+		return errors.Wrap(err, "argon2 parallelism is not a number")
+	}
+
 	refreshTokenExpHours := os.Getenv("REFRESH_TOKEN_EXP_H")
 	refreshTokenExpHoursInt, err := strconv.Atoi(refreshTokenExpHours)
 	if err != nil {
@@ -56,21 +133,186 @@ func Initialize() error {
 		return errors.Wrap(err, "postgres port is not a number")
 	}
 
+	smtpPortInt, err := getEnvInt("SMTP_PORT", 587)
+	if err != nil {
+		return errors.Wrap(err, "smtp port is not a number")
+	}
+
+	passwordResetExpMinutesInt, err := getEnvInt("PASSWORD_RESET_EXP_M", 30)
+	if err != nil {
+		return errors.Wrap(err, "password reset exp minutes is not a number")
+	}
+
+	emailVerificationExpHoursInt, err := getEnvInt("EMAIL_VERIFICATION_EXP_H", 48)
+	if err != nil {
+		return errors.Wrap(err, "email verification exp hours is not a number")
+	}
+
+	requireVerifiedEmailLogin, err := getEnvBool("REQUIRE_VERIFIED_EMAIL_LOGIN", false)
+	if err != nil {
+		return errors.Wrap(err, "require verified email login is not a bool")
+	}
+
+	requireVerifiedEmailMembership, err := getEnvBool("REQUIRE_VERIFIED_EMAIL_MEMBERSHIP", true)
+	if err != nil {
+		return errors.Wrap(err, "require verified email membership is not a bool")
+	}
+
+	projectInvitationExpHoursInt, err := getEnvInt("PROJECT_INVITATION_EXP_H", 168)
+	if err != nil {
+		return errors.Wrap(err, "project invitation exp hours is not a number")
+	}
+
+	projectTransferExpHoursInt, err := getEnvInt("PROJECT_TRANSFER_EXP_H", 168)
+	if err != nil {
+		return errors.Wrap(err, "project transfer exp hours is not a number")
+	}
+
+	trashRetentionDaysInt, err := getEnvInt("TRASH_RETENTION_DAYS", 30)
+	if err != nil {
+		return errors.Wrap(err, "trash retention days is not a number")
+	}
+
+	twoFactorChallengeExpMinutesInt, err := getEnvInt("TWO_FACTOR_CHALLENGE_EXP_M", 5)
+	if err != nil {
+		return errors.Wrap(err, "two factor challenge exp minutes is not a number")
+	}
+
+	jwtKeyRotationHoursInt, err := getEnvInt("JWT_KEY_ROTATION_H", 720)
+	if err != nil {
+		return errors.Wrap(err, "jwt key rotation hours is not a number")
+	}
+
+	throttleIPFreeAttemptsInt, err := getEnvInt("THROTTLE_IP_FREE_ATTEMPTS", 20)
+	if err != nil {
+		return errors.Wrap(err, "throttle ip free attempts is not a number")
+	}
+
+	throttleIPLockoutAttemptsInt, err := getEnvInt("THROTTLE_IP_LOCKOUT_ATTEMPTS", 100)
+	if err != nil {
+		return errors.Wrap(err, "throttle ip lockout attempts is not a number")
+	}
+
+	throttleAccountFreeAttemptsInt, err := getEnvInt("THROTTLE_ACCOUNT_FREE_ATTEMPTS", 5)
+	if err != nil {
+		return errors.Wrap(err, "throttle account free attempts is not a number")
+	}
+
+	throttleAccountLockoutAttemptsInt, err := getEnvInt("THROTTLE_ACCOUNT_LOCKOUT_ATTEMPTS", 10)
+	if err != nil {
+		return errors.Wrap(err, "throttle account lockout attempts is not a number")
+	}
+
+	throttleBaseDelaySecondsInt, err := getEnvInt("THROTTLE_BASE_DELAY_S", 1)
+	if err != nil {
+		return errors.Wrap(err, "throttle base delay seconds is not a number")
+	}
+
+	throttleLockoutMinutesInt, err := getEnvInt("THROTTLE_LOCKOUT_M", 15)
+	if err != nil {
+		return errors.Wrap(err, "throttle lockout minutes is not a number")
+	}
+
+	throttleWindowMinutesInt, err := getEnvInt("THROTTLE_WINDOW_M", 60)
+	if err != nil {
+		return errors.Wrap(err, "throttle window minutes is not a number")
+	}
+
+	avatarMaxBytesInt, err := getEnvInt("AVATAR_MAX_BYTES", 5<<20)
+	if err != nil {
+		return errors.Wrap(err, "avatar max bytes is not a number")
+	}
+
 	Data = Config{
-		Env:                   os.Getenv("ENV"),
-		Host:                  os.Getenv("HOST"),
-		Port:                  portInt,
-		SaltRounds:            saltRoundsInt,
-		RefreshTokenExpHours:  refreshTokenExpHoursInt,
-		AccessTokenExpMinutes: accessTokenExpMinutesInt,
-		FilenameLogOutput:     os.Getenv("FNAME_LOG_OUT"),
-		JWTSecret:             []byte(os.Getenv("JWT_SECRET")),
-		PostgresHost:          os.Getenv("POSTGRES_HOST"),
-		PostgresPort:          postgresPortInt,
-		PostgresUser:          os.Getenv("POSTGRES_USER"),
-		PostgresPassword:      os.Getenv("POSTGRES_PASSWORD"),
-		PostgresDatabase:      os.Getenv("POSTGRES_DB"),
+		Env:                            os.Getenv("ENV"),
+		Host:                           os.Getenv("HOST"),
+		Port:                           portInt,
+		SaltRounds:                     saltRoundsInt,
+		PasswordHasher:                 getEnv("PASSWORD_HASHER", "argon2id"),
+		Argon2MemoryKiB:                argon2MemoryKiBInt,
+		Argon2Iterations:               argon2IterationsInt,
+		Argon2Parallelism:              argon2ParallelismInt,
+		RefreshTokenExpHours:           refreshTokenExpHoursInt,
+		AccessTokenExpMinutes:          accessTokenExpMinutesInt,
+		FilenameLogOutput:              os.Getenv("FNAME_LOG_OUT"),
+		JWTSecret:                      []byte(os.Getenv("JWT_SECRET")),
+		JWTAlgorithm:                   getEnv("JWT_ALGORITHM", "RS256"),
+		JWTKeyRotationHours:            jwtKeyRotationHoursInt,
+		PostgresHost:                   os.Getenv("POSTGRES_HOST"),
+		PostgresPort:                   postgresPortInt,
+		PostgresUser:                   os.Getenv("POSTGRES_USER"),
+		PostgresPassword:               os.Getenv("POSTGRES_PASSWORD"),
+		PostgresDatabase:               os.Getenv("POSTGRES_DB"),
+		FrontendURL:                    os.Getenv("FRONTEND_URL"),
+		Mailer:                         os.Getenv("MAILER"),
+		MailFrom:                       os.Getenv("MAIL_FROM"),
+		MailFile:                       os.Getenv("MAIL_FILE"),
+		SMTPHost:                       os.Getenv("SMTP_HOST"),
+		SMTPPort:                       smtpPortInt,
+		SMTPUsername:                   os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:                   os.Getenv("SMTP_PASSWORD"),
+		PasswordResetExpMinutes:        passwordResetExpMinutesInt,
+		EmailVerificationExpHours:      emailVerificationExpHoursInt,
+		RequireVerifiedEmailLogin:      requireVerifiedEmailLogin,
+		RequireVerifiedEmailMembership: requireVerifiedEmailMembership,
+		ProjectInvitationExpHours:      projectInvitationExpHoursInt,
+		ProjectTransferExpHours:        projectTransferExpHoursInt,
+		TrashRetentionDays:             trashRetentionDaysInt,
+		TOTPIssuer:                     getEnv("TOTP_ISSUER", "squid"),
+		TwoFactorChallengeExpMinutes:   twoFactorChallengeExpMinutesInt,
+		OIDCIssuer:                     os.Getenv("OIDC_ISSUER"),
+		OIDCClientID:                   os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:               os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:                os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:                     getEnv("OIDC_SCOPES", "openid email profile"),
+		ThrottleStore:                  getEnv("THROTTLE_STORE", "memory"),
+		ThrottleIPFreeAttempts:         throttleIPFreeAttemptsInt,
+		ThrottleIPLockoutAttempts:      throttleIPLockoutAttemptsInt,
+		ThrottleAccountFreeAttempts:    throttleAccountFreeAttemptsInt,
+		ThrottleAccountLockoutAttempts: throttleAccountLockoutAttemptsInt,
+		ThrottleBaseDelaySeconds:       throttleBaseDelaySecondsInt,
+		ThrottleLockoutMinutes:         throttleLockoutMinutesInt,
+		ThrottleWindowMinutes:          throttleWindowMinutesInt,
+		Storage:                        getEnv("STORAGE", "local"),
+		StorageLocalDir:                getEnv("STORAGE_LOCAL_DIR", "uploads"),
+		StoragePublicURL:               os.Getenv("STORAGE_PUBLIC_URL"),
+		S3Endpoint:                     os.Getenv("S3_ENDPOINT"),
+		S3Region:                       getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:                       os.Getenv("S3_BUCKET"),
+		S3AccessKeyID:                  os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey:              os.Getenv("S3_SECRET_ACCESS_KEY"),
+		AvatarMaxBytes:                 avatarMaxBytesInt,
 	}
 
 	return nil
 }
+
+// getEnv Returns def if env variable is not set
+func getEnv(key string, def string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def
+	}
+
+	return value
+}
+
+// getEnvInt Returns def if env variable is not set
+func getEnvInt(key string, def int) (int, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// getEnvBool Returns def if env variable is not set
+func getEnvBool(key string, def bool) (bool, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def, nil
+	}
+
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/finkabaj/squid/back/internal/middleware"
+	"github.com/finkabaj/squid/back/internal/service"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/finkabaj/squid/back/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+var adminControllerInitialized = false
+
+type AdminController struct {
+	WSServer *websocket.Server
+}
+
+func NewAdminController(wsServer *websocket.Server) *AdminController {
+	return &AdminController{
+		WSServer: wsServer,
+	}
+}
+
+func (c *AdminController) RegisterAdminRoutes(r *chi.Mux) {
+	if adminControllerInitialized {
+		return
+	}
+
+	r.Route("/admin", func(r chi.Router) {
+		// personal access tokens do not grant administration even to admins
+		r.Use(middleware.CSRF, middleware.ValidateSession, middleware.RequireAdmin)
+
+		r.With(middleware.ValidateQuery(decodeAdminUserSearch)).Get("/users", c.searchUsers)
+		r.Get("/users/{user_id}", c.getUser)
+		r.Post("/users/{user_id}/disable", c.disableUser)
+		r.Post("/users/{user_id}/enable", c.enableUser)
+		r.Post("/users/{user_id}/password-reset", c.forcePasswordReset)
+		r.With(middleware.ValidateJson[types.AdminDeleteAccount]()).Delete("/users/{user_id}", c.deleteUser)
+
+		r.With(middleware.ValidateQuery(decodePageQuery)).Get("/projects", c.getProjects)
+		r.With(middleware.ValidateJson[types.ReassignProjectOwner]()).Post("/projects/{project_id}/owner", c.reassignProjectOwner)
+
+		r.With(middleware.ValidateQuery(decodeAuthEventQuery)).Get("/auth-events", c.getAuthEvents)
+	})
+
+	adminControllerInitialized = true
+}
+
+func (c *AdminController) searchUsers(w http.ResponseWriter, r *http.Request) {
+	search, ok := middleware.QueryFromContext(r.Context()).(types.AdminUserSearch)
+
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get user search from context")))
+		return
+	}
+
+	page, err := service.AdminSearchUsers(&search)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, page); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal users"))
+	}
+}
+
+// decodeAdminUserSearch defaults missing limit to 50, malformed numbers fail validation
+func decodeAdminUserSearch(q string) types.AdminUserSearch {
+	values, _ := url.ParseQuery(q)
+	page := decodePageQuery(q)
+
+	return types.AdminUserSearch{
+		Query:  values.Get("q"),
+		Limit:  page.Limit,
+		Offset: page.Offset,
+	}
+}
+
+// decodePageQuery defaults missing limit to 50, malformed numbers fail validation
+func decodePageQuery(q string) types.PageQuery {
+	values, _ := url.ParseQuery(q)
+
+	page := types.PageQuery{Limit: 50}
+
+	if limit := values.Get("limit"); limit != "" {
+		page.Limit, _ = strconv.Atoi(limit)
+	}
+
+	if offset := values.Get("offset"); offset != "" {
+		var err error
+		if page.Offset, err = strconv.Atoi(offset); err != nil {
+			page.Offset = -1
+		}
+	}
+
+	return page
+}
+
+func (c *AdminController) getUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "user_id")
+
+	user, err := service.GetUserById(&userID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, user); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+	}
+}
+
+func (c *AdminController) disableUser(w http.ResponseWriter, r *http.Request) {
+	c.setUserDisabled(w, r, true)
+}
+
+func (c *AdminController) enableUser(w http.ResponseWriter, r *http.Request) {
+	c.setUserDisabled(w, r, false)
+}
+
+func (c *AdminController) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	userID := chi.URLParam(r, "user_id")
+	admin := middleware.UserFromContext(r.Context())
+
+	user, _, err := service.SetUserDisabled(&admin, &userID, disabled)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if disabled {
+		c.WSServer.CloseUser(user.ID)
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, user); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+	}
+}
+
+func (c *AdminController) forcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "user_id")
+	admin := middleware.UserFromContext(r.Context())
+
+	user, sessionIDs, err := service.ForcePasswordReset(&admin, &userID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	c.WSServer.CloseSessions(user.ID, sessionIDs...)
+
+	if err = utils.MarshalBody(w, http.StatusOK, user); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+	}
+}
+
+func (c *AdminController) deleteUser(w http.ResponseWriter, r *http.Request) {
+	adminDeleteAccount, ok := middleware.JsonFromContext(r.Context()).(types.AdminDeleteAccount)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get delete account from context")))
+		return
+	}
+
+	userID := chi.URLParam(r, "user_id")
+	admin := middleware.UserFromContext(r.Context())
+
+	if userID == admin.ID {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("admins delete their own account with DELETE /auth/user")))
+		return
+	}
+
+	deleted, err := service.AdminDeleteAccount(&userID, &types.DeleteAccount{
+		DeleteOwnedProjects: adminDeleteAccount.DeleteOwnedProjects,
+		Transfers:           adminDeleteAccount.Transfers,
+	})
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	broadcastAccountDeleted(c.WSServer, &deleted)
+
+	if err = utils.MarshalBody(w, http.StatusOK, deleted); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal deleted account"))
+	}
+}
+
+func (c *AdminController) getProjects(w http.ResponseWriter, r *http.Request) {
+	page, ok := middleware.QueryFromContext(r.Context()).(types.PageQuery)
+
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get page from context")))
+		return
+	}
+
+	projects, err := service.GetAllProjects(&page)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, projects); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal projects"))
+	}
+}
+
+func (c *AdminController) reassignProjectOwner(w http.ResponseWriter, r *http.Request) {
+	reassign, ok := middleware.JsonFromContext(r.Context()).(types.ReassignProjectOwner)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get new owner from context")))
+		return
+	}
+
+	projectID := chi.URLParam(r, "project_id")
+
+	project, err := service.ReassignProjectOwner(&projectID, &reassign)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, project); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal project"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectUpdatedEvent, "project updated", project, projectUsers)
+}
+
+func (c *AdminController) getAuthEvents(w http.ResponseWriter, r *http.Request) {
+	query, ok := middleware.QueryFromContext(r.Context()).(types.AuthEventQuery)
+
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get auth event query from context")))
+		return
+	}
+
+	page, err := service.GetAuthEvents(&query)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, page); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal auth events"))
+	}
+}
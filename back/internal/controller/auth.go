@@ -1,12 +1,18 @@
 package controller
 
 import (
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/finkabaj/squid/back/internal/config"
 	"github.com/finkabaj/squid/back/internal/service"
 	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/finkabaj/squid/back/internal/websocket"
 
 	"github.com/finkabaj/squid/back/internal/middleware"
 	"github.com/finkabaj/squid/back/internal/types"
@@ -16,10 +22,13 @@ import (
 var authControllerInitialized bool
 
 type AuthController struct {
+	WSServer *websocket.Server
 }
 
-func NewAuthController() *AuthController {
-	return &AuthController{}
+func NewAuthController(wsServer *websocket.Server) *AuthController {
+	return &AuthController{
+		WSServer: wsServer,
+	}
 }
 
 func (c *AuthController) RegisterAuthRoutes(r *chi.Mux) {
@@ -29,17 +38,72 @@ func (c *AuthController) RegisterAuthRoutes(r *chi.Mux) {
 
 	r.Route("/auth", func(r chi.Router) {
 		r.With(middleware.ValidateJson[types.Login]()).Post("/login", c.login)
+		r.With(middleware.ValidateJson[types.LoginTwoFactor]()).Post("/login/2fa", c.loginTwoFactor)
 		r.With(middleware.ValidateJson[types.RegisterUser]()).Post("/register", c.register)
-		r.Post("/refresh", c.refreshToken)
-		r.Post("/logout", c.logout)
-		r.With(middleware.ValidateJWT, middleware.ValidateJson[types.UpdateUser]()).Patch("/user", c.updateUser)
-		r.With(middleware.ValidateJWT, middleware.ValidateJson[types.UpdatePassword]()).Patch("/password", c.updatePassword)
-		r.With(middleware.ValidateJWT).Get("/user/{id}", c.getUser)
+		r.Get("/oidc/login", c.oidcLogin)
+		r.With(middleware.ValidateQuery(decodeOIDCCallback)).Get("/oidc/callback", c.oidcCallback)
+		r.With(middleware.ValidateJson[types.ForgotPassword]()).Post("/password/forgot", c.forgotPassword)
+		r.With(middleware.ValidateJson[types.ResetPassword]()).Post("/password/reset", c.resetPassword)
+		r.With(middleware.ValidateJson[types.VerifyEmail]()).Post("/email/verify", c.verifyEmail)
+		r.With(middleware.ValidateJson[types.ResendVerification]()).Post("/email/verify/resend", c.resendVerification)
+		r.With(middleware.ValidateJson[types.ConfirmEmailChange]()).Post("/email/change/confirm", c.confirmEmailChange)
+
+		// endpoints above do not act with the token cookies, the ones below do. Refresh issues CSRF token to
+		// sessions that do not have one yet
+		r.With(middleware.CSRFIfIssued).Post("/refresh", c.refreshToken)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.CSRF)
+
+			r.Post("/logout", c.logout)
+			r.With(middleware.ValidateJWT, middleware.ValidateJson[types.UpdateUser]()).Patch("/user", c.updateUser)
+			r.With(middleware.ValidateSession, middleware.ValidateJson[types.DeleteAccount]()).Delete("/user", c.deleteAccount)
+			r.With(middleware.ValidateJWT).Put("/user/avatar", c.uploadAvatar)
+			r.With(middleware.ValidateJWT).Delete("/user/avatar", c.deleteAvatar)
+			r.With(middleware.ValidateSession, middleware.ValidateJson[types.UpdatePassword]()).Patch("/password", c.updatePassword)
+			r.With(middleware.ValidateSession, middleware.ValidateJson[types.ChangeEmail]()).Post("/email/change", c.requestEmailChange)
+			r.With(middleware.ValidateJWT).Get("/user/{id}", c.getUser)
+
+			r.With(middleware.ValidateSession).Post("/2fa/enroll", c.enrollTwoFactor)
+			r.With(middleware.ValidateSession, middleware.ValidateJson[types.TwoFactorCode]()).Post("/2fa/confirm", c.confirmTwoFactor)
+			r.With(middleware.ValidateSession, middleware.ValidateJson[types.PasswordConfirmation]()).Post("/2fa/disable", c.disableTwoFactor)
+			r.With(middleware.ValidateSession, middleware.ValidateJson[types.PasswordConfirmation]()).Post("/2fa/recovery-codes", c.regenerateRecoveryCodes)
+
+			r.With(middleware.ValidateSession).Get("/sessions", c.getSessions)
+			r.With(middleware.ValidateSession).Delete("/sessions/others", c.revokeOtherSessions)
+			r.With(middleware.ValidateSession).Delete("/sessions/{session_id}", c.revokeSession)
+
+			r.With(middleware.ValidateSession).Get("/tokens", c.getPersonalAccessTokens)
+			r.With(middleware.ValidateSession, middleware.ValidateJson[types.CreatePersonalAccessToken]()).Post("/tokens", c.createPersonalAccessToken)
+			r.With(middleware.ValidateSession).Delete("/tokens/{token_id}", c.revokePersonalAccessToken)
+
+			r.With(middleware.ValidateSession, middleware.ValidateQuery(decodeAuthEventQuery)).Get("/events", c.getAuthEvents)
+		})
 	})
 
+	r.With(middleware.ValidateJWT, middleware.ValidateQuery(decodeUserSearch)).Get("/users/search", c.searchUsers)
+
+	r.Get("/.well-known/jwks.json", c.getJWKS)
+
 	authControllerInitialized = true
 }
 
+// broadcastJoinedProjects tells participants of projects the user joined by accepted invitations about the new member
+func (c *AuthController) broadcastJoinedProjects(projects []types.Project) {
+	for _, project := range projects {
+		c.WSServer.BroadcastToProject(project.ID, websocket.ProjectUpdatedEvent, "project updated", project, projectUserIDs(&project))
+	}
+}
+
+func (c *AuthController) getJWKS(w http.ResponseWriter, r *http.Request) {
+	// keys are published before they are retired, so verifiers may cache them for a while
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := utils.MarshalBody(w, http.StatusOK, service.GetJWKS()); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal jwks"))
+	}
+}
+
 func (c *AuthController) register(w http.ResponseWriter, r *http.Request) {
 	register, ok := middleware.JsonFromContext(r.Context()).(types.RegisterUser)
 
@@ -48,19 +112,29 @@ func (c *AuthController) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := service.Register(&register)
+	client := utils.GetClientInfo(r)
+
+	user, err := service.Register(&register, &client)
 
 	if err != nil {
 		utils.HandleError(w, err)
 		return
 	}
 
-	utils.SetTokenCookie(w, "access_token", user.TokenPair.AccessToken, user.TokenPair.AccessTokenExpiry)
-	utils.SetTokenCookie(w, "refresh_token", user.TokenPair.RefreshToken, user.TokenPair.RefreshTokenExpiry)
+	// session is not started when login requires verified email
+	if user.TokenPair.AccessToken != "" {
+		if err = setTokenCookies(w, &user.TokenPair, ""); err != nil {
+			utils.HandleError(w, utils.NewInternalError(err))
+			return
+		}
+	}
 
 	if err = utils.MarshalBody(w, http.StatusCreated, user.User); err != nil {
 		utils.HandleError(w, errors.New("Failed to marshal user"))
+		return
 	}
+
+	c.broadcastJoinedProjects(user.JoinedProjects)
 }
 
 func (c *AuthController) login(w http.ResponseWriter, r *http.Request) {
@@ -71,21 +145,281 @@ func (c *AuthController) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := service.Login(&login)
+	client := utils.GetClientInfo(r)
+
+	user, err := service.Login(&login, &client)
+
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if user.Challenge != nil {
+		if err = utils.MarshalBody(w, http.StatusAccepted, user.Challenge); err != nil {
+			utils.HandleError(w, errors.New("Failed to marshal login challenge"))
+		}
+		return
+	}
+
+	if err = setTokenCookies(w, &user.TokenPair, ""); err != nil {
+		utils.HandleError(w, utils.NewInternalError(err))
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, user.User); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+	}
+}
+
+func (c *AuthController) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	login, ok := middleware.JsonFromContext(r.Context()).(types.LoginTwoFactor)
+
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get two-factor login from context")))
+		return
+	}
+
+	client := utils.GetClientInfo(r)
+
+	user, err := service.LoginTwoFactor(&login, &client)
 
 	if err != nil {
 		utils.HandleError(w, err)
 		return
 	}
 
-	utils.SetTokenCookie(w, "access_token", user.TokenPair.AccessToken, user.TokenPair.AccessTokenExpiry)
-	utils.SetTokenCookie(w, "refresh_token", user.TokenPair.RefreshToken, user.TokenPair.RefreshTokenExpiry)
+	if err = setTokenCookies(w, &user.TokenPair, ""); err != nil {
+		utils.HandleError(w, utils.NewInternalError(err))
+		return
+	}
 
 	if err = utils.MarshalBody(w, http.StatusOK, user.User); err != nil {
 		utils.HandleError(w, errors.New("Failed to marshal user"))
 	}
 }
 
+func (c *AuthController) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := service.StartOIDCLogin()
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	setOIDCStateCookie(w, state, time.Now().Add(10*time.Minute))
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (c *AuthController) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	callback, ok := middleware.QueryFromContext(r.Context()).(types.OIDCCallback)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get oidc callback from context")))
+		return
+	}
+
+	var boundState string
+	if cookie, err := r.Cookie("oidc_state"); err == nil {
+		boundState = cookie.Value
+	}
+	setOIDCStateCookie(w, "", time.Unix(0, 0))
+
+	client := utils.GetClientInfo(r)
+
+	user, err := service.CompleteOIDCLogin(&callback, boundState, &client)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	c.broadcastJoinedProjects(user.JoinedProjects)
+
+	// the frontend finishes the login with POST /auth/login/2fa, the fragment is not sent to any server
+	if user.Challenge != nil {
+		http.Redirect(w, r, config.Data.FrontendURL+"/login/2fa#challenge="+url.QueryEscape(user.Challenge.Challenge), http.StatusFound)
+		return
+	}
+
+	if err = setTokenCookies(w, &user.TokenPair, ""); err != nil {
+		utils.HandleError(w, utils.NewInternalError(err))
+		return
+	}
+
+	http.Redirect(w, r, config.Data.FrontendURL, http.StatusFound)
+}
+
+func (c *AuthController) searchUsers(w http.ResponseWriter, r *http.Request) {
+	search, ok := middleware.QueryFromContext(r.Context()).(types.UserSearch)
+
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get user search from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	page, err := service.SearchUsers(&user.ID, &search)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, page); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal users"))
+	}
+}
+
+// decodeUserSearch defaults missing limit to 20, malformed numbers fail validation
+func decodeUserSearch(q string) types.UserSearch {
+	values, _ := url.ParseQuery(q)
+
+	search := types.UserSearch{
+		Query: values.Get("q"),
+		Limit: 20,
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		search.Limit, _ = strconv.Atoi(limit)
+	}
+
+	if offset := values.Get("offset"); offset != "" {
+		var err error
+		if search.Offset, err = strconv.Atoi(offset); err != nil {
+			search.Offset = -1
+		}
+	}
+
+	return search
+}
+
+// decodeAuthEventQuery defaults missing limit to 50, malformed numbers fail validation
+func decodeAuthEventQuery(q string) types.AuthEventQuery {
+	values, _ := url.ParseQuery(q)
+
+	query := types.AuthEventQuery{
+		UserID: values.Get("user_id"),
+		Type:   types.AuthEventType(values.Get("type")),
+		From:   values.Get("from"),
+		To:     values.Get("to"),
+		Limit:  50,
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		query.Limit, _ = strconv.Atoi(limit)
+	}
+
+	if offset := values.Get("offset"); offset != "" {
+		var err error
+		if query.Offset, err = strconv.Atoi(offset); err != nil {
+			query.Offset = -1
+		}
+	}
+
+	return query
+}
+
+func decodeOIDCCallback(q string) types.OIDCCallback {
+	values, _ := url.ParseQuery(q)
+
+	return types.OIDCCallback{
+		Code:             values.Get("code"),
+		State:            values.Get("state"),
+		Error:            values.Get("error"),
+		ErrorDescription: values.Get("error_description"),
+	}
+}
+
+// setOIDCStateCookie binds login state to the user agent. It has to be lax, because the provider
+// redirects back with cross-site navigation
+func setOIDCStateCookie(w http.ResponseWriter, state string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidc_state",
+		Value:    state,
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/auth/oidc",
+	})
+}
+
+func (c *AuthController) enrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+
+	enrollment, err := service.EnrollTwoFactor(&user)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, enrollment); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal two-factor enrollment"))
+	}
+}
+
+func (c *AuthController) confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	code, ok := middleware.JsonFromContext(r.Context()).(types.TwoFactorCode)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get two-factor code from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	client := utils.GetClientInfo(r)
+
+	recoveryCodes, err := service.ConfirmTwoFactor(&user, &code, &client)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, recoveryCodes); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal recovery codes"))
+	}
+}
+
+func (c *AuthController) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	confirmation, ok := middleware.JsonFromContext(r.Context()).(types.PasswordConfirmation)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get password confirmation from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	sessionID := middleware.SessionIDFromContext(r.Context())
+	client := utils.GetClientInfo(r)
+
+	updatedUser, err := service.DisableTwoFactor(&user, &sessionID, &confirmation, &client)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, updatedUser); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+	}
+}
+
+func (c *AuthController) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	confirmation, ok := middleware.JsonFromContext(r.Context()).(types.PasswordConfirmation)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get password confirmation from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	sessionID := middleware.SessionIDFromContext(r.Context())
+
+	recoveryCodes, err := service.RegenerateRecoveryCodes(&user, &sessionID, &confirmation)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, recoveryCodes); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal recovery codes"))
+	}
+}
+
 func (c *AuthController) updateUser(w http.ResponseWriter, r *http.Request) {
 	updatedUser, ok := middleware.JsonFromContext(r.Context()).(types.UpdateUser)
 	if !ok {
@@ -106,6 +440,117 @@ func (c *AuthController) updateUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// uploadAvatar expects the image in avatar field of multipart form
+func (c *AuthController) uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	data, err := readAvatar(w, r)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	updatedUser, err := service.UploadAvatar(&user, data)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, updatedUser); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+	}
+}
+
+// readAvatar reads at most one byte over the size limit, so oversized avatars are rejected without reading them whole
+func readAvatar(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	limit := int64(config.Data.AvatarMaxBytes)
+	// leaves room for multipart headers and other fields
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, utils.NewBadRequestError(err)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, utils.NewValidationError(map[string]string{"avatar": "required"})
+		} else if err != nil {
+			return nil, utils.NewBadRequestError(err)
+		}
+
+		if part.FormName() != "avatar" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, limit+1))
+		if err != nil {
+			return nil, utils.NewBadRequestError(err)
+		}
+
+		return data, nil
+	}
+}
+
+func (c *AuthController) deleteAvatar(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+
+	updatedUser, err := service.DeleteAvatar(&user)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, updatedUser); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+	}
+}
+
+func (c *AuthController) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	deleteAccount, ok := middleware.JsonFromContext(r.Context()).(types.DeleteAccount)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get delete account from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	sessionID := middleware.SessionIDFromContext(r.Context())
+	client := utils.GetClientInfo(r)
+
+	deleted, err := service.DeleteAccount(&user, &sessionID, &deleteAccount, &client)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	clearTokenCookies(w)
+
+	if err = utils.MarshalBody(w, http.StatusOK, deleted); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal deleted account"))
+	}
+
+	broadcastAccountDeleted(c.WSServer, &deleted)
+}
+
+// broadcastAccountDeleted disconnects the deleted user and notifies remaining users of affected projects
+func broadcastAccountDeleted(wsServer *websocket.Server, deleted *types.DeletedAccount) {
+	wsServer.CloseUser(deleted.UserID)
+
+	for _, project := range deleted.DeletedProjects {
+		// creator of deleted projects is the deleted user
+		projectUsers := utils.Map(func(_ int, projectUser types.ProjectUser) string { return projectUser.UserID }, project.Users)
+
+		wsServer.BroadcastToProject(project.ID, websocket.ProjectDeletedEvent, "project deleted", nil, projectUsers)
+	}
+
+	for _, project := range deleted.UpdatedProjects {
+		projectUsers := projectUserIDs(&project)
+
+		wsServer.BroadcastToProject(project.ID, websocket.ProjectUpdatedEvent, "project updated", project, projectUsers)
+	}
+}
+
 func (c *AuthController) getUser(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "id")
 
@@ -128,8 +573,9 @@ func (c *AuthController) updatePassword(w http.ResponseWriter, r *http.Request)
 	}
 
 	user := middleware.UserFromContext(r.Context())
+	client := utils.GetClientInfo(r)
 
-	busser, err := service.UpdateUserPassword(&user, &newPassword)
+	busser, err := service.UpdateUserPassword(&user, &newPassword, &client)
 	if err != nil {
 		utils.HandleError(w, err)
 		return
@@ -140,6 +586,126 @@ func (c *AuthController) updatePassword(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+func (c *AuthController) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	forgotPassword, ok := middleware.JsonFromContext(r.Context()).(types.ForgotPassword)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get forgot password from context")))
+		return
+	}
+
+	if err := service.ForgotPassword(&forgotPassword); err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err := utils.MarshalBody(w, http.StatusOK, utils.OkResponse{Message: "if the account exists, a reset link was sent"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+}
+
+func (c *AuthController) resetPassword(w http.ResponseWriter, r *http.Request) {
+	resetPassword, ok := middleware.JsonFromContext(r.Context()).(types.ResetPassword)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get reset password from context")))
+		return
+	}
+
+	client := utils.GetClientInfo(r)
+
+	user, err := service.ResetPassword(&resetPassword, &client)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, user); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+	}
+}
+
+func (c *AuthController) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	verifyEmail, ok := middleware.JsonFromContext(r.Context()).(types.VerifyEmail)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get verify email from context")))
+		return
+	}
+
+	user, joinedProjects, err := service.VerifyEmail(&verifyEmail)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, user); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+		return
+	}
+
+	c.broadcastJoinedProjects(joinedProjects)
+}
+
+func (c *AuthController) requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	changeEmail, ok := middleware.JsonFromContext(r.Context()).(types.ChangeEmail)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get change email from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	sessionID := middleware.SessionIDFromContext(r.Context())
+
+	if err := service.RequestEmailChange(&user, &sessionID, &changeEmail); err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err := utils.MarshalBody(w, http.StatusAccepted, utils.OkResponse{Message: "confirmation link sent to the new email"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+}
+
+func (c *AuthController) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	confirm, ok := middleware.JsonFromContext(r.Context()).(types.ConfirmEmailChange)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get confirm email change from context")))
+		return
+	}
+
+	client := utils.GetClientInfo(r)
+
+	changed, err := service.ConfirmEmailChange(&confirm, &client)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	c.WSServer.CloseSessions(changed.User.ID, changed.RevokedSessionIDs...)
+
+	if err = utils.MarshalBody(w, http.StatusOK, changed.User); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal user"))
+		return
+	}
+
+	c.broadcastJoinedProjects(changed.JoinedProjects)
+}
+
+func (c *AuthController) resendVerification(w http.ResponseWriter, r *http.Request) {
+	resend, ok := middleware.JsonFromContext(r.Context()).(types.ResendVerification)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get resend verification from context")))
+		return
+	}
+
+	if err := service.ResendVerification(&resend); err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err := utils.MarshalBody(w, http.StatusOK, utils.OkResponse{Message: "if the account exists and is not verified, a verification link was sent"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+}
+
 func (c *AuthController) refreshToken(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("refresh_token")
 	if err != nil {
@@ -147,22 +713,208 @@ func (c *AuthController) refreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	auth, err := service.RefreshToken(&cookie.Value)
+	client := utils.GetClientInfo(r)
+
+	auth, err := service.RefreshToken(&cookie.Value, &client)
 
 	if err != nil {
 		utils.HandleError(w, err)
 		return
 	}
 
-	utils.SetTokenCookie(w, "access_token", auth.TokenPair.AccessToken, auth.TokenPair.AccessTokenExpiry)
-	utils.SetTokenCookie(w, "refresh_token", auth.TokenPair.RefreshToken, auth.TokenPair.RefreshTokenExpiry)
+	// CSRF middleware verified the token, other tabs of the session keep using it. Sessions without one get it now
+	var csrfToken string
+	if csrfCookie, err := r.Cookie(utils.CSRFCookieName); err == nil {
+		csrfToken = csrfCookie.Value
+	}
+
+	if err = setTokenCookies(w, &auth.TokenPair, csrfToken); err != nil {
+		utils.HandleError(w, utils.NewInternalError(err))
+		return
+	}
 
 	if err = utils.MarshalBody(w, http.StatusOK, auth.User); err != nil {
 		utils.HandleError(w, errors.New("Failed to marshal user"))
 	}
 }
 
+func (c *AuthController) getSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+	sessionID := middleware.SessionIDFromContext(r.Context())
+
+	sessions, err := service.GetSessions(&user.ID, &sessionID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, sessions); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal sessions"))
+	}
+}
+
+func (c *AuthController) revokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "session_id")
+	if sessionID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("session id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	client := utils.GetClientInfo(r)
+
+	if err := service.RevokeSession(&user.ID, &sessionID, &client); err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	c.WSServer.CloseSessions(user.ID, sessionID)
+
+	if err := utils.MarshalBody(w, http.StatusOK, utils.OkResponse{Message: "session revoked"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+}
+
+func (c *AuthController) revokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+	currentSessionID := middleware.SessionIDFromContext(r.Context())
+	client := utils.GetClientInfo(r)
+
+	sessionIDs, err := service.RevokeOtherSessions(&user.ID, &currentSessionID, &client)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	c.WSServer.CloseSessions(user.ID, sessionIDs...)
+
+	if err = utils.MarshalBody(w, http.StatusOK, utils.OkResponse{Message: "other sessions revoked"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+}
+
+func (c *AuthController) getPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+
+	accessTokens, err := service.GetPersonalAccessTokens(&user.ID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, accessTokens); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal access tokens"))
+	}
+}
+
+func (c *AuthController) createPersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	create, ok := middleware.JsonFromContext(r.Context()).(types.CreatePersonalAccessToken)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get create access token from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	accessToken, err := service.CreatePersonalAccessToken(&user.ID, &create)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusCreated, accessToken); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal access token"))
+	}
+}
+
+func (c *AuthController) revokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	tokenID := chi.URLParam(r, "token_id")
+	if tokenID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("token id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	client := utils.GetClientInfo(r)
+
+	if err := service.RevokePersonalAccessToken(&user.ID, &tokenID, &client); err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err := utils.MarshalBody(w, http.StatusOK, utils.OkResponse{Message: "access token revoked"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+}
+
+func (c *AuthController) getAuthEvents(w http.ResponseWriter, r *http.Request) {
+	query, ok := middleware.QueryFromContext(r.Context()).(types.AuthEventQuery)
+
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get auth event query from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	page, err := service.GetOwnAuthEvents(&user.ID, &query)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, page); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal auth events"))
+	}
+}
+
 func (c *AuthController) logout(w http.ResponseWriter, r *http.Request) {
+	var accessToken, refreshToken string
+	if cookie, err := r.Cookie("access_token"); err == nil {
+		accessToken = cookie.Value
+	}
+	if cookie, err := r.Cookie("refresh_token"); err == nil {
+		refreshToken = cookie.Value
+	}
+
+	client := utils.GetClientInfo(r)
+
+	userID, sessionID, err := service.Logout(&accessToken, &refreshToken, &client)
+
+	clearTokenCookies(w)
+
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if sessionID != "" {
+		c.WSServer.CloseSessions(userID, sessionID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// setTokenCookies sets cookies of the token pair along with CSRF token cookie, which lives as long as the refresh
+// token. New CSRF token is generated when csrfToken is empty. It is sent in header as well, for frontends that
+// cannot read cookies of the api origin
+func setTokenCookies(w http.ResponseWriter, tokenPair *types.TokenPair, csrfToken string) error {
+	if csrfToken == "" {
+		var err error
+		if csrfToken, _, err = utils.GenerateToken(); err != nil {
+			return err
+		}
+	}
+
+	utils.SetTokenCookie(w, "access_token", tokenPair.AccessToken, tokenPair.AccessTokenExpiry)
+	utils.SetTokenCookie(w, "refresh_token", tokenPair.RefreshToken, tokenPair.RefreshTokenExpiry)
+	utils.SetCSRFCookie(w, csrfToken, tokenPair.RefreshTokenExpiry)
+	w.Header().Set(utils.CSRFHeaderName, csrfToken)
+
+	return nil
+}
+
+func clearTokenCookies(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "access_token",
 		Value:    "",
@@ -181,6 +933,12 @@ func (c *AuthController) logout(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteStrictMode,
 		Path:     "/",
 	})
-
-	w.WriteHeader(http.StatusOK)
+	http.SetCookie(w, &http.Cookie{
+		Name:     utils.CSRFCookieName,
+		Value:    "",
+		MaxAge:   -1,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	})
 }
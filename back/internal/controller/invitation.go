@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/finkabaj/squid/back/internal/middleware"
+	"github.com/finkabaj/squid/back/internal/service"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/finkabaj/squid/back/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+// notifyInvitees tells registered invitees about their invitations, the rest were invited by email
+func (c *KanbanController) notifyInvitees(invitations []types.ProjectInvitation) {
+	for _, invitation := range invitations {
+		if invitation.InviteeID != nil {
+			c.WSServer.BroadcastToUser(*invitation.InviteeID, websocket.ProjectInvitationCreatedEvent, "invited to project", invitation)
+		}
+	}
+}
+
+func (c *KanbanController) createInvitation(w http.ResponseWriter, r *http.Request) {
+	createInvitation, ok := middleware.JsonFromContext(r.Context()).(types.CreateProjectInvitation)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get invitation info from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	invitation, err := service.InviteToProject(&user, &createInvitation)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusCreated, invitation); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal invitation"))
+		return
+	}
+
+	c.notifyInvitees([]types.ProjectInvitation{invitation})
+}
+
+func (c *KanbanController) getProjectInvitations(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	invitations, err := service.GetProjectInvitations(&user.ID, &projectID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, invitations); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal invitations"))
+	}
+}
+
+func (c *KanbanController) revokeInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationID := chi.URLParam(r, "invitation_id")
+	if invitationID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("invitation id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	invitation, err := service.RevokeProjectInvitation(&user, &invitationID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, utils.OkResponse{Message: "invitation revoked succesfully"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+
+	if invitation.InviteeID != nil {
+		c.WSServer.BroadcastToUser(*invitation.InviteeID, websocket.ProjectInvitationRevokedEvent, "invitation revoked", invitation)
+	}
+}
+
+func (c *KanbanController) getReceivedInvitations(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+
+	invitations, err := service.GetReceivedInvitations(&user)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, invitations); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal invitations"))
+	}
+}
+
+func (c *KanbanController) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationID := chi.URLParam(r, "invitation_id")
+	if invitationID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("invitation id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	_, project, err := service.AcceptProjectInvitation(&user, &invitationID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, project); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal project"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectUpdatedEvent, "project updated", project, projectUsers)
+}
+
+func (c *KanbanController) declineInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationID := chi.URLParam(r, "invitation_id")
+	if invitationID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("invitation id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	invitation, err := service.DeclineProjectInvitation(&user, &invitationID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, invitation); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal invitation"))
+		return
+	}
+
+	c.WSServer.BroadcastToUser(invitation.InviterID, websocket.ProjectInvitationDeclinedEvent, "invitation declined", invitation)
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/pkg/errors"
 
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/finkabaj/squid/back/internal/middleware"
 	"github.com/finkabaj/squid/back/internal/types"
@@ -31,14 +33,41 @@ func (c *KanbanController) RegisterKanbanRoutes(r *chi.Mux) {
 	}
 
 	r.Route("/kanban", func(r chi.Router) {
-		r.Use(middleware.ValidateJWT)
+		r.Use(middleware.CSRF, middleware.ValidateJWT)
 
 		r.With(middleware.ValidateJson[types.CreateProject]()).Post("/project", c.createProject)
 		r.Get("/project/{project_id}", c.getProject)
 		r.With(middleware.ValidateJson[types.UpdateProject]()).Patch("/project/{project_id}", c.updateProject)
 		r.Delete("/project/{project_id}", c.deleteProject)
-		r.Get("/projects", c.getProjects)
+		r.With(middleware.ValidateQuery(decodeProjectsQuery)).Get("/projects", c.getProjects)
 		r.Get("/project/users/{project_id}", c.getProjectUsers)
+		r.With(middleware.ValidateJson[types.UpdateProjectRole]()).Patch("/project/role/{project_id}", c.updateProjectRole)
+		r.Post("/project/leave/{project_id}", c.leaveProject)
+		r.Post("/project/archive/{project_id}", c.archiveProject)
+		r.Post("/project/unarchive/{project_id}", c.unarchiveProject)
+
+		r.Get("/projects/trash", c.getTrashedProjects)
+		r.Post("/project/restore/{project_id}", c.restoreProject)
+		r.Get("/project/trash/{project_id}", c.getProjectTrash)
+		r.Post("/column/restore/{column_id}", c.restoreColumn)
+		r.Post("/row/restore/{row_id}", c.restoreRow)
+
+		r.With(middleware.ValidateJson[types.CloneProject]()).Post("/project/clone/{project_id}", c.cloneProject)
+		r.With(middleware.ValidateJson[types.CloneProject]()).Post("/project/template/{project_id}", c.saveProjectAsTemplate)
+		r.Get("/templates", c.getTemplates)
+
+		r.With(middleware.ValidateJson[types.CreateOwnershipTransfer]()).Post("/project/transfer/{project_id}", c.transferProject)
+		r.Delete("/project/transfer/{project_id}", c.cancelProjectTransfer)
+		r.Post("/project/transfer/accept/{transfer_id}", c.acceptProjectTransfer)
+		r.Post("/project/transfer/decline/{transfer_id}", c.declineProjectTransfer)
+		r.Get("/project/transfers", c.getReceivedTransfers)
+
+		r.With(middleware.ValidateJson[types.CreateProjectInvitation]()).Post("/invitation", c.createInvitation)
+		r.Delete("/invitation/{invitation_id}", c.revokeInvitation)
+		r.Post("/invitation/accept/{invitation_id}", c.acceptInvitation)
+		r.Post("/invitation/decline/{invitation_id}", c.declineInvitation)
+		r.Get("/invitations/{project_id}", c.getProjectInvitations)
+		r.Get("/invitations", c.getReceivedInvitations)
 
 		r.With(middleware.ValidateJson[types.CreateKanbanColumn]()).Post("/column", c.createColumn)
 		r.Get("/column/{column_id}", c.getColumn)
@@ -53,6 +82,7 @@ func (c *KanbanController) RegisterKanbanRoutes(r *chi.Mux) {
 
 		r.With(middleware.ValidateJson[types.CreateKanbanRow]()).Post("/row", c.createRow)
 		r.With(middleware.ValidateJson[types.UpdateKanbanRow]()).Patch("/row/{row_id}", c.updateRows)
+		r.With(middleware.ValidateJson[types.MoveKanbanRow]()).Patch("/row/move/{row_id}", c.moveRow)
 		r.Delete("/row/{row_id}", c.deleteRow)
 		r.Get("/rows/{column_id}", c.getRows)
 
@@ -80,13 +110,36 @@ func (c *KanbanController) RegisterKanbanRoutes(r *chi.Mux) {
 	kanbanControllerInitialized = true
 }
 
+// projectUserIDs returns ids of everyone in the project, creator included
+func projectUserIDs(project *types.Project) []string {
+	userIDs := utils.Map(func(_ int, projectUser types.ProjectUser) string { return projectUser.UserID }, project.Users)
+
+	return append(userIDs, project.CreatorID)
+}
+
+// decodeProjectsQuery lists archived projects with archived=true
+func decodeProjectsQuery(q string) types.ProjectsQuery {
+	values, _ := url.ParseQuery(q)
+
+	archived, _ := strconv.ParseBool(values.Get("archived"))
+
+	return types.ProjectsQuery{Archived: archived}
+}
+
 func (c *KanbanController) getProjects(w http.ResponseWriter, r *http.Request) {
+	query, ok := middleware.QueryFromContext(r.Context()).(types.ProjectsQuery)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get query from context")))
+		return
+	}
+
 	user := middleware.UserFromContext(r.Context())
 
-	projects, err := service.GetProjects(&user.ID)
+	projects, err := service.GetProjects(&user.ID, &query)
 
 	if err != nil {
 		utils.HandleError(w, err)
+		return
 	}
 
 	if err = utils.MarshalBody(w, http.StatusOK, projects); err != nil {
@@ -125,7 +178,7 @@ func (c *KanbanController) createProject(w http.ResponseWriter, r *http.Request)
 
 	user := middleware.UserFromContext(r.Context())
 
-	newProject, err := service.CreateProject(&user, &projectData)
+	newProject, invitations, err := service.CreateProject(&user, &projectData)
 	if err != nil {
 		utils.HandleError(w, err)
 		return
@@ -136,10 +189,10 @@ func (c *KanbanController) createProject(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	projectUsers := append(newProject.AdminIDs, newProject.MembersIDs...)
-	projectUsers = append(projectUsers, newProject.CreatorID)
+	projectUsers := projectUserIDs(&newProject)
 
 	c.WSServer.BroadcastToProject(newProject.ID, websocket.ProjectCreatedEvent, "project created", newProject, projectUsers)
+	c.notifyInvitees(invitations)
 }
 
 func (c *KanbanController) getProject(w http.ResponseWriter, r *http.Request) {
@@ -179,7 +232,7 @@ func (c *KanbanController) updateProject(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	project, err := service.UpdateProject(&projectID, &user, &updateProject)
+	project, invitations, err := service.UpdateProject(&projectID, &user, &updateProject)
 
 	if err != nil {
 		utils.HandleError(w, err)
@@ -190,8 +243,38 @@ func (c *KanbanController) updateProject(w http.ResponseWriter, r *http.Request)
 		utils.HandleError(w, errors.New("Failed to marshal project"))
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectUpdatedEvent, "project updated", project, projectUsers)
+	c.notifyInvitees(invitations)
+}
+
+func (c *KanbanController) updateProjectRole(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	updateRole, ok := middleware.JsonFromContext(r.Context()).(types.UpdateProjectRole)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("error getting updateRole from context")))
+		return
+	}
+
+	project, err := service.UpdateProjectRole(&user, &projectID, &updateRole)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, project); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal project"))
+	}
+
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectUpdatedEvent, "project updated", project, projectUsers)
 }
@@ -216,8 +299,7 @@ func (c *KanbanController) deleteProject(w http.ResponseWriter, r *http.Request)
 		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectDeletedEvent, "project deleted", nil, projectUsers)
 }
@@ -245,8 +327,7 @@ func (c *KanbanController) createColumn(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(
 		newColumn.ProjectID,
@@ -309,8 +390,7 @@ func (c *KanbanController) updateColumn(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanColumnUpdatedEvent, "kanban column updated", map[string]any{
 		"updated_column": column,
@@ -338,8 +418,7 @@ func (c *KanbanController) deleteColumn(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanColumnDeletedEvent, "kanban column deleted", columns, projectUsers)
 }
@@ -385,8 +464,7 @@ func (c *KanbanController) createColumnLabel(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanColumnLabelCreatedEvent, "kanban column label created", label, projectUsers)
 }
@@ -411,8 +489,7 @@ func (c *KanbanController) deleteColumnLabel(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanColumnLabelDeletedEvent, "kanban column label deleted", nil, projectUsers)
 }
@@ -443,8 +520,7 @@ func (c *KanbanController) updateColumnLabel(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanColumnLabelUpdatedEvent, "kanban column label updated", label, projectUsers)
 }
@@ -490,8 +566,7 @@ func (c *KanbanController) createRow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(
 		project.ID,
@@ -531,8 +606,7 @@ func (c *KanbanController) updateRows(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(
 		project.ID,
@@ -546,6 +620,43 @@ func (c *KanbanController) updateRows(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+func (c *KanbanController) moveRow(w http.ResponseWriter, r *http.Request) {
+	moveRow, ok := middleware.JsonFromContext(r.Context()).(types.MoveKanbanRow)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get moveRow from context")))
+		return
+	}
+
+	rowID := chi.URLParam(r, "row_id")
+	if rowID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("row id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	row, sourceRows, targetRows, project, err := service.MoveRow(&user.ID, &rowID, &moveRow)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	payload := map[string]any{
+		"moved_row":   row,
+		"source_rows": sourceRows,
+		"target_rows": targetRows,
+	}
+
+	if err := utils.MarshalBody(w, http.StatusOK, payload); err != nil {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to marshal row")))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanRowMovedEvent, "kanban row moved", payload, projectUsers)
+}
+
 func (c *KanbanController) deleteRow(w http.ResponseWriter, r *http.Request) {
 	user := middleware.UserFromContext(r.Context())
 
@@ -566,8 +677,7 @@ func (c *KanbanController) deleteRow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanRowDeletedEvent, "kanban row deleted", rows, projectUsers)
 }
@@ -613,8 +723,7 @@ func (c *KanbanController) createRowLabel(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanRowLabelCreatedEvent, "kanban row label created", label, projectUsers)
 }
@@ -639,8 +748,7 @@ func (c *KanbanController) deleteRowLabel(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanRowLabelDeletedEvent, "kanban row label deleted", nil, projectUsers)
 }
@@ -671,8 +779,7 @@ func (c *KanbanController) updateRowLabel(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanRowLabelUpdatedEvent, "kanban row label updated", label, projectUsers)
 }
@@ -718,8 +825,7 @@ func (c *KanbanController) createChecklist(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanChecklistCreatedEvent, "checklist created", checklist, projectUsers)
 }
@@ -744,8 +850,7 @@ func (c *KanbanController) deleteChecklist(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanChecklistDeletedEvent, "checklist deleted", nil, projectUsers)
 }
@@ -770,8 +875,7 @@ func (c *KanbanController) createPoint(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanPointCreatedEvent, "point created", point, projectUsers)
 }
@@ -802,8 +906,7 @@ func (c *KanbanController) updatePoint(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanPointUpdatedEvent, "point updated", point, projectUsers)
 }
@@ -828,8 +931,7 @@ func (c *KanbanController) updatePointStatus(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanPointUpdatedEvent, "point updated", point, projectUsers)
 }
@@ -854,8 +956,7 @@ func (c *KanbanController) deletePoint(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanPointDeletedEvent, "point deleted", nil, projectUsers)
 }
@@ -901,8 +1002,7 @@ func (c *KanbanController) updateCanComment(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanCanCommentEvent, "can comment updated", canComment, projectUsers)
 }
@@ -927,8 +1027,7 @@ func (c *KanbanController) createComment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanCommentCreatedEvent, "comment created", comment, projectUsers)
 }
@@ -953,8 +1052,7 @@ func (c *KanbanController) deleteComment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	projectUsers := append(project.AdminIDs, project.MembersIDs...)
-	projectUsers = append(projectUsers, project.CreatorID)
+	projectUsers := projectUserIDs(&project)
 
 	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanCommendDeletedEvent, "comment deleted", nil, projectUsers)
 }
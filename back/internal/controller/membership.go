@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/finkabaj/squid/back/internal/middleware"
+	"github.com/finkabaj/squid/back/internal/service"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/finkabaj/squid/back/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+func (c *KanbanController) transferProject(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	createTransfer, ok := middleware.JsonFromContext(r.Context()).(types.CreateOwnershipTransfer)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get transfer info from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	transfer, err := service.TransferProject(&user, &projectID, &createTransfer)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusCreated, transfer); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal transfer"))
+		return
+	}
+
+	c.WSServer.BroadcastToUser(transfer.ToUserID, websocket.ProjectTransferCreatedEvent, "project transfer requested", transfer)
+}
+
+func (c *KanbanController) cancelProjectTransfer(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	transfer, err := service.CancelProjectTransfer(&user, &projectID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, utils.OkResponse{Message: "transfer cancelled succesfully"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+
+	c.WSServer.BroadcastToUser(transfer.ToUserID, websocket.ProjectTransferCancelledEvent, "project transfer cancelled", transfer)
+}
+
+func (c *KanbanController) getReceivedTransfers(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+
+	transfers, err := service.GetReceivedTransfers(&user)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, transfers); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal transfers"))
+	}
+}
+
+func (c *KanbanController) acceptProjectTransfer(w http.ResponseWriter, r *http.Request) {
+	transferID := chi.URLParam(r, "transfer_id")
+	if transferID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("transfer id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	_, project, err := service.AcceptProjectTransfer(&user, &transferID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, project); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal project"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectUpdatedEvent, "project updated", project, projectUsers)
+}
+
+func (c *KanbanController) declineProjectTransfer(w http.ResponseWriter, r *http.Request) {
+	transferID := chi.URLParam(r, "transfer_id")
+	if transferID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("transfer id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	transfer, err := service.DeclineProjectTransfer(&user, &transferID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, transfer); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal transfer"))
+		return
+	}
+
+	c.WSServer.BroadcastToUser(transfer.FromUserID, websocket.ProjectTransferDeclinedEvent, "project transfer declined", transfer)
+}
+
+func (c *KanbanController) leaveProject(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	left, err := service.LeaveProject(&user, &projectID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, utils.OkResponse{Message: "project left succesfully"}); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal OkResponse"))
+	}
+
+	projectUsers := projectUserIDs(&left.Project)
+
+	c.WSServer.BroadcastToProject(left.Project.ID, websocket.ProjectUpdatedEvent, "project updated", left.Project, projectUsers)
+
+	for _, row := range left.UpdatedRows {
+		c.WSServer.BroadcastToProject(left.Project.ID, websocket.KanbanRowUpdatedEvent, "kanban row updated", map[string]any{"updated_row": row}, projectUsers)
+	}
+
+	// other sessions of the user drop the project
+	c.WSServer.BroadcastToUser(user.ID, websocket.ProjectLeftEvent, "project left", left.Project.ID)
+}
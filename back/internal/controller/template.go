@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/finkabaj/squid/back/internal/middleware"
+	"github.com/finkabaj/squid/back/internal/service"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/finkabaj/squid/back/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+func (c *KanbanController) cloneProject(w http.ResponseWriter, r *http.Request) {
+	c.copyProject(w, r, service.CloneProject)
+}
+
+func (c *KanbanController) saveProjectAsTemplate(w http.ResponseWriter, r *http.Request) {
+	c.copyProject(w, r, service.SaveProjectAsTemplate)
+}
+
+// copyProject creates project or template with create, everyone in it is told about it and invited members
+// about their invitations
+func (c *KanbanController) copyProject(w http.ResponseWriter, r *http.Request, create func(*types.User, *string, *types.CloneProject) (types.Project, []types.ProjectInvitation, error)) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	clone, ok := middleware.JsonFromContext(r.Context()).(types.CloneProject)
+	if !ok {
+		utils.HandleError(w, utils.NewInternalError(errors.New("Failed to get clone info from context")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	newProject, invitations, err := create(&user, &projectID, &clone)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusCreated, newProject); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal project"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&newProject)
+
+	c.WSServer.BroadcastToProject(newProject.ID, websocket.ProjectCreatedEvent, "project created", newProject, projectUsers)
+	c.notifyInvitees(invitations)
+}
+
+func (c *KanbanController) getTemplates(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+
+	templates, err := service.GetTemplates(&user)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, templates); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal templates"))
+	}
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/finkabaj/squid/back/internal/middleware"
+	"github.com/finkabaj/squid/back/internal/service"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/finkabaj/squid/back/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+func (c *KanbanController) archiveProject(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	project, err := service.ArchiveProject(&user, &projectID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, project); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal project"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectArchivedEvent, "project archived", project, projectUsers)
+}
+
+func (c *KanbanController) unarchiveProject(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	project, err := service.UnarchiveProject(&user, &projectID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, project); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal project"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectUnarchivedEvent, "project unarchived", project, projectUsers)
+}
+
+func (c *KanbanController) getTrashedProjects(w http.ResponseWriter, r *http.Request) {
+	user := middleware.UserFromContext(r.Context())
+
+	projects, err := service.GetTrashedProjects(&user)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, projects); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal projects"))
+	}
+}
+
+func (c *KanbanController) restoreProject(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	project, err := service.RestoreProject(&user, &projectID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, project); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal project"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.ProjectRestoredEvent, "project restored", project, projectUsers)
+}
+
+func (c *KanbanController) getProjectTrash(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "project_id")
+	if projectID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("project id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	trash, err := service.GetProjectTrash(&user.ID, &projectID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, trash); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal trash"))
+	}
+}
+
+func (c *KanbanController) restoreColumn(w http.ResponseWriter, r *http.Request) {
+	columnID := chi.URLParam(r, "column_id")
+	if columnID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("column id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	column, columns, project, err := service.RestoreColumn(&user, &columnID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	restored := map[string]any{
+		"restored_column": column,
+		"columns":         columns,
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, restored); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal column"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanColumnRestoredEvent, "kanban column restored", restored, projectUsers)
+}
+
+func (c *KanbanController) restoreRow(w http.ResponseWriter, r *http.Request) {
+	rowID := chi.URLParam(r, "row_id")
+	if rowID == "" {
+		utils.HandleError(w, utils.NewBadRequestError(errors.New("row id is required")))
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+
+	row, rows, project, err := service.RestoreRow(&user.ID, &rowID)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	restored := map[string]any{
+		"restored_row": row,
+		"rows":         rows,
+	}
+
+	if err = utils.MarshalBody(w, http.StatusOK, restored); err != nil {
+		utils.HandleError(w, errors.New("Failed to marshal row"))
+		return
+	}
+
+	projectUsers := projectUserIDs(&project)
+
+	c.WSServer.BroadcastToProject(project.ID, websocket.KanbanRowRestoredEvent, "kanban row restored", restored, projectUsers)
+}
@@ -0,0 +1,146 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/pkg/errors"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users. Implementations must be safe for concurrent use
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var Default Mailer
+var mailerInitialized bool
+
+// InitMailer Initializes Default mailer based on config.Data.Mailer value ("smtp", "file" or "log"). The mailer
+// has to be chosen explicitly, log is only accepted in development
+func InitMailer() error {
+	if mailerInitialized {
+		return nil
+	}
+
+	switch config.Data.Mailer {
+	case "smtp":
+		Default = NewSMTPMailer(config.Data.SMTPHost, config.Data.SMTPPort, config.Data.SMTPUsername, config.Data.SMTPPassword, config.Data.MailFrom)
+	case "file":
+		fs, err := os.OpenFile(config.Data.MailFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return errors.Wrapf(err, "error opening mail file %s", config.Data.MailFile)
+		}
+		Default = NewFileMailer(fs)
+	case "log":
+		if config.Data.Env != "development" {
+			return errors.New("log mailer is only allowed in development")
+		}
+		Default = LogMailer{}
+	case "":
+		return errors.New("MAILER must be set to smtp, file or log")
+	default:
+		return errors.Errorf("unknown mailer: %s", config.Data.Mailer)
+	}
+
+	mailerInitialized = true
+
+	return nil
+}
+
+func Send(ctx context.Context, msg Message) error {
+	if Default == nil {
+		return errors.New("mailer is not initialized")
+	}
+
+	return Default.Send(ctx, msg)
+}
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, formatMessage(m.from, msg))
+	}()
+
+	select {
+	case err := <-done:
+		return errors.Wrap(err, "error sending mail")
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "error sending mail")
+	}
+}
+
+// FileMailer writes every message to w instead of delivering it. Intended for development and tests
+type FileMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewFileMailer(w io.Writer) *FileMailer {
+	return &FileMailer{w: w}
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "Date: %s\r\n%s\r\n", time.Now().Format(time.RFC1123Z), formatMessage(config.Data.MailFrom, msg))
+	return errors.Wrap(err, "error writing mail")
+}
+
+// LogMailer logs recipient and subject of every message instead of delivering it. Bodies carry links that sign
+// people in or take over their accounts, so they are never logged, use FileMailer to read them
+type LogMailer struct{}
+
+func (LogMailer) Send(_ context.Context, msg Message) error {
+	logger.Logger.Info().Str("to", msg.To).Str("subject", msg.Subject).Msg("Mail not sent, log mailer is used")
+	return nil
+}
+
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
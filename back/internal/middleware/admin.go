@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/pkg/errors"
+)
+
+// RequireAdmin lets through system administrators only. It has to run after ValidateJWT or ValidateSession
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !UserFromContext(r.Context()).IsAdmin {
+			utils.HandleError(w, utils.AppError{
+				Type: utils.ErrorType{
+					Status:  http.StatusForbidden,
+					Message: "Admin access required",
+				},
+				OriginalError: errors.New("user is not an admin"),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
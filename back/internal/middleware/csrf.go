@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/pkg/errors"
+)
+
+// CSRF guards state-changing requests authenticated with cookies by double submit: the X-CSRF-Token header
+// has to repeat the csrf_token cookie issued along with token cookies, which other sites cannot read.
+// Requests with Authorization: Bearer header are not sent by browsers on their own and are let through
+func CSRF(next http.Handler) http.Handler {
+	return csrf(next, false)
+}
+
+// CSRFIfIssued is CSRF that lets requests without csrf_token cookie through, for refresh to issue the cookie to
+// sessions that started before CSRF tokens were. Refreshing does not act on behalf of the user, tokens it sets
+// are only readable by the site
+func CSRFIfIssued(next http.Handler) http.Handler {
+	return csrf(next, true)
+}
+
+func csrf(next http.Handler, allowMissing bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get(utils.CSRFHeaderName)
+		cookie, err := r.Cookie(utils.CSRFCookieName)
+
+		if allowMissing && (err != nil || cookie.Value == "") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+			utils.HandleError(w, utils.AppError{
+				Type: utils.ErrorType{
+					Status:  http.StatusForbidden,
+					Message: "Invalid CSRF token",
+				},
+				OriginalError: errors.New("csrf header does not match csrf cookie"),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
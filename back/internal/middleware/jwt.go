@@ -2,12 +2,14 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
 	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/revocation"
+	"github.com/finkabaj/squid/back/internal/signing"
 	"github.com/finkabaj/squid/back/internal/types"
 	"github.com/finkabaj/squid/back/internal/utils"
 	"github.com/golang-jwt/jwt/v5"
@@ -16,8 +18,34 @@ import (
 
 type ValidateJWTCtxKey struct{}
 
+type sessionIDCtxKey struct{}
+
+type accessTokenCtxKey struct{}
+
+// ValidateJWT authenticates the request by access token cookie or by personal access token
+// sent as Authorization: Bearer header
 func ValidateJWT(next http.Handler) http.Handler {
+	return validateJWT(next, true)
+}
+
+// ValidateSession is ValidateJWT that accepts only access token cookie. It guards endpoints managing
+// credentials, so a leaked personal access token cannot be used to take over the account
+func ValidateSession(next http.Handler) http.Handler {
+	return validateJWT(next, false)
+}
+
+func validateJWT(next http.Handler, allowAccessTokens bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			if !allowAccessTokens {
+				utils.HandleError(w, utils.NewUnauthorizedError(errors.New("personal access tokens are not accepted here")))
+				return
+			}
+
+			validateAccessToken(w, r, next, bearer)
+			return
+		}
+
 		cookie, err := r.Cookie("access_token")
 		if err != nil {
 			utils.HandleError(w, utils.NewUnauthorizedError(errors.New("No access token cookie")))
@@ -26,13 +54,7 @@ func ValidateJWT(next http.Handler) http.Handler {
 
 		tokenString := cookie.Value
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			return config.Data.JWTSecret, nil
-		})
+		token, err := signing.Default.Parse(tokenString)
 
 		if err != nil {
 			utils.HandleError(w, utils.NewUnauthorizedError(err))
@@ -60,6 +82,15 @@ func ValidateJWT(next http.Handler) http.Handler {
 			return
 		}
 
+		// tokens issued before revocation was introduced have no jti claim and expire soon
+		if jti, _ := claims["jti"].(string); jti != "" && revocation.Default.IsRevoked(jti) {
+			utils.HandleError(w, utils.NewUnauthorizedError(errors.New("token revoked")))
+			return
+		}
+
+		// tokens issued before sessions were introduced have no session_id claim
+		sessionID, _ := claims["session_id"].(string)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 		defer cancel()
 
@@ -70,11 +101,103 @@ func ValidateJWT(next http.Handler) http.Handler {
 			return
 		}
 
+		if user.DisabledAt != nil {
+			utils.HandleError(w, accountDisabled())
+			return
+		}
+
+		// sessions are ended by deleting their refresh tokens, which has to end their access tokens too
+		if sessionID != "" {
+			exists, err := repository.SessionExists(ctx, &userID, &sessionID)
+			if err != nil {
+				utils.HandleError(w, utils.NewInternalError(err))
+				return
+			}
+
+			if !exists {
+				utils.HandleError(w, utils.NewUnauthorizedError(errors.New("session ended")))
+				return
+			}
+		}
+
 		newCtx := context.WithValue(r.Context(), ValidateJWTCtxKey{}, user)
+		newCtx = context.WithValue(newCtx, sessionIDCtxKey{}, sessionID)
 		next.ServeHTTP(w, r.WithContext(newCtx))
 	})
 }
 
+func validateAccessToken(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	if !strings.HasPrefix(token, utils.PersonalAccessTokenPrefix) {
+		utils.HandleError(w, utils.NewUnauthorizedError(errors.New("invalid access token")))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tokenHash := utils.HashToken(token)
+
+	accessToken, err := repository.GetValidPersonalAccessToken(ctx, &tokenHash)
+	if err != nil {
+		utils.HandleError(w, utils.NewUnauthorizedError(errors.Wrap(err, "invalid or expired access token")))
+		return
+	}
+
+	if accessToken.Scope == types.AccessTokenScopeRead && r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
+		utils.HandleError(w, utils.AppError{
+			Type: utils.ErrorType{
+				Status:  http.StatusForbidden,
+				Message: "Access token is read-only",
+			},
+		})
+		return
+	}
+
+	user, err := repository.GetUser(ctx, &accessToken.UserID, nil)
+	if err != nil {
+		utils.HandleError(w, utils.NewUnauthorizedError(err))
+		return
+	}
+
+	if user.DisabledAt != nil {
+		utils.HandleError(w, accountDisabled())
+		return
+	}
+
+	if err = repository.TouchPersonalAccessToken(ctx, &accessToken.ID); err != nil {
+		logger.Logger.Error().Err(err).Str("token_id", accessToken.ID).Msg("Failed to update access token last usage")
+	}
+
+	newCtx := context.WithValue(r.Context(), ValidateJWTCtxKey{}, user)
+	newCtx = context.WithValue(newCtx, sessionIDCtxKey{}, "")
+	newCtx = context.WithValue(newCtx, accessTokenCtxKey{}, accessToken)
+	next.ServeHTTP(w, r.WithContext(newCtx))
+}
+
+func accountDisabled() utils.AppError {
+	return utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusForbidden,
+			Message: "Account is disabled",
+		},
+	}
+}
+
 func UserFromContext(ctx context.Context) types.User {
 	return ctx.Value(ValidateJWTCtxKey{}).(types.User)
 }
+
+func SessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDCtxKey{}).(string)
+	return sessionID
+}
+
+// AccessTokenFromContext returns personal access token the request was authenticated with, nil for browser sessions
+func AccessTokenFromContext(ctx context.Context) *types.PersonalAccessToken {
+	accessToken, ok := ctx.Value(accessTokenCtxKey{}).(types.PersonalAccessToken)
+	if !ok {
+		return nil
+	}
+
+	return &accessToken
+}
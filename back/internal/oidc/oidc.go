@@ -0,0 +1,344 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// Default is the provider configured in config, nil when single sign-on is disabled
+var Default *Provider
+
+// InitOIDC configures Default provider. Discovery is deferred to the first login,
+// so the server starts even when the provider is unreachable
+func InitOIDC() error {
+	if config.Data.OIDCIssuer == "" {
+		Default = nil
+		return nil
+	}
+
+	if config.Data.OIDCClientID == "" || config.Data.OIDCRedirectURL == "" {
+		return errors.New("oidc client id and redirect url are required when oidc issuer is set")
+	}
+
+	Default = NewProvider(
+		config.Data.OIDCIssuer,
+		config.Data.OIDCClientID,
+		config.Data.OIDCClientSecret,
+		config.Data.OIDCRedirectURL,
+		strings.Fields(config.Data.OIDCScopes),
+		&http.Client{Timeout: 10 * time.Second},
+	)
+
+	return nil
+}
+
+// jwksRefreshInterval limits how often unknown key ids trigger refetch of provider keys
+const jwksRefreshInterval = time.Minute
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the claims of verified ID token squid cares about
+type Claims struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	GivenName         string
+	FamilyName        string
+	PreferredUsername string
+	Birthdate         string
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+	PreferredUsername string `json:"preferred_username"`
+	Birthdate         string `json:"birthdate"`
+}
+
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func NewProvider(issuer, clientID, clientSecret, redirectURL string, scopes []string, client *http.Client) *Provider {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Provider{
+		issuer:       issuer,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		client:       client,
+	}
+}
+
+// GenerateVerifier returns PKCE code verifier and its S256 challenge
+func GenerateVerifier() (verifier string, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL returns the provider url the user agent has to be redirected to
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid authorization endpoint")
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange redeems authorization code and returns raw ID token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("client_id", p.clientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error requesting token endpoint")
+	}
+	defer resp.Body.Close()
+
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", errors.Wrapf(err, "error decoding token response with status %d", resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return "", errors.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+
+	if token.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+
+	return token.IDToken, nil
+}
+
+// VerifyIDToken checks signature, issuer, audience, expiry and nonce of the ID token
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	var claims idTokenClaims
+	_, err = jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, errors.Wrap(err, "invalid id token")
+	}
+
+	if claims.Nonce != nonce {
+		return Claims{}, errors.New("id token nonce mismatch")
+	}
+
+	if claims.Subject == "" {
+		return Claims{}, errors.New("id token has no subject")
+	}
+
+	// some providers send email_verified as a string
+	emailVerified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		emailVerified = v
+	case string:
+		emailVerified = v == "true"
+	}
+
+	return Claims{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     emailVerified,
+		GivenName:         claims.GivenName,
+		FamilyName:        claims.FamilyName,
+		PreferredUsername: claims.PreferredUsername,
+		Birthdate:         claims.Birthdate,
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return metadata{}, errors.Wrap(err, "error discovering oidc provider")
+	}
+
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.issuer, "/") {
+		return metadata{}, errors.Errorf("oidc issuer mismatch: expected %s, provider reports %s", p.issuer, meta.Issuer)
+	}
+
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return metadata{}, errors.New("oidc provider metadata is incomplete")
+	}
+
+	p.metadata = &meta
+
+	return meta, nil
+}
+
+// key returns verification key by id, refetching provider keys when the id is unknown
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+
+	var set jwkSet
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return nil, errors.Wrap(err, "error fetching oidc provider keys")
+	}
+
+	keys, err := set.publicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	return nil, errors.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) lookupKey(kid string) (any, bool) {
+	if kid != "" {
+		key, ok := p.keys[kid]
+		return key, ok
+	}
+
+	// tokens without kid are only accepted when the provider has a single key
+	if len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+
+	return errors.WithStack(json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v))
+}
@@ -0,0 +1,103 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idSaltLength = 16
+	argon2idKeyLength  = 32
+)
+
+// Argon2id hashes passwords into PHC string format, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+type Argon2id struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, argon2idKeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (a *Argon2id) Verify(password, hash string) (bool, error) {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), decoded.salt, decoded.iterations, decoded.memory, decoded.parallelism, uint32(len(decoded.key)))
+
+	return subtle.ConstantTimeCompare(key, decoded.key) == 1, nil
+}
+
+func (a *Argon2id) Outdated(hash string) bool {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return decoded.memory != a.Memory || decoded.iterations != a.Iterations || decoded.parallelism != a.Parallelism ||
+		len(decoded.salt) != argon2idSaltLength || len(decoded.key) != argon2idKeyLength
+}
+
+func decodeArgon2id(hash string) (argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2idHash{}, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return argon2idHash{}, errors.Wrap(err, "malformed argon2id version")
+	}
+
+	if version != argon2.Version {
+		return argon2idHash{}, errors.Errorf("unsupported argon2id version %d", version)
+	}
+
+	var decoded argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &decoded.memory, &decoded.iterations, &decoded.parallelism); err != nil {
+		return argon2idHash{}, errors.Wrap(err, "malformed argon2id parameters")
+	}
+
+	var err error
+	if decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2idHash{}, errors.Wrap(err, "malformed argon2id salt")
+	}
+
+	if decoded.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(decoded.key) == 0 {
+		return argon2idHash{}, errors.New("malformed argon2id key")
+	}
+
+	return decoded, nil
+}
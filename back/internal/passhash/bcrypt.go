@@ -0,0 +1,52 @@
+package passhash
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptMaxLength is the number of bytes bcrypt uses, the rest of longer passwords would be ignored
+const bcryptMaxLength = 72
+
+// Bcrypt hashes passwords with bcrypt. Passwords longer than 72 bytes are rejected with ErrTooLong
+type Bcrypt struct {
+	Cost int
+}
+
+func (b *Bcrypt) Hash(password string) (string, error) {
+	if len(password) > bcryptMaxLength {
+		return "", ErrTooLong
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return string(hash), nil
+}
+
+func (b *Bcrypt) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b *Bcrypt) Verify(password, hash string) (bool, error) {
+	// longer passwords could not have been hashed, bcrypt.CompareHashAndPassword would fail on them as well
+	if len(password) > bcryptMaxLength {
+		return false, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (b *Bcrypt) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.Cost
+}
@@ -0,0 +1,103 @@
+package passhash
+
+import (
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// ErrTooLong is returned by hashers that cannot hash the whole password instead of silently truncating it
+var ErrTooLong = errors.New("password is too long")
+
+// Hasher is a password hashing algorithm. Its hashes are self-describing: they encode the algorithm,
+// its parameters and salt, so they can be verified after the parameters change
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Identifies reports whether the hash was produced by the algorithm of the hasher
+	Identifies(hash string) bool
+	// Verify reports whether the password matches the hash, it is called only for identified hashes
+	Verify(password, hash string) (bool, error)
+	// Outdated reports whether the hash was produced with other parameters than the current ones
+	Outdated(hash string) bool
+}
+
+// Passwords hashes new passwords with the preferred hasher and verifies hashes of any known one
+type Passwords struct {
+	preferred Hasher
+	known     []Hasher
+}
+
+var Default *Passwords
+
+func InitHasher() error {
+	argon2id := &Argon2id{
+		Memory:      uint32(config.Data.Argon2MemoryKiB),
+		Iterations:  uint32(config.Data.Argon2Iterations),
+		Parallelism: uint8(config.Data.Argon2Parallelism),
+	}
+	bcrypt := &Bcrypt{Cost: config.Data.SaltRounds}
+
+	var preferred Hasher
+	switch config.Data.PasswordHasher {
+	case AlgorithmArgon2id:
+		if argon2id.Memory < 8*uint32(argon2id.Parallelism) || argon2id.Iterations < 1 || argon2id.Parallelism < 1 {
+			return errors.New("argon2 memory, iterations and parallelism must be positive, memory at least 8 KiB per thread")
+		}
+		preferred = argon2id
+	case AlgorithmBcrypt:
+		preferred = bcrypt
+	default:
+		return errors.Errorf("unknown password hasher %q", config.Data.PasswordHasher)
+	}
+
+	Default = NewPasswords(preferred, argon2id, bcrypt)
+	return nil
+}
+
+// NewPasswords returns Passwords hashing with preferred, known lists other hashers whose hashes are still accepted
+func NewPasswords(preferred Hasher, known ...Hasher) *Passwords {
+	return &Passwords{
+		preferred: preferred,
+		known:     append([]Hasher{preferred}, known...),
+	}
+}
+
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.preferred.Hash(password)
+}
+
+// Verify reports whether the password matches the hash. Hashes of unknown algorithms never match
+func (p *Passwords) Verify(password, hash string) bool {
+	hasher := p.identify(hash)
+	if hasher == nil {
+		return false
+	}
+
+	ok, err := hasher.Verify(password, hash)
+	return err == nil && ok
+}
+
+// NeedsRehash reports whether the hash should be replaced by hash of the preferred hasher with current parameters.
+// It is the case for hashes of other algorithms, or produced with other parameters
+func (p *Passwords) NeedsRehash(hash string) bool {
+	hasher := p.identify(hash)
+	if hasher == nil {
+		return false
+	}
+
+	return hasher != p.preferred || hasher.Outdated(hash)
+}
+
+func (p *Passwords) identify(hash string) Hasher {
+	for _, hasher := range p.known {
+		if hasher.Identifies(hash) {
+			return hasher
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// Package policy decides what users are allowed to do in projects. Resources are resolved to the project they
+// belong to along with role of the user in it, the decision itself only depends on the role, the permission and
+// whether the project is archived
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// getProjectAccess is repository.GetProjectAccess, tests replace it to authorize without database
+var getProjectAccess = repository.GetProjectAccess
+
+// Forbidden is returned to participants of the project that are not allowed to do what they asked for
+func Forbidden(err error) utils.AppError {
+	return utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusForbidden,
+			Message: "Forbidden",
+		},
+		OriginalError: err,
+	}
+}
+
+// Allowed reports whether the role grants the permission, nobody is allowed anything without a role
+func Allowed(role types.ProjectRole, permission types.ProjectPermission) bool {
+	return slices.Contains(types.ProjectRolePermissions[role], permission)
+}
+
+// AllowedWhenArchived reports whether the permission can be used in archived projects
+func AllowedWhenArchived(permission types.ProjectPermission) bool {
+	return slices.Contains(types.ArchivedProjectPermissions, permission)
+}
+
+// Check decides whether the access grants the permission. Users that are not part of the project get not found,
+// so that they cannot tell which resources exist, participants lacking the permission get forbidden
+func Check(access *types.ProjectAccess, resource types.ProjectResource, resourceID string, permission types.ProjectPermission) error {
+	if access.Role == "" {
+		return utils.NewNotFoundError(errors.New(fmt.Sprintf("%s with id: %s not found", resource, resourceID)))
+	}
+
+	if !Allowed(access.Role, permission) {
+		return Forbidden(errors.New(fmt.Sprintf("%s role does not have %s permission", access.Role, permission)))
+	}
+
+	if access.Archived && !AllowedWhenArchived(permission) {
+		return Forbidden(errors.New("project is archived"))
+	}
+
+	return nil
+}
+
+// Authorize resolves the resource to its project and checks that the user has the permission in it.
+// Resources in trash are not found
+func Authorize(ctx context.Context, userID string, resource types.ProjectResource, resourceID string, permission types.ProjectPermission) (types.ProjectAccess, error) {
+	return authorize(ctx, userID, resource, resourceID, permission, false)
+}
+
+// AuthorizeTrashed is Authorize for resources in trash, resources that are not in trash are not found
+func AuthorizeTrashed(ctx context.Context, userID string, resource types.ProjectResource, resourceID string, permission types.ProjectPermission) (types.ProjectAccess, error) {
+	return authorize(ctx, userID, resource, resourceID, permission, true)
+}
+
+func authorize(ctx context.Context, userID string, resource types.ProjectResource, resourceID string, permission types.ProjectPermission, trashed bool) (types.ProjectAccess, error) {
+	access, err := getProjectAccess(ctx, resource, &resourceID, &userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return types.ProjectAccess{}, utils.NewInternalError(err)
+	}
+
+	if err != nil || access.Trashed != trashed {
+		if trashed {
+			return types.ProjectAccess{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("%s with id: %s not found in trash", resource, resourceID)))
+		}
+
+		return types.ProjectAccess{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("%s with id: %s not found", resource, resourceID)))
+	}
+
+	if err = Check(&access, resource, resourceID, permission); err != nil {
+		return types.ProjectAccess{}, err
+	}
+
+	return access, nil
+}
@@ -0,0 +1,262 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	roles = []types.ProjectRole{
+		types.ProjectRoleOwner,
+		types.ProjectRoleAdmin,
+		types.ProjectRoleMember,
+		types.ProjectRoleCommenter,
+		types.ProjectRoleViewer,
+	}
+
+	permissions = []types.ProjectPermission{
+		types.ProjectPermissionView,
+		types.ProjectPermissionComment,
+		types.ProjectPermissionEditRows,
+		types.ProjectPermissionManageBoard,
+		types.ProjectPermissionManageMembers,
+		types.ProjectPermissionDeleteProject,
+		types.ProjectPermissionTransferProject,
+		types.ProjectPermissionArchiveProject,
+	}
+)
+
+// allowed is the expected role matrix, written out instead of read from types.ProjectRolePermissions
+// so that changes to the roles have to be made in both places
+var allowed = map[types.ProjectRole]map[types.ProjectPermission]bool{
+	types.ProjectRoleOwner: {
+		types.ProjectPermissionView:            true,
+		types.ProjectPermissionComment:         true,
+		types.ProjectPermissionEditRows:        true,
+		types.ProjectPermissionManageBoard:     true,
+		types.ProjectPermissionManageMembers:   true,
+		types.ProjectPermissionDeleteProject:   true,
+		types.ProjectPermissionTransferProject: true,
+		types.ProjectPermissionArchiveProject:  true,
+	},
+	types.ProjectRoleAdmin: {
+		types.ProjectPermissionView:           true,
+		types.ProjectPermissionComment:        true,
+		types.ProjectPermissionEditRows:       true,
+		types.ProjectPermissionManageBoard:    true,
+		types.ProjectPermissionManageMembers:  true,
+		types.ProjectPermissionArchiveProject: true,
+	},
+	types.ProjectRoleMember: {
+		types.ProjectPermissionView:     true,
+		types.ProjectPermissionComment:  true,
+		types.ProjectPermissionEditRows: true,
+	},
+	types.ProjectRoleCommenter: {
+		types.ProjectPermissionView:    true,
+		types.ProjectPermissionComment: true,
+	},
+	types.ProjectRoleViewer: {
+		types.ProjectPermissionView: true,
+	},
+}
+
+var allowedWhenArchived = map[types.ProjectPermission]bool{
+	types.ProjectPermissionView:            true,
+	types.ProjectPermissionManageMembers:   true,
+	types.ProjectPermissionDeleteProject:   true,
+	types.ProjectPermissionTransferProject: true,
+	types.ProjectPermissionArchiveProject:  true,
+}
+
+func TestAllowed(t *testing.T) {
+	for _, role := range append(roles, "", "unknown") {
+		for _, permission := range permissions {
+			if got, want := Allowed(role, permission), allowed[role][permission]; got != want {
+				t.Errorf("Allowed(%q, %q) = %v, want %v", role, permission, got, want)
+			}
+		}
+	}
+}
+
+func TestAllowedWhenArchived(t *testing.T) {
+	for _, permission := range permissions {
+		if got, want := AllowedWhenArchived(permission), allowedWhenArchived[permission]; got != want {
+			t.Errorf("AllowedWhenArchived(%q) = %v, want %v", permission, got, want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	type testCase struct {
+		role       types.ProjectRole
+		permission types.ProjectPermission
+		archived   bool
+		// status is 0 when access is granted
+		status int
+	}
+
+	var cases []testCase
+	for _, archived := range []bool{false, true} {
+		for _, permission := range permissions {
+			cases = append(cases, testCase{role: "", permission: permission, archived: archived, status: http.StatusNotFound})
+
+			for _, role := range roles {
+				status := 0
+				if !allowed[role][permission] || (archived && !allowedWhenArchived[permission]) {
+					status = http.StatusForbidden
+				}
+
+				cases = append(cases, testCase{role: role, permission: permission, archived: archived, status: status})
+			}
+		}
+	}
+
+	for _, tc := range cases {
+		access := types.ProjectAccess{ProjectID: "project", CreatorID: "creator", Role: tc.role, Archived: tc.archived}
+
+		err := Check(&access, types.ProjectResourceProject, "project", tc.permission)
+
+		status := 0
+		if err != nil {
+			var appErr utils.AppError
+			if !errors.As(err, &appErr) {
+				t.Errorf("Check(%q, %q, archived=%v) returned %T, want utils.AppError", tc.role, tc.permission, tc.archived, err)
+				continue
+			}
+			status = appErr.Type.Status
+		}
+
+		if status != tc.status {
+			t.Errorf("Check(%q, %q, archived=%v) status = %d, want %d", tc.role, tc.permission, tc.archived, status, tc.status)
+		}
+	}
+}
+
+// status returns status of the error, 0 for nil and -1 for errors that are not utils.AppError
+func status(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var appErr utils.AppError
+	if !errors.As(err, &appErr) {
+		return -1
+	}
+
+	return appErr.Type.Status
+}
+
+func TestAuthorize(t *testing.T) {
+	const resourceID, userID = "row", "user"
+
+	cases := []struct {
+		name string
+		// access is what the lookup finds, nil when the resource does not exist
+		access     *types.ProjectAccess
+		lookupErr  error
+		permission types.ProjectPermission
+		// status and trashedStatus are returned by Authorize and AuthorizeTrashed, 0 when access is granted
+		status, trashedStatus int
+	}{
+		{
+			name:          "missing resource",
+			permission:    types.ProjectPermissionView,
+			status:        http.StatusNotFound,
+			trashedStatus: http.StatusNotFound,
+		},
+		{
+			name:          "lookup failure",
+			lookupErr:     errors.New("connection refused"),
+			permission:    types.ProjectPermissionView,
+			status:        http.StatusInternalServerError,
+			trashedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:          "not a member",
+			access:        &types.ProjectAccess{ProjectID: "project", CreatorID: "creator"},
+			permission:    types.ProjectPermissionView,
+			status:        http.StatusNotFound,
+			trashedStatus: http.StatusNotFound,
+		},
+		{
+			name:          "member with permission",
+			access:        &types.ProjectAccess{ProjectID: "project", CreatorID: "creator", Role: types.ProjectRoleMember},
+			permission:    types.ProjectPermissionEditRows,
+			status:        0,
+			trashedStatus: http.StatusNotFound,
+		},
+		{
+			name:          "member without permission",
+			access:        &types.ProjectAccess{ProjectID: "project", CreatorID: "creator", Role: types.ProjectRoleViewer},
+			permission:    types.ProjectPermissionEditRows,
+			status:        http.StatusForbidden,
+			trashedStatus: http.StatusNotFound,
+		},
+		{
+			name:          "trashed resource",
+			access:        &types.ProjectAccess{ProjectID: "project", CreatorID: "creator", Role: types.ProjectRoleMember, Trashed: true},
+			permission:    types.ProjectPermissionEditRows,
+			status:        http.StatusNotFound,
+			trashedStatus: 0,
+		},
+		{
+			name:          "trashed resource without permission",
+			access:        &types.ProjectAccess{ProjectID: "project", CreatorID: "creator", Role: types.ProjectRoleViewer, Trashed: true},
+			permission:    types.ProjectPermissionEditRows,
+			status:        http.StatusNotFound,
+			trashedStatus: http.StatusForbidden,
+		},
+		{
+			name:          "trashed resource of another project",
+			access:        &types.ProjectAccess{ProjectID: "project", CreatorID: "creator", Trashed: true},
+			permission:    types.ProjectPermissionView,
+			status:        http.StatusNotFound,
+			trashedStatus: http.StatusNotFound,
+		},
+	}
+
+	defer func(original func(context.Context, types.ProjectResource, *string, *string) (types.ProjectAccess, error)) {
+		getProjectAccess = original
+	}(getProjectAccess)
+
+	for _, tc := range cases {
+		getProjectAccess = func(ctx context.Context, resource types.ProjectResource, gotResourceID *string, gotUserID *string) (types.ProjectAccess, error) {
+			if *gotResourceID != resourceID || *gotUserID != userID {
+				t.Errorf("%s: lookup of %s %s for %s, want %s for %s", tc.name, resource, *gotResourceID, *gotUserID, resourceID, userID)
+			}
+
+			if tc.lookupErr != nil {
+				return types.ProjectAccess{}, tc.lookupErr
+			}
+
+			if tc.access == nil {
+				return types.ProjectAccess{}, pgx.ErrNoRows
+			}
+
+			return *tc.access, nil
+		}
+
+		ctx := context.Background()
+
+		access, err := Authorize(ctx, userID, types.ProjectResourceRow, resourceID, tc.permission)
+		if got := status(err); got != tc.status {
+			t.Errorf("%s: Authorize status = %d, want %d (%v)", tc.name, got, tc.status, err)
+		} else if err == nil && access != *tc.access {
+			t.Errorf("%s: Authorize = %+v, want %+v", tc.name, access, *tc.access)
+		}
+
+		access, err = AuthorizeTrashed(ctx, userID, types.ProjectResourceRow, resourceID, tc.permission)
+		if got := status(err); got != tc.trashedStatus {
+			t.Errorf("%s: AuthorizeTrashed status = %d, want %d (%v)", tc.name, got, tc.trashedStatus, err)
+		} else if err == nil && access != *tc.access {
+			t.Errorf("%s: AuthorizeTrashed = %+v, want %+v", tc.name, access, *tc.access)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/jackc/pgx/v5"
 	"github.com/pkg/errors"
 )
 
@@ -32,27 +33,159 @@ func GetUser(ctx context.Context, id *string, email *string) (types.User, error)
 	}
 }
 
+// UpdateUserAvatar sets avatar of the user, nil key and url remove it
+func UpdateUserAvatar(ctx context.Context, userID *string, key *string, url *string) (types.User, error) {
+	if userID == nil {
+		return types.User{}, errors.New("userID must not be nil")
+	}
+
+	return queryOneReturning[types.User](ctx, `
+        UPDATE "users" SET "avatarKey" = $2, "avatarURL" = $3 WHERE "id" = $1 RETURNING *
+    `, userID, key, url)
+}
+
 func DeleteUser(ctx context.Context, id *string) (err error) {
 	_, err = queryOneReturning[types.User](ctx, `DELETE FROM "users" WHERE "id" = $1`, id)
 
 	return
 }
 
-func CreateRefreshToken(ctx context.Context, id *string, userID *string, expiresAt *time.Time) (types.RefreshToken, error) {
-	if id == nil || userID == nil || expiresAt == nil {
-		return types.RefreshToken{}, errors.New("All arguments must be not nil")
+// DeleteAccount deletes the user in one transaction. Projects in transfers (project id to new owner id) are handed
+// over, projects in deleteProjectIDs are deleted and authored content is reassigned to types.DeletedUserID
+func DeleteAccount(ctx context.Context, userID *string, transfers map[string]string, deleteProjectIDs []string) error {
+	if userID == nil {
+		return errors.New("userID must not be nil")
+	}
+
+	_, err := withTx(ctx, func(tx pgx.Tx) (any, error) {
+		for projectID, newOwnerID := range transfers {
+			if _, err := tx.Exec(ctx, `UPDATE "projects" SET "creatorID" = $2 WHERE "id" = $1 AND "creatorID" = $3`, projectID, newOwnerID, userID); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			// creator is not listed among project users
+			if _, err := tx.Exec(ctx, `DELETE FROM "projectUsers" WHERE "projectID" = $1 AND "userID" = $2`, projectID, newOwnerID); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+
+		if len(deleteProjectIDs) > 0 {
+			if _, err := tx.Exec(ctx, `DELETE FROM "projects" WHERE "id" = ANY($1) AND "creatorID" = $2`, deleteProjectIDs, userID); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE "kanbanRows" SET "creatorID" = $2 WHERE "creatorID" = $1`, userID, types.DeletedUserID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE "historyPoints" SET "userID" = $2 WHERE "userID" = $1`, userID, types.DeletedUserID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE "comments" SET "userID" = $2 WHERE "userID" = $1`, userID, types.DeletedUserID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE "points" SET "completedBy" = $2 WHERE "completedBy" = $1`, userID, types.DeletedUserID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM "kanbanRowAssignees" WHERE "userID" = $1`, userID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// memberships, tokens and remaining owned projects cascade
+		tag, err := tx.Exec(ctx, `DELETE FROM "users" WHERE "id" = $1`, userID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return nil, pgx.ErrNoRows
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func CreateRefreshToken(ctx context.Context, refreshToken *types.RefreshToken) (types.RefreshToken, error) {
+	if refreshToken == nil {
+		return types.RefreshToken{}, errors.New("refreshToken must not be nil")
 	}
 
 	return queryOneReturning[types.RefreshToken](ctx, `
-        INSERT INTO "refreshTokens" ("id", "userID", "expiresAt")
-        VALUES ($1, $2, $3) 
+        INSERT INTO "refreshTokens" ("id", "userID", "expiresAt", "sessionID", "userAgent", "ip", "signedInAt")
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
         RETURNING *
-    `, id, userID, expiresAt)
+    `, refreshToken.ID, refreshToken.UserID, refreshToken.ExpiresAt, refreshToken.SessionID,
+		refreshToken.UserAgent, refreshToken.IP, refreshToken.SignedInAt)
 }
 
-func DeleteRefreshToken(ctx context.Context, userID *string) (err error) {
-	_, err = queryOneReturning[types.RefreshToken](ctx, `DELETE FROM "refreshTokens" WHERE "userID" = $1`, userID)
-	return
+// RotateRefreshToken marks the refresh token with oldID as rotated and creates newToken as its child.
+// Returns pgx.ErrNoRows if oldID does not exist or was already rotated
+func RotateRefreshToken(ctx context.Context, oldID *string, newToken *types.RefreshToken) (types.RefreshToken, error) {
+	if oldID == nil || newToken == nil {
+		return types.RefreshToken{}, errors.New("All arguments must be not nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.RefreshToken, error) {
+		tag, err := tx.Exec(ctx, `
+            UPDATE "refreshTokens" SET "rotatedAt" = CURRENT_TIMESTAMP
+            WHERE "id" = $1 AND "rotatedAt" IS NULL
+        `, oldID)
+		if err != nil {
+			return types.RefreshToken{}, errors.WithStack(err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return types.RefreshToken{}, pgx.ErrNoRows
+		}
+
+		return queryOneReturningTx[types.RefreshToken](ctx, tx, `
+            INSERT INTO "refreshTokens" ("id", "userID", "expiresAt", "sessionID", "userAgent", "ip", "signedInAt", "parentID")
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+            RETURNING *
+        `, newToken.ID, newToken.UserID, newToken.ExpiresAt, newToken.SessionID,
+			newToken.UserAgent, newToken.IP, newToken.SignedInAt, oldID)
+	})
+}
+
+func DeleteRefreshToken(ctx context.Context, id *string) error {
+	if id == nil {
+		return errors.New("id must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `DELETE FROM "refreshTokens" WHERE "id" = $1`, id)
+	return errors.WithStack(err)
+}
+
+// DeleteUserRefreshTokens revokes every session of the user
+func DeleteUserRefreshTokens(ctx context.Context, userID *string) error {
+	if userID == nil {
+		return errors.New("userID must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `DELETE FROM "refreshTokens" WHERE "userID" = $1`, userID)
+	return errors.WithStack(err)
+}
+
+func DeleteExpiredRefreshTokens(ctx context.Context, userID *string) error {
+	if userID == nil {
+		return errors.New("userID must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `DELETE FROM "refreshTokens" WHERE "userID" = $1 AND "expiresAt" < CURRENT_TIMESTAMP`, userID)
+	return errors.WithStack(err)
+}
+
+// PurgeRefreshTokens deletes expired refresh tokens of every user. Rotated tokens are kept until they expire as well,
+// presenting one before that revokes its session as stolen, afterwards it is rejected as expired anyway
+func PurgeRefreshTokens(ctx context.Context) error {
+	_, err := pool.Exec(ctx, `DELETE FROM "refreshTokens" WHERE "expiresAt" < CURRENT_TIMESTAMP`)
+	return errors.WithStack(err)
 }
 
 func GetRefreshToken(ctx context.Context, id *string) (types.RefreshToken, error) {
@@ -63,6 +196,103 @@ func GetRefreshToken(ctx context.Context, id *string) (types.RefreshToken, error
 	return queryOneReturning[types.RefreshToken](ctx, `SELECT * FROM "refreshTokens" WHERE "id" = $1`, id)
 }
 
+func GetSessions(ctx context.Context, userID *string) ([]types.RefreshToken, error) {
+	if userID == nil {
+		return nil, errors.New("userID must not be nil")
+	}
+
+	return queryReturning[types.RefreshToken](ctx, `
+        SELECT * FROM "refreshTokens"
+        WHERE "userID" = $1 AND "expiresAt" > CURRENT_TIMESTAMP AND "rotatedAt" IS NULL
+        ORDER BY "lastUsedAt" DESC
+    `, userID)
+}
+
+// GetSessionSignedInAt returns when the session of the user was signed in. Returns pgx.ErrNoRows when the session
+// does not exist or has expired
+func GetSessionSignedInAt(ctx context.Context, userID *string, sessionID *string) (time.Time, error) {
+	if userID == nil || sessionID == nil {
+		return time.Time{}, errors.New("userID and sessionID must not be nil")
+	}
+
+	var signedInAt time.Time
+	err := pool.QueryRow(ctx, `
+        SELECT "signedInAt" FROM "refreshTokens"
+        WHERE "userID" = $1 AND "sessionID" = $2 AND "expiresAt" > CURRENT_TIMESTAMP
+        LIMIT 1
+    `, userID, sessionID).Scan(&signedInAt)
+
+	return signedInAt, err
+}
+
+// SessionExists reports whether the session of the user has a refresh token that has not expired. Access tokens
+// of the session are accepted only while it does, so ending the session revokes them as well
+func SessionExists(ctx context.Context, userID *string, sessionID *string) (bool, error) {
+	if userID == nil || sessionID == nil {
+		return false, errors.New("userID and sessionID must not be nil")
+	}
+
+	var exists bool
+	err := pool.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM "refreshTokens"
+            WHERE "userID" = $1 AND "sessionID" = $2 AND "expiresAt" > CURRENT_TIMESTAMP
+        )
+    `, userID, sessionID).Scan(&exists)
+
+	return exists, errors.WithStack(err)
+}
+
+// DeleteRefreshTokenFamily revokes every token rotated from the same login, including already rotated ones
+func DeleteRefreshTokenFamily(ctx context.Context, sessionID *string) error {
+	if sessionID == nil {
+		return errors.New("sessionID must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `DELETE FROM "refreshTokens" WHERE "sessionID" = $1`, sessionID)
+	return errors.WithStack(err)
+}
+
+// DeleteSession revokes a single session of the user. Returns pgx.ErrNoRows if the session does not exist
+func DeleteSession(ctx context.Context, userID *string, sessionID *string) error {
+	if userID == nil || sessionID == nil {
+		return errors.New("userID and sessionID must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `DELETE FROM "refreshTokens" WHERE "userID" = $1 AND "sessionID" = $2`, userID, sessionID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteOtherSessions revokes every session of the user except sessionID and returns revoked session ids
+func DeleteOtherSessions(ctx context.Context, userID *string, sessionID *string) ([]string, error) {
+	if userID == nil || sessionID == nil {
+		return nil, errors.New("userID and sessionID must not be nil")
+	}
+
+	rows, err := pool.Query(ctx, `
+        WITH deleted AS (
+            DELETE FROM "refreshTokens"
+            WHERE "userID" = $1 AND "sessionID" != $2
+            RETURNING "sessionID"
+        )
+        SELECT DISTINCT "sessionID" FROM deleted
+    `, userID, sessionID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sessionIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	return sessionIDs, errors.WithStack(err)
+}
+
 func UpdateUser(ctx context.Context, user *types.User, updateUser *types.UpdateUser, passwordHash *string) (types.User, error) {
 	if (updateUser == nil) == (passwordHash == nil) {
 		return types.User{}, errors.New("Either updateUser or passwordHash should not be nil")
@@ -86,3 +316,932 @@ func UpdateUser(ctx context.Context, user *types.User, updateUser *types.UpdateU
 		return queryOneReturning[types.User](ctx, `UPDATE "users" SET "passwordHash"=$1 WHERE "id"=$2 RETURNING *`, passwordHash, user.ID)
 	}
 }
+
+// RehashPassword replaces password hash of the user with the same password hashed differently. Returns
+// pgx.ErrNoRows if the password changed meanwhile
+func RehashPassword(ctx context.Context, userID *string, oldHash *string, newHash *string) error {
+	if userID == nil || oldHash == nil || newHash == nil {
+		return errors.New("userID, oldHash and newHash must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `UPDATE "users" SET "passwordHash" = $3 WHERE "id" = $1 AND "passwordHash" = $2`, userID, oldHash, newHash)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// CreatePasswordResetToken creates new reset token for the user, invalidating previously issued unused ones
+func CreatePasswordResetToken(ctx context.Context, resetToken *types.PasswordResetToken) (types.PasswordResetToken, error) {
+	if resetToken == nil {
+		return types.PasswordResetToken{}, errors.New("resetToken must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.PasswordResetToken, error) {
+		_, err := tx.Exec(ctx, `DELETE FROM "passwordResetTokens" WHERE "userID" = $1 AND "usedAt" IS NULL`, resetToken.UserID)
+		if err != nil {
+			return types.PasswordResetToken{}, errors.WithStack(err)
+		}
+
+		return queryOneReturningTx[types.PasswordResetToken](ctx, tx, `
+            INSERT INTO "passwordResetTokens" ("id", "userID", "tokenHash", "expiresAt")
+            VALUES ($1, $2, $3, $4)
+            RETURNING *
+        `, resetToken.ID, resetToken.UserID, resetToken.TokenHash, resetToken.ExpiresAt)
+	})
+}
+
+// ResetPassword consumes the reset token, sets new password hash and revokes every session of the user.
+// Returns pgx.ErrNoRows if token is unknown, expired or already used
+func ResetPassword(ctx context.Context, tokenHash *string, passwordHash *string) (types.User, error) {
+	if tokenHash == nil || passwordHash == nil {
+		return types.User{}, errors.New("All arguments must be not nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.User, error) {
+		resetToken, err := queryOneReturningTx[types.PasswordResetToken](ctx, tx, `
+            UPDATE "passwordResetTokens" SET "usedAt" = CURRENT_TIMESTAMP
+            WHERE "tokenHash" = $1 AND "usedAt" IS NULL AND "expiresAt" > CURRENT_TIMESTAMP
+            RETURNING *
+        `, tokenHash)
+		if err != nil {
+			return types.User{}, err
+		}
+
+		user, err := queryOneReturningTx[types.User](ctx, tx, `
+            UPDATE "users" SET "passwordHash" = $1 WHERE "id" = $2 RETURNING *
+        `, passwordHash, resetToken.UserID)
+		if err != nil {
+			return types.User{}, errors.WithStack(err)
+		}
+
+		if _, err = tx.Exec(ctx, `DELETE FROM "refreshTokens" WHERE "userID" = $1`, resetToken.UserID); err != nil {
+			return types.User{}, errors.WithStack(err)
+		}
+
+		return user, nil
+	})
+}
+
+// CreateEmailVerificationToken creates new verification token, invalidating previously issued unused ones of the user
+func CreateEmailVerificationToken(ctx context.Context, verificationToken *types.EmailVerificationToken) (types.EmailVerificationToken, error) {
+	if verificationToken == nil {
+		return types.EmailVerificationToken{}, errors.New("verificationToken must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.EmailVerificationToken, error) {
+		_, err := tx.Exec(ctx, `DELETE FROM "emailVerificationTokens" WHERE "userID" = $1 AND "usedAt" IS NULL`, verificationToken.UserID)
+		if err != nil {
+			return types.EmailVerificationToken{}, errors.WithStack(err)
+		}
+
+		return queryOneReturningTx[types.EmailVerificationToken](ctx, tx, `
+            INSERT INTO "emailVerificationTokens" ("id", "userID", "email", "tokenHash", "expiresAt")
+            VALUES ($1, $2, $3, $4, $5)
+            RETURNING *
+        `, verificationToken.ID, verificationToken.UserID, verificationToken.Email, verificationToken.TokenHash, verificationToken.ExpiresAt)
+	})
+}
+
+// VerifyEmail consumes the verification token and marks the email it was issued for as verified.
+// Returns pgx.ErrNoRows if token is unknown, expired, already used or the user changed email since
+func VerifyEmail(ctx context.Context, tokenHash *string) (types.User, error) {
+	if tokenHash == nil {
+		return types.User{}, errors.New("tokenHash must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.User, error) {
+		verificationToken, err := queryOneReturningTx[types.EmailVerificationToken](ctx, tx, `
+            UPDATE "emailVerificationTokens" SET "usedAt" = CURRENT_TIMESTAMP
+            WHERE "tokenHash" = $1 AND "usedAt" IS NULL AND "expiresAt" > CURRENT_TIMESTAMP
+            RETURNING *
+        `, tokenHash)
+		if err != nil {
+			return types.User{}, err
+		}
+
+		return queryOneReturningTx[types.User](ctx, tx, `
+            UPDATE "users" SET "emailVerified" = TRUE
+            WHERE "id" = $1 AND "email" = $2
+            RETURNING *
+        `, verificationToken.UserID, verificationToken.Email)
+	})
+}
+
+// CreateEmailChangeToken stores the token, replacing pending email changes of the user
+func CreateEmailChangeToken(ctx context.Context, changeToken *types.EmailChangeToken) (types.EmailChangeToken, error) {
+	if changeToken == nil {
+		return types.EmailChangeToken{}, errors.New("changeToken must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.EmailChangeToken, error) {
+		_, err := tx.Exec(ctx, `DELETE FROM "emailChangeTokens" WHERE "userID" = $1 AND "usedAt" IS NULL`, changeToken.UserID)
+		if err != nil {
+			return types.EmailChangeToken{}, errors.WithStack(err)
+		}
+
+		return queryOneReturningTx[types.EmailChangeToken](ctx, tx, `
+            INSERT INTO "emailChangeTokens" ("id", "userID", "oldEmail", "newEmail", "sessionID", "tokenHash", "expiresAt")
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+            RETURNING *
+        `, changeToken.ID, changeToken.UserID, changeToken.OldEmail, changeToken.NewEmail, changeToken.SessionID,
+			changeToken.TokenHash, changeToken.ExpiresAt)
+	})
+}
+
+// ChangeEmail consumes the token, swaps email of the user to the confirmed one and revokes every session
+// except the one that requested the change. Returns pgx.ErrNoRows if token is unknown, expired, already used
+// or the email changed since it was issued
+func ChangeEmail(ctx context.Context, tokenHash *string) (types.EmailChanged, error) {
+	if tokenHash == nil {
+		return types.EmailChanged{}, errors.New("tokenHash must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.EmailChanged, error) {
+		changeToken, err := queryOneReturningTx[types.EmailChangeToken](ctx, tx, `
+            UPDATE "emailChangeTokens" SET "usedAt" = CURRENT_TIMESTAMP
+            WHERE "tokenHash" = $1 AND "usedAt" IS NULL AND "expiresAt" > CURRENT_TIMESTAMP
+            RETURNING *
+        `, tokenHash)
+		if err != nil {
+			return types.EmailChanged{}, err
+		}
+
+		user, err := queryOneReturningTx[types.User](ctx, tx, `
+            UPDATE "users" SET "email" = $3, "emailVerified" = TRUE
+            WHERE "id" = $1 AND "email" = $2
+            RETURNING *
+        `, changeToken.UserID, changeToken.OldEmail, changeToken.NewEmail)
+		if err != nil {
+			return types.EmailChanged{}, err
+		}
+
+		// links sent to the old address must not verify it anymore
+		if _, err = tx.Exec(ctx, `
+            DELETE FROM "emailVerificationTokens" WHERE "userID" = $1 AND "usedAt" IS NULL
+        `, user.ID); err != nil {
+			return types.EmailChanged{}, errors.WithStack(err)
+		}
+
+		rows, err := tx.Query(ctx, `
+            WITH deleted AS (
+                DELETE FROM "refreshTokens"
+                WHERE "userID" = $1 AND "sessionID" != $2
+                RETURNING "sessionID"
+            )
+            SELECT DISTINCT "sessionID" FROM deleted
+        `, user.ID, changeToken.SessionID)
+		if err != nil {
+			return types.EmailChanged{}, errors.WithStack(err)
+		}
+
+		sessionIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return types.EmailChanged{}, errors.WithStack(err)
+		}
+
+		return types.EmailChanged{User: user, OldEmail: changeToken.OldEmail, RevokedSessionIDs: sessionIDs}, nil
+	})
+}
+
+// UpsertUserTOTP stores new not yet confirmed TOTP secret of the user, replacing previous enrollment
+func UpsertUserTOTP(ctx context.Context, userID *string, secret *string) (types.UserTOTP, error) {
+	if userID == nil || secret == nil {
+		return types.UserTOTP{}, errors.New("userID or secret must not be nil")
+	}
+
+	return queryOneReturning[types.UserTOTP](ctx, `
+        INSERT INTO "userTotp" ("userID", "secret") VALUES ($1, $2)
+        ON CONFLICT ("userID") DO UPDATE
+        SET "secret" = EXCLUDED."secret", "createdAt" = CURRENT_TIMESTAMP, "confirmedAt" = NULL, "lastUsedStep" = NULL
+        RETURNING *
+    `, userID, secret)
+}
+
+func GetUserTOTP(ctx context.Context, userID *string) (types.UserTOTP, error) {
+	if userID == nil {
+		return types.UserTOTP{}, errors.New("userID must not be nil")
+	}
+
+	return queryOneReturning[types.UserTOTP](ctx, `SELECT * FROM "userTotp" WHERE "userID" = $1`, userID)
+}
+
+// UseTOTPStep marks time step as used, so the code of that step cannot be replayed.
+// Returns pgx.ErrNoRows if the step or a later one was already used
+func UseTOTPStep(ctx context.Context, userID *string, step int64) error {
+	if userID == nil {
+		return errors.New("userID must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `
+        UPDATE "userTotp" SET "lastUsedStep" = $2
+        WHERE "userID" = $1 AND ("lastUsedStep" IS NULL OR "lastUsedStep" < $2)
+    `, userID, step)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// EnableTwoFactor confirms TOTP enrollment of the user and replaces recovery codes
+func EnableTwoFactor(ctx context.Context, userID *string, step int64, recoveryCodeHashes []string) (types.User, error) {
+	if userID == nil {
+		return types.User{}, errors.New("userID must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.User, error) {
+		tag, err := tx.Exec(ctx, `
+            UPDATE "userTotp" SET "confirmedAt" = CURRENT_TIMESTAMP, "lastUsedStep" = $2
+            WHERE "userID" = $1 AND "confirmedAt" IS NULL
+        `, userID, step)
+		if err != nil {
+			return types.User{}, errors.WithStack(err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return types.User{}, pgx.ErrNoRows
+		}
+
+		if err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+			return types.User{}, err
+		}
+
+		return queryOneReturningTx[types.User](ctx, tx, `
+            UPDATE "users" SET "twoFactorEnabled" = TRUE WHERE "id" = $1 RETURNING *
+        `, userID)
+	})
+}
+
+// DisableTwoFactor removes TOTP secret, recovery codes and pending login challenges of the user
+func DisableTwoFactor(ctx context.Context, userID *string) (types.User, error) {
+	if userID == nil {
+		return types.User{}, errors.New("userID must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.User, error) {
+		if _, err := tx.Exec(ctx, `DELETE FROM "userTotp" WHERE "userID" = $1`, userID); err != nil {
+			return types.User{}, errors.WithStack(err)
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM "recoveryCodes" WHERE "userID" = $1`, userID); err != nil {
+			return types.User{}, errors.WithStack(err)
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM "twoFactorChallenges" WHERE "userID" = $1`, userID); err != nil {
+			return types.User{}, errors.WithStack(err)
+		}
+
+		return queryOneReturningTx[types.User](ctx, tx, `
+            UPDATE "users" SET "twoFactorEnabled" = FALSE WHERE "id" = $1 RETURNING *
+        `, userID)
+	})
+}
+
+func ReplaceRecoveryCodes(ctx context.Context, userID *string, recoveryCodeHashes []string) error {
+	if userID == nil {
+		return errors.New("userID must not be nil")
+	}
+
+	_, err := withTx(ctx, func(tx pgx.Tx) (any, error) {
+		return nil, replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	})
+
+	return err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID *string, recoveryCodeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM "recoveryCodes" WHERE "userID" = $1`, userID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	rows := make([][]any, len(recoveryCodeHashes))
+	for i, codeHash := range recoveryCodeHashes {
+		rows[i] = []any{*userID, codeHash}
+	}
+
+	return bulkInsert(ctx, tx, "recoveryCodes", []string{"userID", "codeHash"}, rows)
+}
+
+// UseRecoveryCode marks unused recovery code of the user as used. Returns pgx.ErrNoRows if there is no such code
+func UseRecoveryCode(ctx context.Context, userID *string, codeHash *string) error {
+	if userID == nil || codeHash == nil {
+		return errors.New("userID or codeHash must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `
+        UPDATE "recoveryCodes" SET "usedAt" = CURRENT_TIMESTAMP
+        WHERE "userID" = $1 AND "codeHash" = $2 AND "usedAt" IS NULL
+    `, userID, codeHash)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+func CreateTwoFactorChallenge(ctx context.Context, challenge *types.TwoFactorChallenge) (types.TwoFactorChallenge, error) {
+	if challenge == nil {
+		return types.TwoFactorChallenge{}, errors.New("challenge must not be nil")
+	}
+
+	return queryOneReturning[types.TwoFactorChallenge](ctx, `
+        INSERT INTO "twoFactorChallenges" ("id", "userID", "tokenHash", "expiresAt")
+        VALUES ($1, $2, $3, $4)
+        RETURNING *
+    `, challenge.ID, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt)
+}
+
+// AttemptTwoFactorChallenge counts an attempt to complete the challenge.
+// Returns pgx.ErrNoRows if challenge is unknown, expired or out of attempts
+func AttemptTwoFactorChallenge(ctx context.Context, tokenHash *string, maxAttempts int) (types.TwoFactorChallenge, error) {
+	if tokenHash == nil {
+		return types.TwoFactorChallenge{}, errors.New("tokenHash must not be nil")
+	}
+
+	return queryOneReturning[types.TwoFactorChallenge](ctx, `
+        UPDATE "twoFactorChallenges" SET "attempts" = "attempts" + 1
+        WHERE "tokenHash" = $1 AND "expiresAt" > CURRENT_TIMESTAMP AND "attempts" < $2
+        RETURNING *
+    `, tokenHash, maxAttempts)
+}
+
+// DeleteTwoFactorChallenges deletes the completed challenge along with expired ones of the user
+func DeleteTwoFactorChallenges(ctx context.Context, userID *string, id *string) error {
+	if userID == nil || id == nil {
+		return errors.New("userID or id must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `
+        DELETE FROM "twoFactorChallenges" WHERE "userID" = $1 AND ("id" = $2 OR "expiresAt" <= CURRENT_TIMESTAMP)
+    `, userID, id)
+
+	return errors.WithStack(err)
+}
+
+// CreateOIDCState stores state of started single sign-on login, purging abandoned ones
+func CreateOIDCState(ctx context.Context, state *types.OIDCState) (types.OIDCState, error) {
+	if state == nil {
+		return types.OIDCState{}, errors.New("state must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.OIDCState, error) {
+		if _, err := tx.Exec(ctx, `DELETE FROM "oidcStates" WHERE "expiresAt" <= CURRENT_TIMESTAMP`); err != nil {
+			return types.OIDCState{}, errors.WithStack(err)
+		}
+
+		return queryOneReturningTx[types.OIDCState](ctx, tx, `
+            INSERT INTO "oidcStates" ("stateHash", "nonce", "codeVerifier", "expiresAt")
+            VALUES ($1, $2, $3, $4)
+            RETURNING *
+        `, state.StateHash, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	})
+}
+
+// ConsumeOIDCState deletes and returns the state, so every state can complete only one login.
+// Returns pgx.ErrNoRows if the state is unknown or expired
+func ConsumeOIDCState(ctx context.Context, stateHash *string) (types.OIDCState, error) {
+	if stateHash == nil {
+		return types.OIDCState{}, errors.New("stateHash must not be nil")
+	}
+
+	return queryOneReturning[types.OIDCState](ctx, `
+        DELETE FROM "oidcStates" WHERE "stateHash" = $1 AND "expiresAt" > CURRENT_TIMESTAMP RETURNING *
+    `, stateHash)
+}
+
+func GetUserByIdentity(ctx context.Context, issuer *string, subject *string) (types.User, error) {
+	if issuer == nil || subject == nil {
+		return types.User{}, errors.New("issuer or subject must not be nil")
+	}
+
+	return queryOneReturning[types.User](ctx, `
+        SELECT u.* FROM "users" u
+        JOIN "userIdentities" i ON i."userID" = u."id"
+        WHERE i."issuer" = $1 AND i."subject" = $2
+    `, issuer, subject)
+}
+
+// CreateOIDCUser provisions user signed in through identity provider. Such user has no password
+func CreateOIDCUser(ctx context.Context, user *types.User, identity *types.UserIdentity) (types.User, error) {
+	if user == nil || identity == nil {
+		return types.User{}, errors.New("user or identity must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.User, error) {
+		newUser, err := queryOneReturningTx[types.User](ctx, tx, `
+            INSERT INTO "users" ("id", "username", "firstName", "lastName", "dateOfBirth", "email", "passwordHash", "emailVerified")
+            VALUES ($1, $2, $3, $4, $5, $6, '', $7)
+            RETURNING *
+        `, user.ID, user.Username, user.FirstName, user.LastName, user.DateOfBirth, user.Email, user.EmailVerified)
+		if err != nil {
+			return types.User{}, err
+		}
+
+		if err = insertUserIdentity(ctx, tx, &newUser.ID, identity); err != nil {
+			return types.User{}, err
+		}
+
+		return newUser, nil
+	})
+}
+
+// LinkUserIdentity links identity to existing user. The provider vouched for the email, so it becomes verified
+func LinkUserIdentity(ctx context.Context, userID *string, identity *types.UserIdentity) (types.User, error) {
+	if userID == nil || identity == nil {
+		return types.User{}, errors.New("userID or identity must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.User, error) {
+		if err := insertUserIdentity(ctx, tx, userID, identity); err != nil {
+			return types.User{}, err
+		}
+
+		return queryOneReturningTx[types.User](ctx, tx, `
+            UPDATE "users" SET "emailVerified" = TRUE WHERE "id" = $1 RETURNING *
+        `, userID)
+	})
+}
+
+func insertUserIdentity(ctx context.Context, tx pgx.Tx, userID *string, identity *types.UserIdentity) error {
+	_, err := tx.Exec(ctx, `
+        INSERT INTO "userIdentities" ("issuer", "subject", "userID", "email") VALUES ($1, $2, $3, $4)
+    `, identity.Issuer, identity.Subject, userID, identity.Email)
+
+	return errors.WithStack(err)
+}
+
+func CreatePersonalAccessToken(ctx context.Context, token *types.PersonalAccessToken) (types.PersonalAccessToken, error) {
+	if token == nil {
+		return types.PersonalAccessToken{}, errors.New("token must not be nil")
+	}
+
+	return queryOneReturning[types.PersonalAccessToken](ctx, `
+        INSERT INTO "personalAccessTokens" ("id", "userID", "name", "tokenHash", "scope", "expiresAt")
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING *
+    `, token.ID, token.UserID, token.Name, token.TokenHash, token.Scope, token.ExpiresAt)
+}
+
+func GetPersonalAccessTokens(ctx context.Context, userID *string) ([]types.PersonalAccessToken, error) {
+	if userID == nil {
+		return []types.PersonalAccessToken{}, errors.New("userID must not be nil")
+	}
+
+	return queryReturning[types.PersonalAccessToken](ctx, `
+        SELECT * FROM "personalAccessTokens" WHERE "userID" = $1 ORDER BY "createdAt" DESC
+    `, userID)
+}
+
+// GetValidPersonalAccessToken returns not expired token by hash. Returns pgx.ErrNoRows if there is none
+func GetValidPersonalAccessToken(ctx context.Context, tokenHash *string) (types.PersonalAccessToken, error) {
+	if tokenHash == nil {
+		return types.PersonalAccessToken{}, errors.New("tokenHash must not be nil")
+	}
+
+	return queryOneReturning[types.PersonalAccessToken](ctx, `
+        SELECT * FROM "personalAccessTokens" WHERE "tokenHash" = $1 AND "expiresAt" > CURRENT_TIMESTAMP
+    `, tokenHash)
+}
+
+// TouchPersonalAccessToken updates last usage of the token. Writes are coalesced to one per minute
+func TouchPersonalAccessToken(ctx context.Context, id *string) error {
+	if id == nil {
+		return errors.New("id must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `
+        UPDATE "personalAccessTokens" SET "lastUsedAt" = CURRENT_TIMESTAMP
+        WHERE "id" = $1 AND ("lastUsedAt" IS NULL OR "lastUsedAt" < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+    `, id)
+
+	return errors.WithStack(err)
+}
+
+// DeletePersonalAccessToken returns pgx.ErrNoRows if the user has no token with the id
+func DeletePersonalAccessToken(ctx context.Context, userID *string, id *string) error {
+	if userID == nil || id == nil {
+		return errors.New("userID or id must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `DELETE FROM "personalAccessTokens" WHERE "userID" = $1 AND "id" = $2`, userID, id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// ReserveThrottle counts an attempt of the key as failed unless the key is locked, starting over when the last
+// failure is older than window. The key is locked for delay of the new count while the row is still locked, so
+// concurrent reservations wait for it. It returns the count, or for how long the key stays locked
+func ReserveThrottle(ctx context.Context, key *string, window time.Duration, delay func(int) time.Duration) (int, time.Duration, error) {
+	if key == nil || delay == nil {
+		return 0, 0, errors.New("all parameters must not be nil")
+	}
+
+	type reservation struct {
+		failures  int
+		lockedFor time.Duration
+	}
+
+	result, err := withTx(ctx, func(tx pgx.Tx) (reservation, error) {
+		var failures int
+		var lockedSeconds float64
+		err := tx.QueryRow(ctx, `
+            INSERT INTO "authThrottles" ("key", "failures", "lastFailureAt") VALUES ($1, 1, CURRENT_TIMESTAMP)
+            ON CONFLICT ("key") DO UPDATE SET
+                "failures" = CASE
+                    WHEN "authThrottles"."lockedUntil" > CURRENT_TIMESTAMP THEN "authThrottles"."failures"
+                    WHEN "authThrottles"."lastFailureAt" < CURRENT_TIMESTAMP - make_interval(secs => $2) THEN 1
+                    ELSE "authThrottles"."failures" + 1
+                END,
+                "lastFailureAt" = CASE
+                    WHEN "authThrottles"."lockedUntil" > CURRENT_TIMESTAMP THEN "authThrottles"."lastFailureAt"
+                    ELSE CURRENT_TIMESTAMP
+                END
+            RETURNING "failures",
+                COALESCE(GREATEST(EXTRACT(EPOCH FROM "lockedUntil" - CURRENT_TIMESTAMP), 0), 0)::FLOAT8
+        `, key, window.Seconds()).Scan(&failures, &lockedSeconds)
+		if err != nil {
+			return reservation{}, errors.WithStack(err)
+		}
+
+		if lockedSeconds > 0 {
+			return reservation{lockedFor: time.Duration(lockedSeconds * float64(time.Second))}, nil
+		}
+
+		if lockFor := delay(failures); lockFor > 0 {
+			_, err = tx.Exec(ctx, `
+                UPDATE "authThrottles" SET "lockedUntil" = CURRENT_TIMESTAMP + make_interval(secs => $2) WHERE "key" = $1
+            `, key, lockFor.Seconds())
+			if err != nil {
+				return reservation{}, errors.WithStack(err)
+			}
+		}
+
+		return reservation{failures: failures}, nil
+	})
+
+	return result.failures, result.lockedFor, err
+}
+
+// ReleaseThrottle takes back a reserved attempt of the key and lifts the lock it caused
+func ReleaseThrottle(ctx context.Context, key *string) error {
+	if key == nil {
+		return errors.New("key must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `
+        UPDATE "authThrottles" SET "failures" = GREATEST("failures" - 1, 0), "lockedUntil" = NULL WHERE "key" = $1
+    `, key)
+
+	return errors.WithStack(err)
+}
+
+func DeleteThrottle(ctx context.Context, key *string) error {
+	if key == nil {
+		return errors.New("key must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `DELETE FROM "authThrottles" WHERE "key" = $1`, key)
+
+	return errors.WithStack(err)
+}
+
+// PurgeThrottles deletes keys without failures in window that are not locked
+func PurgeThrottles(ctx context.Context, window time.Duration) error {
+	_, err := pool.Exec(ctx, `
+        DELETE FROM "authThrottles"
+        WHERE "lastFailureAt" < CURRENT_TIMESTAMP - make_interval(secs => $1)
+            AND ("lockedUntil" IS NULL OR "lockedUntil" < CURRENT_TIMESTAMP)
+    `, window.Seconds())
+
+	return errors.WithStack(err)
+}
+
+// SigningKeyStore persists JWT signing keys, so every instance signs and verifies with the same keys
+type SigningKeyStore struct{}
+
+// GetSigningKeys returns keys that still verify tokens, the newest first
+func (SigningKeyStore) GetSigningKeys(ctx context.Context) ([]types.SigningKey, error) {
+	return queryReturning[types.SigningKey](ctx, `
+        SELECT * FROM "signingKeys"
+        WHERE "expiresAt" IS NULL OR "expiresAt" > CURRENT_TIMESTAMP
+        ORDER BY "createdAt" DESC
+    `)
+}
+
+// RotateSigningKey retires active keys, keeping them for verification during retention, and activates key.
+// Nothing happens if an active key created after notBefore exists, i.e. another instance has already rotated
+func (SigningKeyStore) RotateSigningKey(ctx context.Context, key *types.SigningKey, notBefore time.Time, retention time.Duration) (bool, error) {
+	if key == nil {
+		return false, errors.New("key must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (bool, error) {
+		// serializes rotations of concurrently starting instances
+		if _, err := tx.Exec(ctx, `LOCK TABLE "signingKeys" IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		var fresh bool
+		if err := tx.QueryRow(ctx, `
+            SELECT EXISTS (SELECT 1 FROM "signingKeys" WHERE "retiredAt" IS NULL AND "createdAt" > $1)
+        `, notBefore).Scan(&fresh); err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if fresh {
+			return false, nil
+		}
+
+		if _, err := tx.Exec(ctx, `
+            UPDATE "signingKeys"
+            SET "retiredAt" = CURRENT_TIMESTAMP, "expiresAt" = CURRENT_TIMESTAMP + make_interval(secs => $1)
+            WHERE "retiredAt" IS NULL
+        `, retention.Seconds()); err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if _, err := tx.Exec(ctx, `
+            INSERT INTO "signingKeys" ("id", "algorithm", "privateKey") VALUES ($1, $2, $3)
+        `, key.ID, key.Algorithm, key.PrivateKey); err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		return true, nil
+	})
+}
+
+func (SigningKeyStore) DeleteExpiredSigningKeys(ctx context.Context) error {
+	_, err := pool.Exec(ctx, `DELETE FROM "signingKeys" WHERE "expiresAt" <= CURRENT_TIMESTAMP`)
+	return errors.WithStack(err)
+}
+
+func RevokeAccessToken(ctx context.Context, token *types.RevokedAccessToken) error {
+	if token == nil {
+		return errors.New("token must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `
+        INSERT INTO "revokedAccessTokens" ("jti", "userID", "sessionID", "expiresAt") VALUES ($1, $2, $3, $4)
+        ON CONFLICT ("jti") DO NOTHING
+    `, token.JTI, token.UserID, token.SessionID, token.ExpiresAt)
+
+	return errors.WithStack(err)
+}
+
+// GetRevokedAccessTokens returns revoked access tokens that have not expired yet
+func GetRevokedAccessTokens(ctx context.Context) ([]types.RevokedAccessToken, error) {
+	return queryReturning[types.RevokedAccessToken](ctx, `
+        SELECT * FROM "revokedAccessTokens" WHERE "expiresAt" > CURRENT_TIMESTAMP
+    `)
+}
+
+func DeleteExpiredRevokedAccessTokens(ctx context.Context) error {
+	_, err := pool.Exec(ctx, `DELETE FROM "revokedAccessTokens" WHERE "expiresAt" <= CURRENT_TIMESTAMP`)
+	return errors.WithStack(err)
+}
+
+type userSearchRow struct {
+	types.User
+	Total int
+}
+
+// SearchUsers finds users sharing a project with userID whose name or email starts with or resembles query.
+// Query has to be lowercase with LIKE wildcards escaped. Prefix matches come first, then the closest ones
+func SearchUsers(ctx context.Context, userID *string, query *string, limit, offset int) ([]types.User, int, error) {
+	if userID == nil || query == nil {
+		return nil, 0, errors.New("userID and query must not be nil")
+	}
+
+	rows, err := withTx(ctx, func(tx pgx.Tx) ([]userSearchRow, error) {
+		// the default threshold of 0.6 rejects most typos
+		if _, err := tx.Exec(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', '0.3', true)`); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return queryReturningTx[userSearchRow](ctx, tx, `
+            WITH "callerProjects" AS (
+                SELECT "id" AS "projectID" FROM "projects" WHERE "creatorID" = $1
+                UNION SELECT "projectID" FROM "projectUsers" WHERE "userID" = $1
+            ), "coworkers" AS (
+                SELECT "creatorID" AS "userID" FROM "projects" WHERE "id" IN (SELECT "projectID" FROM "callerProjects")
+                UNION SELECT "userID" FROM "projectUsers" WHERE "projectID" IN (SELECT "projectID" FROM "callerProjects")
+            )
+            SELECT u.*, COUNT(*) OVER() AS "total"
+            FROM "users" u
+            CROSS JOIN LATERAL (
+                SELECT lower(u."username" || ' ' || u."firstName" || ' ' || u."lastName" || ' ' || u."email") AS "document"
+            ) d
+            WHERE u."id" IN (SELECT "userID" FROM "coworkers")
+                AND u."id" <> $3
+                AND (d."document" LIKE '%' || $2 || '%' OR $2 <% d."document")
+            ORDER BY
+                (lower(u."username") LIKE $2 || '%' OR lower(u."firstName") LIKE $2 || '%'
+                    OR lower(u."lastName") LIKE $2 || '%' OR lower(u."email") LIKE $2 || '%') DESC,
+                word_similarity($2, d."document") DESC,
+                u."username"
+            LIMIT $4 OFFSET $5
+        `, userID, query, types.DeletedUserID, limit, offset)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]types.User, len(rows))
+	total := 0
+	for i, row := range rows {
+		users[i] = row.User
+		total = row.Total
+	}
+
+	return users, total, nil
+}
+
+func CreateAuthEvent(ctx context.Context, event *types.AuthEvent) error {
+	if event == nil {
+		return errors.New("event must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `
+        INSERT INTO "authEvents" ("id", "userID", "type", "ip", "userAgent", "details")
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `, event.ID, event.UserID, event.Type, event.IP, event.UserAgent, event.Details)
+
+	return errors.WithStack(err)
+}
+
+type authEventRow struct {
+	types.AuthEvent
+	Total int
+}
+
+// GetAuthEvents returns page of events newest first and the number of all matching events.
+// Empty userID and eventType and nil from and to do not filter
+func GetAuthEvents(ctx context.Context, userID *string, eventType *types.AuthEventType, from, to *time.Time, limit, offset int) ([]types.AuthEvent, int, error) {
+	if userID == nil || eventType == nil {
+		return nil, 0, errors.New("userID and eventType must not be nil")
+	}
+
+	rows, err := queryReturning[authEventRow](ctx, `
+        SELECT *, COUNT(*) OVER() AS "total"
+        FROM "authEvents"
+        WHERE ($1 = '' OR "userID" = $1)
+            AND ($2 = '' OR "type" = $2)
+            AND ($3::TIMESTAMP IS NULL OR "createdAt" >= $3)
+            AND ($4::TIMESTAMP IS NULL OR "createdAt" < $4)
+        ORDER BY "createdAt" DESC, "id"
+        LIMIT $5 OFFSET $6
+    `, userID, eventType, from, to, limit, offset)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, err
+	}
+
+	events := make([]types.AuthEvent, len(rows))
+	total := 0
+	for i, row := range rows {
+		events[i] = row.AuthEvent
+		total = row.Total
+	}
+
+	return events, total, nil
+}
+
+// SetUserAdmin grants or revokes system administration of the user with the email
+func SetUserAdmin(ctx context.Context, email *string, isAdmin bool) (types.User, error) {
+	if email == nil {
+		return types.User{}, errors.New("email must not be nil")
+	}
+
+	return queryOneReturning[types.User](ctx, `
+        UPDATE "users" SET "isAdmin" = $2 WHERE "email" = $1 RETURNING *
+    `, email, isAdmin)
+}
+
+// AdminSearchUsers returns page of all users matching the query, or of all users newest first when query is empty,
+// and the number of all matching users
+func AdminSearchUsers(ctx context.Context, query *string, limit, offset int) ([]types.User, int, error) {
+	if query == nil {
+		return nil, 0, errors.New("query must not be nil")
+	}
+
+	rows, err := withTx(ctx, func(tx pgx.Tx) ([]userSearchRow, error) {
+		if _, err := tx.Exec(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', '0.3', true)`); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return queryReturningTx[userSearchRow](ctx, tx, `
+            SELECT u.*, COUNT(*) OVER() AS "total"
+            FROM "users" u
+            CROSS JOIN LATERAL (
+                SELECT lower(u."username" || ' ' || u."firstName" || ' ' || u."lastName" || ' ' || u."email") AS "document"
+            ) d
+            WHERE u."id" <> $2
+                AND ($1 = '' OR d."document" LIKE '%' || $1 || '%' OR $1 <% d."document")
+            ORDER BY
+                CASE WHEN $1 = '' THEN 0 ELSE word_similarity($1, d."document") END DESC,
+                u."createdAt" DESC
+            LIMIT $3 OFFSET $4
+        `, query, types.DeletedUserID, limit, offset)
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, err
+	}
+
+	users := make([]types.User, len(rows))
+	total := 0
+	for i, row := range rows {
+		users[i] = row.User
+		total = row.Total
+	}
+
+	return users, total, nil
+}
+
+// SetUserDisabled disables or enables the user. Disabling ends every session of the user, their ids are returned
+func SetUserDisabled(ctx context.Context, userID *string, disabled bool) (types.User, []string, error) {
+	if userID == nil {
+		return types.User{}, nil, errors.New("userID must not be nil")
+	}
+
+	var sessionIDs []string
+
+	user, err := withTx(ctx, func(tx pgx.Tx) (types.User, error) {
+		user, err := queryOneReturningTx[types.User](ctx, tx, `
+            UPDATE "users"
+            SET "disabledAt" = CASE WHEN $2 THEN COALESCE("disabledAt", CURRENT_TIMESTAMP) END
+            WHERE "id" = $1
+            RETURNING *
+        `, userID, disabled)
+		if err != nil || !disabled {
+			return user, err
+		}
+
+		sessionIDs, err = deleteAllSessionsTx(ctx, tx, userID)
+		return user, err
+	})
+
+	return user, sessionIDs, err
+}
+
+// ForcePasswordReset removes password of the user, so it can only be set again through password reset, and ends
+// every session and deletes every personal access token of the user. Returns ids of ended sessions
+func ForcePasswordReset(ctx context.Context, userID *string) (types.User, []string, error) {
+	if userID == nil {
+		return types.User{}, nil, errors.New("userID must not be nil")
+	}
+
+	var sessionIDs []string
+
+	user, err := withTx(ctx, func(tx pgx.Tx) (types.User, error) {
+		user, err := queryOneReturningTx[types.User](ctx, tx, `
+            UPDATE "users" SET "passwordHash" = '' WHERE "id" = $1 RETURNING *
+        `, userID)
+		if err != nil {
+			return user, err
+		}
+
+		if _, err = tx.Exec(ctx, `DELETE FROM "personalAccessTokens" WHERE "userID" = $1`, userID); err != nil {
+			return user, errors.WithStack(err)
+		}
+
+		sessionIDs, err = deleteAllSessionsTx(ctx, tx, userID)
+		return user, err
+	})
+
+	return user, sessionIDs, err
+}
+
+func deleteAllSessionsTx(ctx context.Context, tx pgx.Tx, userID *string) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+        WITH deleted AS (
+            DELETE FROM "refreshTokens" WHERE "userID" = $1 RETURNING "sessionID"
+        )
+        SELECT DISTINCT "sessionID" FROM deleted WHERE "sessionID" IS NOT NULL
+    `, userID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sessionIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	return sessionIDs, errors.WithStack(err)
+}
@@ -38,8 +38,8 @@ func bulkInsert(ctx context.Context, tx pgx.Tx, tableName string, columns []stri
 	return nil
 }
 
-func withTx[T any](ctx context.Context, f func(pgx.Tx) (T, error)) (T, error) {
-	var result T
+// withTx runs f in a transaction, which is committed when f succeeds. Failing to commit fails the call as well
+func withTx[T any](ctx context.Context, f func(pgx.Tx) (T, error)) (result T, err error) {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
 		return result, errors.Wrap(err, "error starting transaction")
@@ -47,8 +47,12 @@ func withTx[T any](ctx context.Context, f func(pgx.Tx) (T, error)) (T, error) {
 	defer func() {
 		if err != nil {
 			tx.Rollback(ctx)
-		} else {
-			tx.Commit(ctx)
+			return
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			var zero T
+			result, err = zero, errors.Wrap(err, "error committing transaction")
 		}
 	}()
 
@@ -175,6 +179,22 @@ func setup() (err error) {
             "updatedAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
         );
         CREATE INDEX IF NOT EXISTS idx_users_email ON "users"("email");
+
+		-- users registered before verification was introduced are treated as verified
+		ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "emailVerified" BOOLEAN NOT NULL DEFAULT TRUE;
+		ALTER TABLE "users" ALTER COLUMN "emailVerified" SET DEFAULT FALSE;
+		ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "twoFactorEnabled" BOOLEAN NOT NULL DEFAULT FALSE;
+		-- identity providers do not have to share date of birth
+		ALTER TABLE "users" ALTER COLUMN "dateOfBirth" DROP NOT NULL;
+
+		ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "avatarKey" VARCHAR(512);
+		ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "avatarURL" VARCHAR(2048);
+		ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "isAdmin" BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "disabledAt" TIMESTAMP;
+
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		CREATE INDEX IF NOT EXISTS idx_users_search ON "users"
+		    USING GIN (lower("username" || ' ' || "firstName" || ' ' || "lastName" || ' ' || "email") gin_trgm_ops);
     
 		DROP TRIGGER IF EXISTS update_users_updated_at on "public"."users";
         CREATE TRIGGER update_users_updated_at
@@ -194,10 +214,211 @@ func setup() (err error) {
 		);
         CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON "refreshTokens"("userID");
         CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON "refreshTokens"("expiresAt");
+
+		ALTER TABLE "refreshTokens" ADD COLUMN IF NOT EXISTS "sessionID" VARCHAR(255);
+		UPDATE "refreshTokens" SET "sessionID" = "id" WHERE "sessionID" IS NULL;
+		ALTER TABLE "refreshTokens" ALTER COLUMN "sessionID" SET NOT NULL;
+		ALTER TABLE "refreshTokens" ADD COLUMN IF NOT EXISTS "userAgent" TEXT NOT NULL DEFAULT '';
+		ALTER TABLE "refreshTokens" ADD COLUMN IF NOT EXISTS "ip" VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE "refreshTokens" ADD COLUMN IF NOT EXISTS "signedInAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+		ALTER TABLE "refreshTokens" ADD COLUMN IF NOT EXISTS "lastUsedAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+		ALTER TABLE "refreshTokens" ADD COLUMN IF NOT EXISTS "parentID" VARCHAR(255);
+		ALTER TABLE "refreshTokens" ADD COLUMN IF NOT EXISTS "rotatedAt" TIMESTAMP;
+
+        CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON "refreshTokens"("sessionID");
 		`); err != nil {
 		return errors.Wrap(err, "error creating refreshTokens table")
 	}
 
+	if _, err = transaction.Exec(ctx, `
+		INSERT INTO "users" ("id", "username", "firstName", "lastName", "email", "passwordHash")
+		VALUES ($1, 'deleted user', 'Deleted', 'User', 'deleted-user@squid.invalid', '')
+		ON CONFLICT ("id") DO NOTHING
+		`, types.DeletedUserID); err != nil {
+		return errors.Wrap(err, "error creating deleted user placeholder")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "passwordResetTokens" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "userID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "tokenHash" VARCHAR(255) NOT NULL UNIQUE,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL,
+		    "usedAt" TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON "passwordResetTokens"("userID");
+		`); err != nil {
+		return errors.Wrap(err, "error creating passwordResetTokens table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "emailVerificationTokens" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "userID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "email" VARCHAR(255) NOT NULL,
+		    "tokenHash" VARCHAR(255) NOT NULL UNIQUE,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL,
+		    "usedAt" TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user_id ON "emailVerificationTokens"("userID");
+		`); err != nil {
+		return errors.Wrap(err, "error creating emailVerificationTokens table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "userTotp" (
+		    "userID" VARCHAR(255) PRIMARY KEY REFERENCES "users"("id") ON DELETE CASCADE,
+		    "secret" VARCHAR(255) NOT NULL,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "confirmedAt" TIMESTAMP,
+		    "lastUsedStep" BIGINT
+		);
+		`); err != nil {
+		return errors.Wrap(err, "error creating userTotp table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "recoveryCodes" (
+		    "userID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "codeHash" VARCHAR(255) NOT NULL,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "usedAt" TIMESTAMP,
+		    PRIMARY KEY ("userID", "codeHash")
+		);
+		`); err != nil {
+		return errors.Wrap(err, "error creating recoveryCodes table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "twoFactorChallenges" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "userID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "tokenHash" VARCHAR(255) NOT NULL UNIQUE,
+		    "attempts" INTEGER NOT NULL DEFAULT 0,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_two_factor_challenges_user_id ON "twoFactorChallenges"("userID");
+		`); err != nil {
+		return errors.Wrap(err, "error creating twoFactorChallenges table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "userIdentities" (
+		    "issuer" VARCHAR(255) NOT NULL,
+		    "subject" VARCHAR(255) NOT NULL,
+		    "userID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "email" VARCHAR(255) NOT NULL,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    PRIMARY KEY ("issuer", "subject")
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON "userIdentities"("userID");
+		`); err != nil {
+		return errors.Wrap(err, "error creating userIdentities table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "oidcStates" (
+		    "stateHash" VARCHAR(255) PRIMARY KEY,
+		    "nonce" VARCHAR(255) NOT NULL,
+		    "codeVerifier" VARCHAR(255) NOT NULL,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL
+		);
+		`); err != nil {
+		return errors.Wrap(err, "error creating oidcStates table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "personalAccessTokens" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "userID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "name" VARCHAR(255) NOT NULL,
+		    "tokenHash" VARCHAR(255) NOT NULL UNIQUE,
+		    "scope" VARCHAR(50) NOT NULL,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL,
+		    "lastUsedAt" TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON "personalAccessTokens"("userID");
+		`); err != nil {
+		return errors.Wrap(err, "error creating personalAccessTokens table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "emailChangeTokens" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "userID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "oldEmail" VARCHAR(255) NOT NULL,
+		    "newEmail" VARCHAR(255) NOT NULL,
+		    "sessionID" VARCHAR(255) NOT NULL,
+		    "tokenHash" VARCHAR(255) NOT NULL UNIQUE,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL,
+		    "usedAt" TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_email_change_tokens_user_id ON "emailChangeTokens"("userID");
+		`); err != nil {
+		return errors.Wrap(err, "error creating emailChangeTokens table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "signingKeys" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "algorithm" VARCHAR(16) NOT NULL,
+		    "privateKey" BYTEA NOT NULL,
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "retiredAt" TIMESTAMP,
+		    "expiresAt" TIMESTAMP
+		);
+		`); err != nil {
+		return errors.Wrap(err, "error creating signingKeys table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "revokedAccessTokens" (
+		    "jti" VARCHAR(255) PRIMARY KEY,
+		    "userID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "sessionID" VARCHAR(255) NOT NULL,
+		    "revokedAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL
+		);
+        CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_expires_at ON "revokedAccessTokens"("expiresAt");
+		`); err != nil {
+		return errors.Wrap(err, "error creating revokedAccessTokens table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		-- events outlive the account they belong to, so userID does not reference users
+		CREATE TABLE IF NOT EXISTS "authEvents" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "userID" VARCHAR(255),
+		    "type" VARCHAR(64) NOT NULL,
+		    "ip" VARCHAR(255) NOT NULL DEFAULT '',
+		    "userAgent" TEXT NOT NULL DEFAULT '',
+		    "details" JSONB NOT NULL DEFAULT '{}',
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_auth_events_user_id ON "authEvents"("userID", "createdAt");
+		CREATE INDEX IF NOT EXISTS idx_auth_events_type ON "authEvents"("type", "createdAt");
+		CREATE INDEX IF NOT EXISTS idx_auth_events_created_at ON "authEvents"("createdAt");
+		`); err != nil {
+		return errors.Wrap(err, "error creating authEvents table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "authThrottles" (
+		    "key" VARCHAR(512) PRIMARY KEY,
+		    "failures" INTEGER NOT NULL,
+		    "lastFailureAt" TIMESTAMP NOT NULL,
+		    "lockedUntil" TIMESTAMP
+		);
+		`); err != nil {
+		return errors.Wrap(err, "error creating authThrottles table")
+	}
+
 	if _, err = transaction.Exec(ctx, `
 		CREATE TABLE IF NOT EXISTS "projects" (
 		    "id" VARCHAR(255) PRIMARY KEY,
@@ -208,20 +429,37 @@ func setup() (err error) {
 		    "updatedAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);
 
-		CREATE TABLE IF NOT EXISTS "projectAdmins" (
-    		"projectID" VARCHAR(255) REFERENCES "projects"("id") ON DELETE CASCADE,
-    		"userID" VARCHAR(255) REFERENCES "users"("id") ON DELETE CASCADE,
-    		PRIMARY KEY ("projectID", "userID")
-		);
+		ALTER TABLE "projects" ADD COLUMN IF NOT EXISTS "archivedAt" TIMESTAMP;
+		ALTER TABLE "projects" ADD COLUMN IF NOT EXISTS "deletedAt" TIMESTAMP;
+		ALTER TABLE "projects" ADD COLUMN IF NOT EXISTS "isTemplate" BOOLEAN NOT NULL DEFAULT FALSE;
+
+		CREATE INDEX IF NOT EXISTS idx_projects_deleted ON "projects"("deletedAt") WHERE "deletedAt" IS NOT NULL;
 
-		CREATE TABLE IF NOT EXISTS "projectMembers" (
+		CREATE TABLE IF NOT EXISTS "projectUsers" (
 		    "projectID" VARCHAR(255) REFERENCES "projects"("id") ON DELETE CASCADE,
 		    "userID" VARCHAR(255) REFERENCES "users"("id") ON DELETE CASCADE,
+		    "role" VARCHAR(32) NOT NULL,
 		    PRIMARY KEY ("projectID", "userID")
 		);
 
-		CREATE INDEX IF NOT EXISTS idx_project_admins_user ON "projectAdmins"("userID");
-		CREATE INDEX IF NOT EXISTS idx_project_members_user ON "projectMembers"("userID");
+		CREATE INDEX IF NOT EXISTS idx_project_users_user ON "projectUsers"("userID");
+
+		-- admins and members used to be kept in separate tables
+		DO $$ BEGIN
+			IF to_regclass('"projectAdmins"') IS NOT NULL THEN
+				INSERT INTO "projectUsers" ("projectID", "userID", "role")
+				SELECT "projectID", "userID", 'admin' FROM "projectAdmins"
+				ON CONFLICT DO NOTHING;
+				DROP TABLE "projectAdmins";
+			END IF;
+
+			IF to_regclass('"projectMembers"') IS NOT NULL THEN
+				INSERT INTO "projectUsers" ("projectID", "userID", "role")
+				SELECT "projectID", "userID", 'member' FROM "projectMembers"
+				ON CONFLICT DO NOTHING;
+				DROP TABLE "projectMembers";
+			END IF;
+		END $$;
 
 		DROP TRIGGER IF EXISTS update_projects_updated_at on "public"."projects";
         CREATE TRIGGER update_projects_updated_at
@@ -233,6 +471,53 @@ func setup() (err error) {
 		return errors.Wrap(err, "error creating project table")
 	}
 
+	// owner is not stored among project users, it is the creator of the project
+	if _, err = transaction.Exec(ctx, fmt.Sprintf(`
+		ALTER TABLE "projectUsers" DROP CONSTRAINT IF EXISTS "projectUsers_role_check";
+		ALTER TABLE "projectUsers" ADD CONSTRAINT "projectUsers_role_check" CHECK ("role" IN ('%s', '%s', '%s', '%s'));
+	`, types.ProjectRoleAdmin, types.ProjectRoleMember, types.ProjectRoleCommenter, types.ProjectRoleViewer)); err != nil {
+		return errors.Wrap(err, "error constraining project user roles")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "projectInvitations" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "projectID" VARCHAR(255) NOT NULL REFERENCES "projects"("id") ON DELETE CASCADE,
+		    "email" VARCHAR(255) NOT NULL,
+		    "inviteeID" VARCHAR(255) REFERENCES "users"("id") ON DELETE CASCADE,
+		    "inviterID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "role" VARCHAR(32) NOT NULL,
+		    "status" VARCHAR(32) NOT NULL DEFAULT 'pending',
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL,
+		    "respondedAt" TIMESTAMP
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_project_invitations_pending ON "projectInvitations"("projectID", LOWER("email")) WHERE "status" = 'pending';
+		CREATE INDEX IF NOT EXISTS idx_project_invitations_email ON "projectInvitations"(LOWER("email"));
+		CREATE INDEX IF NOT EXISTS idx_project_invitations_invitee ON "projectInvitations"("inviteeID");
+	`); err != nil {
+		return errors.Wrap(err, "error creating projectInvitations table")
+	}
+
+	if _, err = transaction.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS "ownershipTransfers" (
+		    "id" VARCHAR(255) PRIMARY KEY,
+		    "projectID" VARCHAR(255) NOT NULL REFERENCES "projects"("id") ON DELETE CASCADE,
+		    "fromUserID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "toUserID" VARCHAR(255) NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+		    "status" VARCHAR(32) NOT NULL DEFAULT 'pending',
+		    "createdAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		    "expiresAt" TIMESTAMP NOT NULL,
+		    "respondedAt" TIMESTAMP
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_ownership_transfers_pending ON "ownershipTransfers"("projectID") WHERE "status" = 'pending';
+		CREATE INDEX IF NOT EXISTS idx_ownership_transfers_to_user ON "ownershipTransfers"("toUserID");
+	`); err != nil {
+		return errors.Wrap(err, "error creating projectTransfers table")
+	}
+
 	if _, err = transaction.Exec(ctx, `
 		DO $$ BEGIN
 			CREATE TYPE "specialTags" AS ENUM ('TODO', 'IN_PROGRESS', 'TESTING', 'COMPLETED'); 
@@ -262,7 +547,10 @@ func setup() (err error) {
 		    "labelID" VARCHAR(255) REFERENCES "kanbanColumnLabels"("id")
 		);
 
+		ALTER TABLE "kanbanColumns" ADD COLUMN IF NOT EXISTS "deletedAt" TIMESTAMP;
+
 		CREATE INDEX IF NOT EXISTS idx_kanban_columns_project ON "kanbanColumns"("projectID");
+		CREATE INDEX IF NOT EXISTS idx_kanban_columns_deleted ON "kanbanColumns"("deletedAt") WHERE "deletedAt" IS NOT NULL;
 	`); err != nil {
 		return errors.Wrap(err, "error creating kanbanColumns table")
 	}
@@ -301,7 +589,10 @@ func setup() (err error) {
 			"dueDate" TIMESTAMP
 		);
 
+		ALTER TABLE "kanbanRows" ADD COLUMN IF NOT EXISTS "deletedAt" TIMESTAMP;
+
 		CREATE INDEX IF NOT EXISTS idx_kanban_rows_column ON "kanbanRows"("columnID");
+		CREATE INDEX IF NOT EXISTS idx_kanban_rows_deleted ON "kanbanRows"("deletedAt") WHERE "deletedAt" IS NOT NULL;
 
 		CREATE TABLE IF NOT EXISTS "kanbanRowAssignees" (
 		    "rowID" VARCHAR(255) REFERENCES "kanbanRows"("id") ON DELETE CASCADE,
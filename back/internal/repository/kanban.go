@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/finkabaj/squid/back/internal/types"
 	"github.com/finkabaj/squid/back/internal/utils"
@@ -23,41 +24,197 @@ func CreateProject(ctx context.Context, id *string, creatorID *string, project *
     	`, id, creatorID, project.Name, project.Description)
 
 		var newProject types.Project
-		err := row.Scan(&newProject.ID, &newProject.CreatorID, &newProject.Name, &newProject.Description, &newProject.CreatedAt, &newProject.UpdatedAt)
+		err := row.Scan(&newProject.ID, &newProject.CreatorID, &newProject.Name, &newProject.Description, &newProject.CreatedAt, &newProject.UpdatedAt, &newProject.ArchivedAt, &newProject.DeletedAt, &newProject.IsTemplate)
 		if err != nil {
 			return types.Project{}, errors.WithStack(err)
 		}
 
-		if len(project.AdminIDs) > 0 {
-			adminRows := make([][]any, len(project.AdminIDs))
+		for i := range project.Invitations {
+			project.Invitations[i].ProjectID = newProject.ID
 
-			for i, userID := range project.AdminIDs {
-				adminRows[i] = []any{
-					newProject.ID, userID,
-				}
+			project.Invitations[i], err = upsertInvitationTx(ctx, tx, &project.Invitations[i])
+			if err != nil {
+				return types.Project{}, errors.WithStack(err)
 			}
+		}
 
-			if err = bulkInsert(ctx, tx, "projectAdmins", []string{"projectID", "userID"}, adminRows); err != nil {
-				return types.Project{}, errors.WithStack(err)
+		return newProject, nil
+	})
+}
+
+// CloneProject copies the source project with its labels and columns into a new project in one transaction, rows,
+// checklists, assignments and invitations of the members are copied as the clone asks for. Everything copied gets
+// a new id, the ids are mapped through a temporary table so that each table is copied by a single statement
+func CloneProject(ctx context.Context, clone *types.ProjectClone) (types.Project, error) {
+	if clone == nil {
+		return types.Project{}, errors.New("clone must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.Project, error) {
+		row := tx.QueryRow(ctx, `
+            INSERT INTO "projects" ("id", "creatorID", "name", "description", "isTemplate")
+            SELECT $1, $2, $3, COALESCE($4, "description"), $5 FROM "projects" WHERE "id" = $6
+            RETURNING *
+        `, clone.ID, clone.CreatorID, clone.Name, clone.Description, clone.IsTemplate, clone.SourceID)
+
+		var newProject types.Project
+		err := row.Scan(&newProject.ID, &newProject.CreatorID, &newProject.Name, &newProject.Description, &newProject.CreatedAt, &newProject.UpdatedAt, &newProject.ArchivedAt, &newProject.DeletedAt, &newProject.IsTemplate)
+		if err != nil {
+			return types.Project{}, errors.WithStack(err)
+		}
+
+		newProject.Users = []types.ProjectUser{}
+
+		if _, err = tx.Exec(ctx, `
+            CREATE TEMPORARY TABLE "cloneIDs" (
+                "oldID" VARCHAR(255) PRIMARY KEY,
+                "newID" VARCHAR(255) NOT NULL
+            ) ON COMMIT DROP
+        `); err != nil {
+			return types.Project{}, errors.WithStack(err)
+		}
+
+		exec := func(query string, args ...any) error {
+			_, err := tx.Exec(ctx, query, args...)
+			return errors.WithStack(err)
+		}
+
+		if err = exec(`
+            INSERT INTO "cloneIDs" ("oldID", "newID")
+            SELECT "id", gen_random_uuid()::TEXT FROM "kanbanColumnLabels" WHERE "projectID" = $1
+            UNION ALL SELECT "id", gen_random_uuid()::TEXT FROM "kanbanRowLabels" WHERE "projectID" = $1
+            UNION ALL SELECT "id", gen_random_uuid()::TEXT FROM "kanbanColumns" WHERE "projectID" = $1 AND "deletedAt" IS NULL
+        `, clone.SourceID); err != nil {
+			return types.Project{}, err
+		}
+
+		if err = exec(`
+            INSERT INTO "kanbanColumnLabels" ("id", "projectID", "specialTag", "name", "color")
+            SELECT m."newID", $2, l."specialTag", l."name", l."color"
+            FROM "kanbanColumnLabels" l JOIN "cloneIDs" m ON m."oldID" = l."id"
+            WHERE l."projectID" = $1
+        `, clone.SourceID, newProject.ID); err != nil {
+			return types.Project{}, err
+		}
+
+		if err = exec(`
+            INSERT INTO "kanbanRowLabels" ("id", "projectID", "name", "color")
+            SELECT m."newID", $2, l."name", l."color"
+            FROM "kanbanRowLabels" l JOIN "cloneIDs" m ON m."oldID" = l."id"
+            WHERE l."projectID" = $1
+        `, clone.SourceID, newProject.ID); err != nil {
+			return types.Project{}, err
+		}
+
+		if err = exec(`
+            INSERT INTO "kanbanColumns" ("id", "projectID", "name", "order", "labelID")
+            SELECT m."newID", $2, c."name", c."order", lm."newID"
+            FROM "kanbanColumns" c JOIN "cloneIDs" m ON m."oldID" = c."id"
+            LEFT JOIN "cloneIDs" lm ON lm."oldID" = c."labelID"
+            WHERE c."projectID" = $1
+        `, clone.SourceID, newProject.ID); err != nil {
+			return types.Project{}, err
+		}
+
+		if clone.IncludeRows {
+			// ids of rows are mapped before the ids of their comment sections, which are found through the mapped rows
+			if err = exec(`
+                INSERT INTO "cloneIDs" ("oldID", "newID")
+                SELECT r."id", gen_random_uuid()::TEXT
+                FROM "kanbanRows" r JOIN "kanbanColumns" c ON c."id" = r."columnID"
+                WHERE c."projectID" = $1 AND c."deletedAt" IS NULL AND r."deletedAt" IS NULL
+            `, clone.SourceID); err != nil {
+				return types.Project{}, err
+			}
+
+			if err = exec(`
+                INSERT INTO "cloneIDs" ("oldID", "newID")
+                SELECT s."id", gen_random_uuid()::TEXT FROM "commentSections" s JOIN "cloneIDs" m ON m."oldID" = s."rowID"
+            `); err != nil {
+				return types.Project{}, err
 			}
 
-			newProject.AdminIDs = project.AdminIDs
+			if err = exec(`
+                INSERT INTO "kanbanRows" ("id", "columnID", "name", "description", "order", "creatorID", "priority", "labelID", "dueDate")
+                SELECT m."newID", cm."newID", r."name", r."description", r."order", $1, r."priority", lm."newID", r."dueDate"
+                FROM "kanbanRows" r JOIN "cloneIDs" m ON m."oldID" = r."id"
+                JOIN "cloneIDs" cm ON cm."oldID" = r."columnID"
+                LEFT JOIN "cloneIDs" lm ON lm."oldID" = r."labelID"
+            `, newProject.CreatorID); err != nil {
+				return types.Project{}, err
+			}
+
+			if err = exec(`
+                INSERT INTO "commentSections" ("id", "rowID", "canComment")
+                SELECT m."newID", rm."newID", s."canComment"
+                FROM "commentSections" s JOIN "cloneIDs" m ON m."oldID" = s."id"
+                JOIN "cloneIDs" rm ON rm."oldID" = s."rowID"
+            `); err != nil {
+				return types.Project{}, err
+			}
 		}
 
-		if len(project.MemberIDs) > 0 {
-			memberRows := make([][]any, len(project.MemberIDs))
+		if clone.IncludeAssignments {
+			if err = exec(`
+                INSERT INTO "kanbanRowAssignees" ("rowID", "userID")
+                SELECT rm."newID", a."userID"
+                FROM "kanbanRowAssignees" a JOIN "cloneIDs" rm ON rm."oldID" = a."rowID"
+                WHERE a."userID" = $1
+            `, newProject.CreatorID); err != nil {
+				return types.Project{}, err
+			}
+		}
 
-			for i, userID := range project.MemberIDs {
-				memberRows[i] = []any{
-					newProject.ID, userID,
-				}
+		if clone.IncludeChecklists {
+			if err = exec(`
+                INSERT INTO "cloneIDs" ("oldID", "newID")
+                SELECT cl."id", gen_random_uuid()::TEXT FROM "checklists" cl JOIN "cloneIDs" m ON m."oldID" = cl."rowID"
+            `); err != nil {
+				return types.Project{}, err
 			}
 
-			if err = bulkInsert(ctx, tx, "projectMembers", []string{"projectID", "userID"}, memberRows); err != nil {
-				return types.Project{}, errors.WithStack(err)
+			if err = exec(`
+                INSERT INTO "cloneIDs" ("oldID", "newID")
+                SELECT p."id", gen_random_uuid()::TEXT FROM "points" p JOIN "cloneIDs" m ON m."oldID" = p."checklistID"
+            `); err != nil {
+				return types.Project{}, err
+			}
+
+			if err = exec(`
+                INSERT INTO "checklists" ("id", "rowID")
+                SELECT m."newID", rm."newID"
+                FROM "checklists" cl JOIN "cloneIDs" m ON m."oldID" = cl."id"
+                JOIN "cloneIDs" rm ON rm."oldID" = cl."rowID"
+            `); err != nil {
+				return types.Project{}, err
+			}
+
+			if err = exec(`
+                INSERT INTO "points" ("id", "checklistID", "name", "description")
+                SELECT m."newID", cm."newID", p."name", p."description"
+                FROM "points" p JOIN "cloneIDs" m ON m."oldID" = p."id"
+                JOIN "cloneIDs" cm ON cm."oldID" = p."checklistID"
+            `); err != nil {
+				return types.Project{}, err
 			}
+		}
 
-			newProject.MembersIDs = project.MemberIDs
+		if !clone.IncludeMembers {
+			return newProject, nil
+		}
+
+		clone.Invitations, err = queryReturningTx[types.ProjectInvitation](ctx, tx, `
+            INSERT INTO "projectInvitations" ("id", "projectID", "email", "inviteeID", "inviterID", "role", "expiresAt")
+            SELECT gen_random_uuid()::TEXT, $2, u."email", u."id", $3, m."role", $4
+            FROM (
+                SELECT "userID", "role" FROM "projectUsers" WHERE "projectID" = $1
+                UNION SELECT "creatorID", $5 FROM "projects" WHERE "id" = $1
+            ) m JOIN "users" u ON u."id" = m."userID"
+            WHERE u."id" <> $3 AND u."id" <> $6
+            RETURNING *
+        `, clone.SourceID, newProject.ID, newProject.CreatorID, clone.InvitationsExpireAt, types.ProjectRoleAdmin, types.DeletedUserID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return types.Project{}, err
 		}
 
 		return newProject, nil
@@ -69,12 +226,9 @@ func GetProjectUsers(ctx context.Context, id *string, creatorID *string) (types.
 		return types.ProjectUsers{}, errors.New("Id must not be nil")
 	}
 
-	admins, err := queryReturning[types.User](ctx, `SELECT u.* FROM "users" u WHERE u."id" IN (SELECT "userID" FROM "projectAdmins" WHERE "projectID" = $1)`, id)
-	if err != nil {
-		return types.ProjectUsers{}, errors.WithStack(err)
-	}
-
-	members, err := queryReturning[types.User](ctx, `SELECT u.* FROM "users" u WHERE u."id" IN (SELECT "userID" FROM "projectMembers" WHERE "projectID" = $1)`, id)
+	users, err := queryReturning[types.ProjectUserDetails](ctx, `
+        SELECT u.*, pu."role" FROM "users" u JOIN "projectUsers" pu ON pu."userID" = u."id" WHERE pu."projectID" = $1
+    `, id)
 	if err != nil {
 		return types.ProjectUsers{}, errors.WithStack(err)
 	}
@@ -85,9 +239,9 @@ func GetProjectUsers(ctx context.Context, id *string, creatorID *string) (types.
 	}
 
 	return types.ProjectUsers{
-		Admins:  admins,
-		Members: members,
-		Creator: creator,
+		Creator:     creator,
+		Users:       users,
+		Permissions: types.ProjectRolePermissions,
 	}, nil
 }
 
@@ -100,33 +254,19 @@ func GetProject(ctx context.Context, id *string) (types.Project, error) {
 		row := tx.QueryRow(ctx, `SELECT * FROM "projects" WHERE id = $1`, id)
 
 		var project types.Project
-		err := row.Scan(&project.ID, &project.CreatorID, &project.Name, &project.Description, &project.CreatedAt, &project.UpdatedAt)
+		err := row.Scan(&project.ID, &project.CreatorID, &project.Name, &project.Description, &project.CreatedAt, &project.UpdatedAt, &project.ArchivedAt, &project.DeletedAt, &project.IsTemplate)
 		if errors.Is(err, pgx.ErrNoRows) {
 			return types.Project{}, err
 		} else if err != nil {
 			return types.Project{}, errors.Wrap(err, "error getting project")
 		}
 
-		admins, err := queryReturning[types.ProjectAdmin](ctx, `SELECT * FROM "projectAdmins" WHERE "projectID" = $1`, id)
+		project.Users, err = queryReturning[types.ProjectUser](ctx, `SELECT * FROM "projectUsers" WHERE "projectID" = $1`, id)
 
 		if err != nil {
 			return types.Project{}, errors.WithStack(err)
 		}
 
-		project.AdminIDs = utils.Map(func(i int, admin types.ProjectAdmin) string {
-			return admin.UserID
-		}, admins)
-
-		members, err := queryReturning[types.ProjectMember](ctx, `SELECT * FROM "projectMembers" WHERE "projectID" = $1`, id)
-
-		if err != nil {
-			return types.Project{}, errors.WithStack(err)
-		}
-
-		project.MembersIDs = utils.Map(func(i int, member types.ProjectMember) string {
-			return member.UserID
-		}, members)
-
 		return project, nil
 	})
 }
@@ -145,97 +285,574 @@ func UpdateProject(ctx context.Context, id *string, updateProject *types.UpdateP
             `, updateProject.Name, updateProject.Description, id)
 
 		var project types.Project
-		err := row.Scan(&project.ID, &project.CreatorID, &project.Name, &project.Description, &project.CreatedAt, &project.UpdatedAt)
+		err := row.Scan(&project.ID, &project.CreatorID, &project.Name, &project.Description, &project.CreatedAt, &project.UpdatedAt, &project.ArchivedAt, &project.DeletedAt, &project.IsTemplate)
 		if err != nil {
 			return types.Project{}, errors.WithStack(err)
 		}
 
 		if updateProject.AdminEmails != nil {
-			_, err = queryOneReturningTx[any](ctx, tx, `DELETE FROM "projectAdmins" WHERE "projectID"=$1`, id)
+			if err = setProjectRoleTx(ctx, tx, id, types.ProjectRoleAdmin, updateProject.AdminIDs); err != nil {
+				return types.Project{}, err
+			}
+		}
 
-			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		for i := range updateProject.Invitations {
+			updateProject.Invitations[i], err = upsertInvitationTx(ctx, tx, &updateProject.Invitations[i])
+			if err != nil {
 				return types.Project{}, errors.WithStack(err)
 			}
+		}
 
-			if len(updateProject.AdminIDs) > 0 {
-				adminRows := make([][]any, len(updateProject.AdminIDs))
+		if updateProject.MemberEmails != nil {
+			if err = setProjectRoleTx(ctx, tx, id, types.ProjectRoleMember, updateProject.MembersIDs); err != nil {
+				return types.Project{}, err
+			}
+		}
 
-				for i, userID := range updateProject.AdminIDs {
-					adminRows[i] = []any{
-						project.ID, userID,
-					}
-				}
+		project.Users, err = queryReturningTx[types.ProjectUser](ctx, tx, `SELECT * FROM "projectUsers" WHERE "projectID" = $1`, id)
+		if err != nil {
+			return types.Project{}, errors.WithStack(err)
+		}
 
-				if err = bulkInsert(ctx, tx, "projectAdmins", []string{"projectID", "userID"}, adminRows); err != nil {
-					return types.Project{}, errors.WithStack(err)
-				}
+		return project, nil
+	})
+}
 
-				project.AdminIDs = updateProject.AdminIDs
-			}
-		} else {
-			admins, err := queryReturning[types.ProjectAdmin](ctx, `SELECT * FROM "projectAdmins" WHERE "projectID" = $1`, id)
+// TrashProject moves the project to trash, returns pgx.ErrNoRows when it already is there
+func TrashProject(ctx context.Context, projectID *string) error {
+	if projectID == nil {
+		return errors.New("projectID must not be nil")
+	}
 
-			if err != nil {
-				return types.Project{}, errors.WithStack(err)
-			}
+	tag, err := pool.Exec(ctx, `
+        UPDATE "projects" SET "deletedAt" = CURRENT_TIMESTAMP WHERE "id" = $1 AND "deletedAt" IS NULL
+    `, projectID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// RestoreProject takes the project out of trash, returns pgx.ErrNoRows when it is not there
+func RestoreProject(ctx context.Context, projectID *string) error {
+	if projectID == nil {
+		return errors.New("projectID must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `
+        UPDATE "projects" SET "deletedAt" = NULL WHERE "id" = $1 AND "deletedAt" IS NOT NULL
+    `, projectID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
 
-			project.AdminIDs = utils.Map(func(i int, admin types.ProjectAdmin) string {
-				return admin.UserID
-			}, admins)
+// SetProjectArchived archives or unarchives the project, returns pgx.ErrNoRows when it already is in that state
+func SetProjectArchived(ctx context.Context, projectID *string, archived bool) error {
+	if projectID == nil {
+		return errors.New("projectID must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `
+        UPDATE "projects" SET "archivedAt" = CASE WHEN $2 THEN CURRENT_TIMESTAMP END
+        WHERE "id" = $1 AND ("archivedAt" IS NULL) = $2
+    `, projectID, archived)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// PurgeTrash deletes projects, columns and rows that have been in trash for more than retentionDays, along with
+// everything that belongs to them
+func PurgeTrash(ctx context.Context, retentionDays int) error {
+	_, err := withTx(ctx, func(tx pgx.Tx) (any, error) {
+		if _, err := tx.Exec(ctx, `
+            DELETE FROM "kanbanRows" WHERE "deletedAt" < CURRENT_TIMESTAMP - make_interval(days => $1)
+        `, retentionDays); err != nil {
+			return nil, errors.WithStack(err)
 		}
 
-		if updateProject.MemberEmails != nil {
-			_, err = queryOneReturningTx[any](ctx, tx, `DELETE FROM "projectMembers" WHERE "projectID"=$1`, id)
+		if _, err := tx.Exec(ctx, `
+            DELETE FROM "kanbanColumns" WHERE "deletedAt" < CURRENT_TIMESTAMP - make_interval(days => $1)
+        `, retentionDays); err != nil {
+			return nil, errors.WithStack(err)
+		}
 
-			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-				return types.Project{}, errors.WithStack(err)
-			}
+		_, err := tx.Exec(ctx, `
+            DELETE FROM "projects" WHERE "deletedAt" < CURRENT_TIMESTAMP - make_interval(days => $1)
+        `, retentionDays)
 
-			if len(updateProject.MembersIDs) > 0 {
-				memberRows := make([][]any, len(updateProject.MembersIDs))
+		return nil, errors.WithStack(err)
+	})
 
-				for i, userID := range updateProject.MembersIDs {
-					memberRows[i] = []any{
-						project.ID, userID,
-					}
-				}
+	return errors.WithStack(err)
+}
 
-				if err = bulkInsert(ctx, tx, "projectMembers", []string{"projectID", "userID"}, memberRows); err != nil {
-					return types.Project{}, errors.WithStack(err)
-				}
+// resourceProjectQueries select id of the project the resource with id $1 belongs to and whether the resource,
+// its row or its column is in trash
+var resourceProjectQueries = map[types.ProjectResource]string{
+	types.ProjectResourceProject:     `SELECT "id" AS "projectID", FALSE AS "trashed" FROM "projects" WHERE "id" = $1`,
+	types.ProjectResourceColumn:      `SELECT "projectID", "deletedAt" IS NOT NULL AS "trashed" FROM "kanbanColumns" WHERE "id" = $1`,
+	types.ProjectResourceColumnLabel: `SELECT "projectID", FALSE AS "trashed" FROM "kanbanColumnLabels" WHERE "id" = $1`,
+	types.ProjectResourceRow: `
+        SELECT c."projectID", r."deletedAt" IS NOT NULL OR c."deletedAt" IS NOT NULL AS "trashed" FROM "kanbanRows" r
+        JOIN "kanbanColumns" c ON c."id" = r."columnID"
+        WHERE r."id" = $1`,
+	types.ProjectResourceRowLabel: `SELECT "projectID", FALSE AS "trashed" FROM "kanbanRowLabels" WHERE "id" = $1`,
+	types.ProjectResourceChecklist: `
+        SELECT c."projectID", r."deletedAt" IS NOT NULL OR c."deletedAt" IS NOT NULL AS "trashed" FROM "checklists" cl
+        JOIN "kanbanRows" r ON r."id" = cl."rowID"
+        JOIN "kanbanColumns" c ON c."id" = r."columnID"
+        WHERE cl."id" = $1`,
+	types.ProjectResourcePoint: `
+        SELECT c."projectID", r."deletedAt" IS NOT NULL OR c."deletedAt" IS NOT NULL AS "trashed" FROM "points" p
+        JOIN "checklists" cl ON cl."id" = p."checklistID"
+        JOIN "kanbanRows" r ON r."id" = cl."rowID"
+        JOIN "kanbanColumns" c ON c."id" = r."columnID"
+        WHERE p."id" = $1`,
+	types.ProjectResourceCommentSection: `
+        SELECT c."projectID", r."deletedAt" IS NOT NULL OR c."deletedAt" IS NOT NULL AS "trashed" FROM "commentSections" cs
+        JOIN "kanbanRows" r ON r."id" = cs."rowID"
+        JOIN "kanbanColumns" c ON c."id" = r."columnID"
+        WHERE cs."id" = $1`,
+	types.ProjectResourceComment: `
+        SELECT c."projectID", r."deletedAt" IS NOT NULL OR c."deletedAt" IS NOT NULL AS "trashed" FROM "comments" cm
+        JOIN "commentSections" cs ON cs."id" = cm."commentSectionID"
+        JOIN "kanbanRows" r ON r."id" = cs."rowID"
+        JOIN "kanbanColumns" c ON c."id" = r."columnID"
+        WHERE cm."id" = $1`,
+	types.ProjectResourceInvitation: `SELECT "projectID", FALSE AS "trashed" FROM "projectInvitations" WHERE "id" = $1`,
+}
 
-				project.MembersIDs = updateProject.MembersIDs
-			}
-		} else {
-			members, err := queryReturning[types.ProjectMember](ctx, `SELECT * FROM "projectMembers" WHERE "projectID" = $1`, id)
+// GetProjectAccess resolves the resource to the project it belongs to, role of the user in it and state of the
+// project with one query, returns pgx.ErrNoRows when the resource does not exist
+func GetProjectAccess(ctx context.Context, resource types.ProjectResource, resourceID *string, userID *string) (types.ProjectAccess, error) {
+	if resourceID == nil || userID == nil {
+		return types.ProjectAccess{}, errors.New("resourceID and userID must not be nil")
+	}
 
-			if err != nil {
-				return types.Project{}, errors.WithStack(err)
-			}
+	resourceQuery, ok := resourceProjectQueries[resource]
+	if !ok {
+		return types.ProjectAccess{}, errors.Errorf("unknown resource %q", resource)
+	}
+
+	return queryOneReturning[types.ProjectAccess](ctx, `
+        WITH "resource" AS (`+resourceQuery+`)
+        SELECT p."id" AS "projectID", p."creatorID",
+            CASE WHEN p."creatorID" = $2 THEN 'owner' ELSE COALESCE(pu."role", '') END AS "role",
+            p."archivedAt" IS NOT NULL AS "archived",
+            "resource"."trashed" OR p."deletedAt" IS NOT NULL AS "trashed"
+        FROM "resource"
+        JOIN "projects" p ON p."id" = "resource"."projectID"
+        LEFT JOIN "projectUsers" pu ON pu."projectID" = p."id" AND pu."userID" = $2
+    `, resourceID, userID)
+}
 
-			project.MembersIDs = utils.Map(func(i int, member types.ProjectMember) string {
-				return member.UserID
-			}, members)
+// upsertInvitationTx creates the invitation, pending invitation of the same email to the project is renewed instead
+func upsertInvitationTx(ctx context.Context, tx pgx.Tx, invitation *types.ProjectInvitation) (types.ProjectInvitation, error) {
+	return queryOneReturningTx[types.ProjectInvitation](ctx, tx, `
+        INSERT INTO "projectInvitations" ("id", "projectID", "email", "inviteeID", "inviterID", "role", "expiresAt")
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT ("projectID", LOWER("email")) WHERE "status" = 'pending'
+        DO UPDATE SET "inviteeID" = EXCLUDED."inviteeID", "inviterID" = EXCLUDED."inviterID", "role" = EXCLUDED."role",
+            "createdAt" = CURRENT_TIMESTAMP, "expiresAt" = EXCLUDED."expiresAt"
+        RETURNING *
+    `, invitation.ID, invitation.ProjectID, invitation.Email, invitation.InviteeID, invitation.InviterID, invitation.Role, invitation.ExpiresAt)
+}
+
+func CreateProjectInvitation(ctx context.Context, invitation *types.ProjectInvitation) (types.ProjectInvitation, error) {
+	if invitation == nil {
+		return types.ProjectInvitation{}, errors.New("invitation must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.ProjectInvitation, error) {
+		return upsertInvitationTx(ctx, tx, invitation)
+	})
+}
+
+func GetProjectInvitation(ctx context.Context, id *string) (types.ProjectInvitation, error) {
+	if id == nil {
+		return types.ProjectInvitation{}, errors.New("id must not be nil")
+	}
+
+	return queryOneReturning[types.ProjectInvitation](ctx, `SELECT * FROM "projectInvitations" WHERE "id" = $1`, id)
+}
+
+// GetProjectInvitations returns invitations to the project that can still be accepted
+func GetProjectInvitations(ctx context.Context, projectID *string) ([]types.ProjectInvitation, error) {
+	if projectID == nil {
+		return nil, errors.New("projectID must not be nil")
+	}
+
+	return queryReturning[types.ProjectInvitation](ctx, `
+        SELECT * FROM "projectInvitations"
+        WHERE "projectID" = $1 AND "status" = 'pending' AND "expiresAt" > CURRENT_TIMESTAMP
+        ORDER BY "createdAt" DESC
+    `, projectID)
+}
+
+// GetReceivedInvitations returns invitations of the user that can still be accepted, invitations sent to the
+// email before the user registered are included
+func GetReceivedInvitations(ctx context.Context, userID *string, email *string) ([]types.ReceivedProjectInvitation, error) {
+	if userID == nil || email == nil {
+		return nil, errors.New("userID and email must not be nil")
+	}
+
+	return queryReturning[types.ReceivedProjectInvitation](ctx, `
+        SELECT i.*, p."name" AS "projectName", u."username" AS "inviterUsername"
+        FROM "projectInvitations" i
+        JOIN "projects" p ON p."id" = i."projectID"
+        JOIN "users" u ON u."id" = i."inviterID"
+        WHERE ("inviteeID" = $1 OR ("inviteeID" IS NULL AND LOWER(i."email") = LOWER($2)))
+            AND i."status" = 'pending' AND i."expiresAt" > CURRENT_TIMESTAMP
+        ORDER BY i."createdAt" DESC
+    `, userID, email)
+}
+
+func DeleteProjectInvitation(ctx context.Context, id *string) error {
+	if id == nil {
+		return errors.New("id must not be nil")
+	}
+
+	_, err := pool.Exec(ctx, `DELETE FROM "projectInvitations" WHERE "id" = $1`, id)
+
+	return errors.WithStack(err)
+}
+
+// respondToInvitationTx marks pending invitation that has not expired as accepted or declined by the user,
+// returns pgx.ErrNoRows otherwise
+func respondToInvitationTx(ctx context.Context, tx pgx.Tx, id *string, userID *string, status types.InvitationStatus) (types.ProjectInvitation, error) {
+	return queryOneReturningTx[types.ProjectInvitation](ctx, tx, `
+        UPDATE "projectInvitations"
+        SET "status" = $3, "inviteeID" = $2, "respondedAt" = CURRENT_TIMESTAMP
+        WHERE "id" = $1 AND "status" = 'pending' AND "expiresAt" > CURRENT_TIMESTAMP
+        RETURNING *
+    `, id, userID, status)
+}
+
+// addProjectUserTx adds the user to the project with the role, users already part of the project keep their role
+func addProjectUserTx(ctx context.Context, tx pgx.Tx, projectID *string, userID *string, role types.ProjectRole) error {
+	_, err := tx.Exec(ctx, `
+        INSERT INTO "projectUsers" ("projectID", "userID", "role")
+        SELECT $1, $2, $3
+        WHERE NOT EXISTS (SELECT 1 FROM "projects" WHERE "id" = $1 AND "creatorID" = $2)
+        ON CONFLICT DO NOTHING
+    `, projectID, userID, role)
+
+	return errors.WithStack(err)
+}
+
+// setProjectRoleTx makes the users the only ones with the role in the project, others having it leave the project
+func setProjectRoleTx(ctx context.Context, tx pgx.Tx, projectID *string, role types.ProjectRole, userIDs []string) error {
+	if userIDs == nil {
+		userIDs = []string{}
+	}
+
+	if _, err := tx.Exec(ctx, `
+        DELETE FROM "projectUsers" WHERE "projectID" = $1 AND "role" = $2 AND NOT ("userID" = ANY($3))
+    `, projectID, role, userIDs); err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err := tx.Exec(ctx, `
+        INSERT INTO "projectUsers" ("projectID", "userID", "role")
+        SELECT $1, UNNEST($3::VARCHAR[]), $2
+        ON CONFLICT ("projectID", "userID") DO UPDATE SET "role" = EXCLUDED."role"
+    `, projectID, role, userIDs)
+
+	return errors.WithStack(err)
+}
+
+// SetProjectUserRole changes role of the user in the project, returns pgx.ErrNoRows when they are not part of it
+func SetProjectUserRole(ctx context.Context, projectID *string, userID *string, role types.ProjectRole) (types.ProjectUser, error) {
+	if projectID == nil || userID == nil {
+		return types.ProjectUser{}, errors.New("projectID and userID must not be nil")
+	}
+
+	return queryOneReturning[types.ProjectUser](ctx, `
+        UPDATE "projectUsers" SET "role" = $3 WHERE "projectID" = $1 AND "userID" = $2 RETURNING *
+    `, projectID, userID, role)
+}
+
+// AcceptProjectInvitation adds the user to the project of the invitation, returns pgx.ErrNoRows when the invitation
+// is no longer pending or has expired
+func AcceptProjectInvitation(ctx context.Context, id *string, userID *string) (types.ProjectInvitation, error) {
+	if id == nil || userID == nil {
+		return types.ProjectInvitation{}, errors.New("id and userID must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.ProjectInvitation, error) {
+		invitation, err := respondToInvitationTx(ctx, tx, id, userID, types.InvitationAccepted)
+		if err != nil {
+			return invitation, err
 		}
 
-		return project, nil
+		return invitation, addProjectUserTx(ctx, tx, &invitation.ProjectID, userID, invitation.Role)
+	})
+}
+
+// DeclineProjectInvitation returns pgx.ErrNoRows when the invitation is no longer pending or has expired
+func DeclineProjectInvitation(ctx context.Context, id *string, userID *string) (types.ProjectInvitation, error) {
+	if id == nil || userID == nil {
+		return types.ProjectInvitation{}, errors.New("id and userID must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.ProjectInvitation, error) {
+		return respondToInvitationTx(ctx, tx, id, userID, types.InvitationDeclined)
+	})
+}
+
+// AcceptPendingInvitations accepts every invitation sent to the email before anyone registered with it on behalf
+// of the user, so people invited before they registered join the projects once they do. Invitations addressed to
+// a registered user are left for them to answer
+func AcceptPendingInvitations(ctx context.Context, userID *string, email *string) ([]types.ProjectInvitation, error) {
+	if userID == nil || email == nil {
+		return nil, errors.New("userID and email must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) ([]types.ProjectInvitation, error) {
+		invitations, err := queryReturningTx[types.ProjectInvitation](ctx, tx, `
+            UPDATE "projectInvitations"
+            SET "status" = 'accepted', "inviteeID" = $1, "respondedAt" = CURRENT_TIMESTAMP
+            WHERE LOWER("email") = LOWER($2) AND "inviteeID" IS NULL
+                AND "status" = 'pending' AND "expiresAt" > CURRENT_TIMESTAMP
+            RETURNING *
+        `, userID, email)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, invitation := range invitations {
+			if err = addProjectUserTx(ctx, tx, &invitation.ProjectID, userID, invitation.Role); err != nil {
+				return nil, err
+			}
+		}
+
+		return invitations, nil
 	})
 }
 
-func DeleteProject(ctx context.Context, projectID *string) error {
+// CreateOwnershipTransfer creates the transfer, pending transfer of the project is replaced instead
+func CreateOwnershipTransfer(ctx context.Context, transfer *types.OwnershipTransfer) (types.OwnershipTransfer, error) {
+	if transfer == nil {
+		return types.OwnershipTransfer{}, errors.New("transfer must not be nil")
+	}
+
+	return queryOneReturning[types.OwnershipTransfer](ctx, `
+        INSERT INTO "ownershipTransfers" ("id", "projectID", "fromUserID", "toUserID", "expiresAt")
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT ("projectID") WHERE "status" = 'pending'
+        DO UPDATE SET "id" = EXCLUDED."id", "fromUserID" = EXCLUDED."fromUserID", "toUserID" = EXCLUDED."toUserID",
+            "createdAt" = CURRENT_TIMESTAMP, "expiresAt" = EXCLUDED."expiresAt"
+        RETURNING *
+    `, transfer.ID, transfer.ProjectID, transfer.FromUserID, transfer.ToUserID, transfer.ExpiresAt)
+}
+
+func GetOwnershipTransfer(ctx context.Context, id *string) (types.OwnershipTransfer, error) {
+	if id == nil {
+		return types.OwnershipTransfer{}, errors.New("id must not be nil")
+	}
+
+	return queryOneReturning[types.OwnershipTransfer](ctx, `SELECT * FROM "ownershipTransfers" WHERE "id" = $1`, id)
+}
+
+// GetReceivedOwnershipTransfers returns transfers to the user that can still be accepted
+func GetReceivedOwnershipTransfers(ctx context.Context, userID *string) ([]types.ReceivedOwnershipTransfer, error) {
+	if userID == nil {
+		return nil, errors.New("userID must not be nil")
+	}
+
+	return queryReturning[types.ReceivedOwnershipTransfer](ctx, `
+        SELECT t.*, p."name" AS "projectName", u."username" AS "fromUsername"
+        FROM "ownershipTransfers" t
+        JOIN "projects" p ON p."id" = t."projectID"
+        JOIN "users" u ON u."id" = t."fromUserID"
+        WHERE t."toUserID" = $1 AND t."status" = 'pending' AND t."expiresAt" > CURRENT_TIMESTAMP
+        ORDER BY t."createdAt" DESC
+    `, userID)
+}
+
+// CancelOwnershipTransfer deletes pending transfer of the project, returns pgx.ErrNoRows when there is none
+func CancelOwnershipTransfer(ctx context.Context, projectID *string) (types.OwnershipTransfer, error) {
 	if projectID == nil {
-		return errors.New("projectID must not be nil")
+		return types.OwnershipTransfer{}, errors.New("projectID must not be nil")
 	}
 
-	_, err := queryReturning[any](ctx, `
-    		DELETE FROM "projects" WHERE "id" = $1;
-		`, projectID)
+	return queryOneReturning[types.OwnershipTransfer](ctx, `
+        DELETE FROM "ownershipTransfers" WHERE "projectID" = $1 AND "status" = 'pending' RETURNING *
+    `, projectID)
+}
 
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+// respondToOwnershipTransferTx marks pending transfer to the user that has not expired as accepted or declined,
+// returns pgx.ErrNoRows otherwise
+func respondToOwnershipTransferTx(ctx context.Context, tx pgx.Tx, id *string, userID *string, status types.InvitationStatus) (types.OwnershipTransfer, error) {
+	return queryOneReturningTx[types.OwnershipTransfer](ctx, tx, `
+        UPDATE "ownershipTransfers"
+        SET "status" = $3, "respondedAt" = CURRENT_TIMESTAMP
+        WHERE "id" = $1 AND "toUserID" = $2 AND "status" = 'pending' AND "expiresAt" > CURRENT_TIMESTAMP
+        RETURNING *
+    `, id, userID, status)
+}
+
+// AcceptOwnershipTransfer makes the user owner of the project and previous owner its admin. Returns pgx.ErrNoRows
+// when the transfer is no longer pending, has expired or the project changed hands in the meantime
+func AcceptOwnershipTransfer(ctx context.Context, id *string, userID *string) (types.OwnershipTransfer, error) {
+	if id == nil || userID == nil {
+		return types.OwnershipTransfer{}, errors.New("id and userID must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.OwnershipTransfer, error) {
+		transfer, err := respondToOwnershipTransferTx(ctx, tx, id, userID, types.InvitationAccepted)
+		if err != nil {
+			return transfer, err
+		}
+
+		return transfer, changeProjectOwnerTx(ctx, tx, &transfer.ProjectID, &transfer.FromUserID, &transfer.ToUserID)
+	})
+}
+
+// ReassignProjectOwner makes the user owner of the project and previous owner its admin without asking the user,
+// pending transfer of the project is dropped. Returns pgx.ErrNoRows when the project changed hands in the meantime
+func ReassignProjectOwner(ctx context.Context, projectID *string, fromUserID *string, toUserID *string) error {
+	if projectID == nil || fromUserID == nil || toUserID == nil {
+		return errors.New("all arguments must not be nil")
+	}
+
+	_, err := withTx(ctx, func(tx pgx.Tx) (any, error) {
+		if err := changeProjectOwnerTx(ctx, tx, projectID, fromUserID, toUserID); err != nil {
+			return nil, err
+		}
+
+		_, err := tx.Exec(ctx, `DELETE FROM "ownershipTransfers" WHERE "projectID" = $1 AND "status" = 'pending'`, projectID)
+		return nil, errors.WithStack(err)
+	})
+
+	return err
+}
+
+// changeProjectOwnerTx hands the project over from its owner to the user, previous owner stays as admin.
+// Returns pgx.ErrNoRows when fromUserID no longer owns the project
+func changeProjectOwnerTx(ctx context.Context, tx pgx.Tx, projectID *string, fromUserID *string, toUserID *string) error {
+	tag, err := tx.Exec(ctx, `
+        UPDATE "projects" SET "creatorID" = $2, "updatedAt" = CURRENT_TIMESTAMP WHERE "id" = $1 AND "creatorID" = $3
+    `, projectID, toUserID, fromUserID)
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	// creator is not listed among project users
+	if _, err = tx.Exec(ctx, `DELETE FROM "projectUsers" WHERE "projectID" = $1 AND "userID" = $2`, projectID, toUserID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return addProjectUserTx(ctx, tx, projectID, fromUserID, types.ProjectRoleAdmin)
+}
+
+// DeclineOwnershipTransfer returns pgx.ErrNoRows when the transfer is no longer pending or has expired
+func DeclineOwnershipTransfer(ctx context.Context, id *string, userID *string) (types.OwnershipTransfer, error) {
+	if id == nil || userID == nil {
+		return types.OwnershipTransfer{}, errors.New("id and userID must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) (types.OwnershipTransfer, error) {
+		return respondToOwnershipTransferTx(ctx, tx, id, userID, types.InvitationDeclined)
+	})
+}
+
+// GetAssignedRowIDs returns ids of rows in the project the user is assigned to
+func GetAssignedRowIDs(ctx context.Context, projectID *string, userID *string) ([]string, error) {
+	if projectID == nil || userID == nil {
+		return nil, errors.New("projectID and userID must not be nil")
+	}
+
+	rows, err := pool.Query(ctx, `
+        SELECT a."rowID" FROM "kanbanRowAssignees" a
+        JOIN "kanbanRows" r ON r."id" = a."rowID"
+        JOIN "kanbanColumns" c ON c."id" = r."columnID"
+        WHERE c."projectID" = $1 AND a."userID" = $2
+    `, projectID, userID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	rowIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+
+	return rowIDs, errors.WithStack(err)
+}
+
+// LeaveProject removes the user from the project along with their row assignments in it and pending transfer of
+// the project to them. History points of rows the user was unassigned from are recorded, returns ids of the rows.
+// Returns pgx.ErrNoRows when the user is not part of the project
+func LeaveProject(ctx context.Context, projectID *string, userID *string, historyPoints []types.HistoryPoint) ([]string, error) {
+	if projectID == nil || userID == nil {
+		return nil, errors.New("projectID and userID must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) ([]string, error) {
+		tag, err := tx.Exec(ctx, `DELETE FROM "projectUsers" WHERE "projectID" = $1 AND "userID" = $2`, projectID, userID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return nil, pgx.ErrNoRows
+		}
+
+		rows, err := tx.Query(ctx, `
+            DELETE FROM "kanbanRowAssignees" a
+            USING "kanbanRows" r, "kanbanColumns" c
+            WHERE a."rowID" = r."id" AND r."columnID" = c."id" AND c."projectID" = $1 AND a."userID" = $2
+            RETURNING a."rowID"
+        `, projectID, userID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		rowIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var points [][]any
+		for _, historyPoint := range historyPoints {
+			if slices.Contains(rowIDs, historyPoint.RowID) {
+				points = append(points, []any{historyPoint.ID, historyPoint.RowID, historyPoint.UserID, historyPoint.Text})
+			}
+		}
+
+		if err = bulkInsert(ctx, tx, "historyPoints", []string{"id", "rowID", "userID", "text"}, points); err != nil {
+			return nil, err
+		}
+
+		if _, err = tx.Exec(ctx, `
+            DELETE FROM "ownershipTransfers" WHERE "projectID" = $1 AND "toUserID" = $2 AND "status" = 'pending'
+        `, projectID, userID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return rowIDs, nil
+	})
 }
 
 func CreateKanbanColumn(ctx context.Context, id *string, projectID *string, createColumn *types.CreateKanbanColumn) (types.KanbanColumn, error) {
@@ -252,7 +869,7 @@ func CreateKanbanColumn(ctx context.Context, id *string, projectID *string, crea
 
 		var newColumn types.KanbanColumn
 		var labelID *string
-		err := row.Scan(&newColumn.ID, &newColumn.ProjectID, &newColumn.Name, &newColumn.Order, &labelID)
+		err := row.Scan(&newColumn.ID, &newColumn.ProjectID, &newColumn.Name, &newColumn.Order, &labelID, &newColumn.DeletedAt)
 		if err != nil {
 			return types.KanbanColumn{}, errors.WithStack(err)
 		}
@@ -281,7 +898,7 @@ func GetKanbanColumn(ctx context.Context, id *string) (types.KanbanColumn, error
 
 		var column types.KanbanColumn
 		var labelID *string
-		err := row.Scan(&column.ID, &column.ProjectID, &column.Name, &column.Order, &labelID)
+		err := row.Scan(&column.ID, &column.ProjectID, &column.Name, &column.Order, &labelID, &column.DeletedAt)
 		if errors.Is(err, pgx.ErrNoRows) {
 			return types.KanbanColumn{}, errors.WithStack(err)
 		} else if err != nil {
@@ -325,7 +942,7 @@ func UpdateKanbanColumn(ctx context.Context, updateColumn *types.UpdateKanbanCol
 
 		var updatedColumn types.KanbanColumn
 		var labelID *string
-		err := row.Scan(&updatedColumn.ID, &updatedColumn.ProjectID, &updatedColumn.Name, &updatedColumn.Order, &labelID)
+		err := row.Scan(&updatedColumn.ID, &updatedColumn.ProjectID, &updatedColumn.Name, &updatedColumn.Order, &labelID, &updatedColumn.DeletedAt)
 		if errors.Is(err, pgx.ErrNoRows) {
 			return types.KanbanColumn{}, errors.WithStack(err)
 		} else if err != nil {
@@ -346,7 +963,9 @@ func UpdateKanbanColumn(ctx context.Context, updateColumn *types.UpdateKanbanCol
 	})
 }
 
-func DeleteKanbanColumn(ctx context.Context, id *string) error {
+// TrashKanbanColumn moves the column to trash along with its rows, closing the gap it leaves in the order of
+// the rest of the columns. Returns pgx.ErrNoRows when the column already is in trash
+func TrashKanbanColumn(ctx context.Context, id *string) error {
 	if id == nil {
 		return errors.New("Id must not be nil")
 	}
@@ -355,24 +974,25 @@ func DeleteKanbanColumn(ctx context.Context, id *string) error {
 		var columnOrder int
 		var projectID string
 		err := tx.QueryRow(ctx, `
-            SELECT "order", "projectID" FROM "kanbanColumns" 
-            WHERE id = $1
+            SELECT "order", "projectID" FROM "kanbanColumns"
+            WHERE id = $1 AND "deletedAt" IS NULL
+            FOR UPDATE
         `, id).Scan(&columnOrder, &projectID)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
 		_, err = tx.Exec(ctx, `
-            DELETE FROM "kanbanColumns" WHERE id = $1
+            UPDATE "kanbanColumns" SET "deletedAt" = CURRENT_TIMESTAMP WHERE id = $1
         `, id)
-		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
 		_, err = tx.Exec(ctx, `
-            UPDATE "kanbanColumns" 
+            UPDATE "kanbanColumns"
             SET "order" = "order" - 1
-            WHERE "projectID" = $1 AND "order" > $2
+            WHERE "projectID" = $1 AND "order" > $2 AND "deletedAt" IS NULL
         `, projectID, columnOrder)
 
 		return nil, errors.WithStack(err)
@@ -381,34 +1001,151 @@ func DeleteKanbanColumn(ctx context.Context, id *string) error {
 	return errors.WithStack(err)
 }
 
-func GetProjectsByUserID(ctx context.Context, userID *string) ([]types.Project, error) {
+// RestoreKanbanColumn takes the column out of trash and puts it after the rest of the columns, returns
+// pgx.ErrNoRows when the column is not in trash
+func RestoreKanbanColumn(ctx context.Context, id *string) error {
+	if id == nil {
+		return errors.New("Id must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `
+        UPDATE "kanbanColumns" c
+        SET "deletedAt" = NULL, "order" = (
+            SELECT COUNT(*) + 1 FROM "kanbanColumns"
+            WHERE "projectID" = c."projectID" AND "deletedAt" IS NULL
+        )
+        WHERE c."id" = $1 AND c."deletedAt" IS NOT NULL
+    `, id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetProjectsByUserID returns projects the user is part of newest first. Projects in trash and templates are
+// left out, archived ones are only returned with includeArchived
+func GetProjectsByUserID(ctx context.Context, userID *string, includeArchived bool) ([]types.Project, error) {
 	if userID == nil {
 		return []types.Project{}, errors.New("UserId must not be nil")
 	}
 
 	return withTx(ctx, func(tx pgx.Tx) ([]types.Project, error) {
-		rows, err := tx.Query(ctx, `
+		return queryProjectsTx(ctx, tx, `
 			SELECT DISTINCT p.*
 			FROM "projects" p
-			WHERE p."creatorID" = $1
-			    OR EXISTS (
-			        SELECT 1 FROM "projectAdmins" pa 
-			        WHERE pa."projectID" = p."id" AND pa."userID" = $1
-			    )
+			WHERE (p."creatorID" = $1
 			    OR EXISTS (
-			        SELECT 1 FROM "projectMembers" pm 
-			        WHERE pm."projectID" = p."id" AND pm."userID" = $1
-			    )
+			        SELECT 1 FROM "projectUsers" pu
+			        WHERE pu."projectID" = p."id" AND pu."userID" = $1
+			    ))
+			    AND p."deletedAt" IS NULL
+			    AND NOT p."isTemplate"
+			    AND ($2 OR p."archivedAt" IS NULL)
 			ORDER BY p."createdAt" DESC;
+		`, userID, includeArchived)
+	})
+}
+
+// GetTemplatesByUserID returns templates the user is part of sorted by name, templates in trash are left out
+func GetTemplatesByUserID(ctx context.Context, userID *string) ([]types.Project, error) {
+	if userID == nil {
+		return []types.Project{}, errors.New("UserId must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) ([]types.Project, error) {
+		return queryProjectsTx(ctx, tx, `
+			SELECT p.*
+			FROM "projects" p
+			WHERE (p."creatorID" = $1
+			    OR EXISTS (
+			        SELECT 1 FROM "projectUsers" pu
+			        WHERE pu."projectID" = p."id" AND pu."userID" = $1
+			    ))
+			    AND p."deletedAt" IS NULL
+			    AND p."isTemplate"
+			ORDER BY p."name", p."createdAt" DESC;
+		`, userID)
+	})
+}
+
+// GetTrashedProjects returns projects of the user in trash, most recently trashed first. Only owners can
+// restore projects, so projects of others are left out
+func GetTrashedProjects(ctx context.Context, userID *string) ([]types.Project, error) {
+	if userID == nil {
+		return []types.Project{}, errors.New("UserId must not be nil")
+	}
+
+	return withTx(ctx, func(tx pgx.Tx) ([]types.Project, error) {
+		return queryProjectsTx(ctx, tx, `
+			SELECT p.* FROM "projects" p
+			WHERE p."creatorID" = $1 AND p."deletedAt" IS NOT NULL
+			ORDER BY p."deletedAt" DESC
 		`, userID)
+	})
+}
+
+// queryProjectsTx scans projects selected with p.* along with their users
+func queryProjectsTx(ctx context.Context, tx pgx.Tx, query string, args ...any) ([]types.Project, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var projects []types.Project
+	for rows.Next() {
+		var project types.Project
+		err := rows.Scan(
+			&project.ID,
+			&project.CreatorID,
+			&project.Name,
+			&project.Description,
+			&project.CreatedAt,
+			&project.UpdatedAt,
+			&project.ArchivedAt,
+			&project.DeletedAt,
+			&project.IsTemplate,
+		)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		project.Users, err = queryReturning[types.ProjectUser](ctx,
+			`SELECT * FROM "projectUsers" WHERE "projectID" = $1`, project.ID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		projects = append(projects, project)
+	}
+
+	return projects, errors.WithStack(rows.Err())
+}
+
+// GetAllProjects returns page of projects of every user newest first and the number of all projects
+func GetAllProjects(ctx context.Context, limit, offset int) ([]types.Project, int, error) {
+	var total int
+
+	projects, err := withTx(ctx, func(tx pgx.Tx) ([]types.Project, error) {
+		rows, err := tx.Query(ctx, `
+			SELECT p.*, COUNT(*) OVER() AS "total"
+			FROM "projects" p
+			ORDER BY p."createdAt" DESC, p."id"
+			LIMIT $1 OFFSET $2
+		`, limit, offset)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 		defer rows.Close()
 
-		var projects []types.Project
+		projects := []types.Project{}
 		for rows.Next() {
-			var project types.Project
+			project := types.Project{Users: []types.ProjectUser{}}
 			err := rows.Scan(
 				&project.ID,
 				&project.CreatorID,
@@ -416,45 +1153,62 @@ func GetProjectsByUserID(ctx context.Context, userID *string) ([]types.Project,
 				&project.Description,
 				&project.CreatedAt,
 				&project.UpdatedAt,
+				&project.ArchivedAt,
+				&project.DeletedAt,
+				&project.IsTemplate,
+				&total,
 			)
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
 
-			admins, err := queryReturning[types.ProjectAdmin](ctx,
-				`SELECT * FROM "projectAdmins" WHERE "projectID" = $1`, project.ID)
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
-			project.AdminIDs = utils.Map(func(i int, admin types.ProjectAdmin) string {
-				return admin.UserID
-			}, admins)
+			projects = append(projects, project)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
 
-			members, err := queryReturning[types.ProjectMember](ctx,
-				`SELECT * FROM "projectMembers" WHERE "projectID" = $1`, project.ID)
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
-			project.MembersIDs = utils.Map(func(i int, member types.ProjectMember) string {
-				return member.UserID
-			}, members)
+		projectIDs := utils.Map(func(i int, project types.Project) string { return project.ID }, projects)
 
-			projects = append(projects, project)
+		projectUsers, err := queryReturningTx[types.ProjectUser](ctx, tx,
+			`SELECT * FROM "projectUsers" WHERE "projectID" = ANY($1)`, projectIDs)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.WithStack(err)
 		}
 
-		return projects, errors.WithStack(rows.Err())
+		for i := range projects {
+			for _, projectUser := range projectUsers {
+				if projectUser.ProjectID == projects[i].ID {
+					projects[i].Users = append(projects[i].Users, projectUser)
+				}
+			}
+		}
+
+		return projects, nil
 	})
+
+	return projects, total, err
 }
 
+// GetColumns returns columns of the project that are not in trash
 func GetColumns(ctx context.Context, projectID *string) ([]types.KanbanColumn, error) {
+	return getColumns(ctx, projectID, false)
+}
+
+// GetTrashedColumns returns columns of the project that are in trash
+func GetTrashedColumns(ctx context.Context, projectID *string) ([]types.KanbanColumn, error) {
+	return getColumns(ctx, projectID, true)
+}
+
+func getColumns(ctx context.Context, projectID *string, trashed bool) ([]types.KanbanColumn, error) {
 	if projectID == nil {
 		return []types.KanbanColumn{}, errors.New("projectID must not be nil")
 	}
 
 	return withTx(ctx, func(tx pgx.Tx) ([]types.KanbanColumn, error) {
 		rows, err := tx.Query(ctx, `
-                SELECT * FROM "kanbanColumns" WHERE "projectID"=$1 ORDER BY "order" ASC
-            `, projectID)
+                SELECT * FROM "kanbanColumns" WHERE "projectID"=$1 AND ("deletedAt" IS NOT NULL) = $2 ORDER BY "order" ASC
+            `, projectID, trashed)
 
 		if err != nil {
 			return nil, errors.WithStack(err)
@@ -471,6 +1225,7 @@ func GetColumns(ctx context.Context, projectID *string) ([]types.KanbanColumn, e
 				&column.Name,
 				&column.Order,
 				&labelID,
+				&column.DeletedAt,
 			)
 			if err != nil {
 				return nil, errors.WithStack(err)
@@ -499,7 +1254,7 @@ func ShiftOrder(ctx context.Context, tableName string, idName string, id *string
 	query := fmt.Sprintf(`
         UPDATE "%s"
         SET "order" = "order" + 1
-        WHERE "%s" = $1 AND "order" >= $2
+        WHERE "%s" = $1 AND "order" >= $2 AND "deletedAt" IS NULL
     `, tableName, idName)
 
 	_, err := queryOneReturning[any](ctx, query, id, fromOrder)
@@ -517,7 +1272,8 @@ func ShiftOrdersInRange(ctx context.Context, tableName string, idName string, id
         SET "order" = "order" + $1
         WHERE "%s" = $2
         AND "order" >= $3
-        AND "order" <= $4 
+        AND "order" <= $4
+        AND "deletedAt" IS NULL
     `, tableName, idName)
 
 	_, err := queryOneReturning[any](ctx, query, shift, id, startOrder, endOrder)
@@ -606,7 +1362,8 @@ func CreateKanbanRow(ctx context.Context, id *string, commentSectionID *string,
 			&kanbanRow.Description, &kanbanRow.Order,
 			&kanbanRow.CreatorID, &kanbanRow.Priority,
 			&labelID, &kanbanRow.CreatedAt,
-			&kanbanRow.UpdatedAt, &kanbanRow.DueDate); err != nil {
+			&kanbanRow.UpdatedAt, &kanbanRow.DueDate,
+			&kanbanRow.DeletedAt); err != nil {
 			return types.KanbanRow{}, errors.WithStack(err)
 		}
 
@@ -686,6 +1443,7 @@ func UpdateKanbanRow(ctx context.Context, updateRow *types.UpdateKanbanRow, row
 			&updatedRow.Order, &updatedRow.CreatorID, &updatedRow.Priority,
 			&labelID, &updatedRow.CreatedAt,
 			&updatedRow.UpdatedAt, &updatedRow.DueDate,
+			&updatedRow.DeletedAt,
 		)
 
 		if err != nil {
@@ -724,20 +1482,44 @@ func UpdateKanbanRow(ctx context.Context, updateRow *types.UpdateKanbanRow, row
 	})
 }
 
+// GetRows returns rows of the column that are not in trash
 func GetRows(ctx context.Context, columnID *string) ([]types.KanbanRow, error) {
 	if columnID == nil {
 		return []types.KanbanRow{}, errors.New("columnID must not be nil")
 	}
 
+	return queryRows(ctx, `
+        SELECT "id", "columnID", "name", "description", "order",
+               "creatorID", "priority", "labelID", "createdAt",
+               "updatedAt", "dueDate", "deletedAt"
+        FROM "kanbanRows"
+        WHERE "columnID"=$1 AND "deletedAt" IS NULL
+        ORDER BY "order" ASC
+    `, columnID)
+}
+
+// GetTrashedRows returns rows of the project that are in trash themselves, rows of trashed columns are
+// restored along with their column
+func GetTrashedRows(ctx context.Context, projectID *string) ([]types.KanbanRow, error) {
+	if projectID == nil {
+		return []types.KanbanRow{}, errors.New("projectID must not be nil")
+	}
+
+	return queryRows(ctx, `
+        SELECT r."id", r."columnID", r."name", r."description", r."order",
+               r."creatorID", r."priority", r."labelID", r."createdAt",
+               r."updatedAt", r."dueDate", r."deletedAt"
+        FROM "kanbanRows" r
+        JOIN "kanbanColumns" c ON c."id" = r."columnID"
+        WHERE c."projectID" = $1 AND r."deletedAt" IS NOT NULL
+        ORDER BY r."deletedAt" DESC
+    `, projectID)
+}
+
+// queryRows scans rows along with their labels, assignees and history
+func queryRows(ctx context.Context, query string, args ...any) ([]types.KanbanRow, error) {
 	return withTx(ctx, func(tx pgx.Tx) ([]types.KanbanRow, error) {
-		qRows, err := tx.Query(ctx, `
-            SELECT "id", "columnID", "name", "description", "order", 
-                   "creatorID", "priority", "labelID", "createdAt", 
-                   "updatedAt", "dueDate"
-            FROM "kanbanRows"
-            WHERE "columnID"=$1 
-            ORDER BY "order" ASC
-        `, columnID)
+		qRows, err := tx.Query(ctx, query, args...)
 		if err != nil {
 			return []types.KanbanRow{}, errors.WithStack(err)
 		}
@@ -748,7 +1530,7 @@ func GetRows(ctx context.Context, columnID *string) ([]types.KanbanRow, error) {
 			var row types.KanbanRow
 			var labelID *string
 
-			err = qRows.Scan(&row.ID, &row.ColumnID, &row.Name, &row.Description, &row.Order, &row.CreatorID, &row.Priority, &labelID, &row.CreatedAt, &row.UpdatedAt, &row.DueDate)
+			err = qRows.Scan(&row.ID, &row.ColumnID, &row.Name, &row.Description, &row.Order, &row.CreatorID, &row.Priority, &labelID, &row.CreatedAt, &row.UpdatedAt, &row.DueDate, &row.DeletedAt)
 			if err != nil {
 				return []types.KanbanRow{}, errors.WithStack(err)
 			}
@@ -789,7 +1571,9 @@ func GetRows(ctx context.Context, columnID *string) ([]types.KanbanRow, error) {
 	})
 }
 
-func DeleteRow(ctx context.Context, rowID *string) error {
+// TrashRow moves the row to trash, closing the gap it leaves in the order of the rest of the column.
+// Returns pgx.ErrNoRows when the row already is in trash
+func TrashRow(ctx context.Context, rowID *string) error {
 	if rowID == nil {
 		return errors.New("rowID must not be nil")
 	}
@@ -798,24 +1582,25 @@ func DeleteRow(ctx context.Context, rowID *string) error {
 		var rowOrder int
 		var columnID string
 		err := tx.QueryRow(ctx, `
-            SELECT "order", "columnID" FROM "kanbanRows" 
-            WHERE id = $1
+            SELECT "order", "columnID" FROM "kanbanRows"
+            WHERE id = $1 AND "deletedAt" IS NULL
+            FOR UPDATE
         `, rowID).Scan(&rowOrder, &columnID)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
 		_, err = tx.Exec(ctx, `
-            DELETE FROM "kanbanRows" WHERE id = $1
+            UPDATE "kanbanRows" SET "deletedAt" = CURRENT_TIMESTAMP WHERE id = $1
         `, rowID)
-		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
 		_, err = tx.Exec(ctx, `
-            UPDATE "kanbanRows" 
+            UPDATE "kanbanRows"
             SET "order" = "order" - 1
-            WHERE "columnID" = $1 AND "order" > $2
+            WHERE "columnID" = $1 AND "order" > $2 AND "deletedAt" IS NULL
         `, columnID, rowOrder)
 
 		return nil, errors.WithStack(err)
@@ -824,6 +1609,90 @@ func DeleteRow(ctx context.Context, rowID *string) error {
 	return errors.WithStack(err)
 }
 
+// RestoreRow takes the row out of trash and puts it at the end of its column, returns pgx.ErrNoRows when
+// the row is not in trash
+func RestoreRow(ctx context.Context, rowID *string) error {
+	if rowID == nil {
+		return errors.New("rowID must not be nil")
+	}
+
+	tag, err := pool.Exec(ctx, `
+        UPDATE "kanbanRows" r
+        SET "deletedAt" = NULL, "order" = (
+            SELECT COUNT(*) + 1 FROM "kanbanRows"
+            WHERE "columnID" = r."columnID" AND "deletedAt" IS NULL
+        )
+        WHERE r."id" = $1 AND r."deletedAt" IS NOT NULL
+    `, rowID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// MoveKanbanRow moves row to moveRow.ColumnID at moveRow.Order, closing the gap in the
+// source column and making room in the destination one. historyPoint is written in the same transaction.
+func MoveKanbanRow(ctx context.Context, rowID *string, moveRow *types.MoveKanbanRow, historyPoint *types.HistoryPoint) error {
+	if rowID == nil || moveRow == nil || historyPoint == nil {
+		return errors.New("rowID, moveRow and historyPoint must not be nil")
+	}
+
+	_, err := withTx(ctx, func(tx pgx.Tx) (any, error) {
+		var rowOrder int
+		var columnID string
+		err := tx.QueryRow(ctx, `
+            SELECT "order", "columnID" FROM "kanbanRows"
+            WHERE id = $1
+            FOR UPDATE
+        `, rowID).Scan(&rowOrder, &columnID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		_, err = tx.Exec(ctx, `
+            UPDATE "kanbanRows"
+            SET "order" = "order" - 1
+            WHERE "columnID" = $1 AND "order" > $2 AND "deletedAt" IS NULL
+        `, columnID, rowOrder)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		_, err = tx.Exec(ctx, `
+            UPDATE "kanbanRows"
+            SET "order" = "order" + 1
+            WHERE "columnID" = $1 AND "order" >= $2 AND "id" != $3 AND "deletedAt" IS NULL
+        `, moveRow.ColumnID, moveRow.Order, rowID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		_, err = tx.Exec(ctx, `
+            UPDATE "kanbanRows"
+            SET "columnID" = $1, "order" = $2
+            WHERE "id" = $3
+        `, moveRow.ColumnID, moveRow.Order, rowID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		_, err = tx.Exec(ctx, `
+            INSERT INTO "historyPoints"
+            ("id", "rowID", "userID", "text")
+            VALUES ($1, $2, $3, $4)
+        `, historyPoint.ID, historyPoint.RowID, historyPoint.UserID, historyPoint.Text)
+
+		return nil, errors.WithStack(err)
+	})
+
+	return errors.WithStack(err)
+}
+
 func GetRow(ctx context.Context, rowID *string) (types.KanbanRow, error) {
 	if rowID == nil {
 		return types.KanbanRow{}, errors.New("rowID must not be nil")
@@ -835,7 +1704,7 @@ func GetRow(ctx context.Context, rowID *string) (types.KanbanRow, error) {
 		var row types.KanbanRow
 		var labelID *string
 
-		err := qRow.Scan(&row.ID, &row.ColumnID, &row.Name, &row.Description, &row.Order, &row.CreatorID, &row.Priority, &labelID, &row.CreatedAt, &row.UpdatedAt, &row.DueDate)
+		err := qRow.Scan(&row.ID, &row.ColumnID, &row.Name, &row.Description, &row.Order, &row.CreatorID, &row.Priority, &labelID, &row.CreatedAt, &row.UpdatedAt, &row.DueDate, &row.DeletedAt)
 		if err != nil {
 			return types.KanbanRow{}, errors.WithStack(err)
 		}
@@ -877,7 +1746,7 @@ func ShiftRowOrder(ctx context.Context, columnID *string, fromOrder int) error {
 	_, err := queryOneReturning[any](ctx, `
         UPDATE "kanbanRows"
         SET "order" = "order" + 1
-        WHERE "columnID" = $1 AND "order" >= $2 
+        WHERE "columnID" = $1 AND "order" >= $2 AND "deletedAt" IS NULL
     `, columnID, fromOrder)
 
 	return errors.WithStack(err)
@@ -0,0 +1,116 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/pkg/errors"
+)
+
+// syncInterval is how long other instances may keep accepting a token revoked elsewhere
+const syncInterval = 10 * time.Second
+
+// Default is the revocation list access tokens are checked against
+var Default *List
+
+// InitRevocation loads revoked access tokens and starts syncing them with other instances
+func InitRevocation() error {
+	list := NewList()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := list.sync(ctx); err != nil {
+		return err
+	}
+
+	Default = list
+
+	go list.syncLoop()
+
+	return nil
+}
+
+// List keeps jti of revoked access tokens in memory. Only tokens that have not expired are kept,
+// so the list stays as small as the number of logouts within access token lifetime
+type List struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func NewList() *List {
+	return &List{revoked: map[string]time.Time{}}
+}
+
+// Revoke persists the token, so every instance rejects it after its next sync, and rejects it here immediately
+func (l *List) Revoke(ctx context.Context, token *types.RevokedAccessToken) error {
+	if err := repository.RevokeAccessToken(ctx, token); err != nil {
+		return errors.Wrap(err, "error revoking access token")
+	}
+
+	l.mu.Lock()
+	l.revoked[token.JTI] = token.ExpiresAt
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *List) IsRevoked(jti string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.revoked[jti]
+	return ok
+}
+
+func (l *List) sync(ctx context.Context) error {
+	tokens, err := repository.GetRevokedAccessTokens(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error loading revoked access tokens")
+	}
+
+	revoked := make(map[string]time.Time, len(tokens))
+	for _, token := range tokens {
+		revoked[token.JTI] = token.ExpiresAt
+	}
+
+	l.mu.Lock()
+	// tokens revoked here while loading are not in the loaded set yet
+	for jti, expiresAt := range l.revoked {
+		if _, ok := revoked[jti]; !ok && time.Now().Before(expiresAt) {
+			revoked[jti] = expiresAt
+		}
+	}
+	l.revoked = revoked
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *List) syncLoop() {
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	purgeTicker := time.NewTicker(time.Hour)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-syncTicker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := l.sync(ctx); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to sync revoked access tokens")
+			}
+			cancel()
+		case <-purgeTicker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := repository.DeleteExpiredRevokedAccessTokens(ctx); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to delete expired revoked access tokens")
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// AdminSearchUsers lists all users, or the ones matching the query when it is not empty
+func AdminSearchUsers(search *types.AdminUserSearch) (types.UserPage, error) {
+	if search == nil {
+		return types.UserPage{}, utils.NewBadRequestError(errors.New("search is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the query is matched with LIKE, its wildcards have to be taken literally
+	query := strings.ToLower(strings.TrimSpace(search.Query))
+	query = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query)
+
+	users, total, err := repository.AdminSearchUsers(ctx, &query, search.Limit, search.Offset)
+	if err != nil {
+		return types.UserPage{}, utils.NewInternalError(err)
+	}
+
+	return types.UserPage{
+		Users:  users,
+		Total:  total,
+		Limit:  search.Limit,
+		Offset: search.Offset,
+	}, nil
+}
+
+// SetUserDisabled disables or enables account of the user on behalf of the admin. Disabled users cannot sign in
+// and their sessions are ended, returns ids of the ended sessions
+func SetUserDisabled(admin *types.User, userID *string, disabled bool) (types.User, []string, error) {
+	if admin == nil || userID == nil {
+		return types.User{}, nil, utils.NewBadRequestError(errors.New("admin or userID is nil"))
+	}
+
+	if admin.ID == *userID {
+		return types.User{}, nil, utils.NewBadRequestError(errors.New("admins cannot disable or enable themselves"))
+	}
+
+	if *userID == types.DeletedUserID {
+		return types.User{}, nil, utils.NewBadRequestError(errors.New("placeholder user cannot be disabled or enabled"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, sessionIDs, err := repository.SetUserDisabled(ctx, userID, disabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, nil, utils.NewNotFoundError(errors.New("user not found"))
+	} else if err != nil {
+		return types.User{}, nil, utils.NewInternalError(err)
+	}
+
+	eventType := types.AuthEventAccountEnabled
+	if disabled {
+		eventType = types.AuthEventAccountDisabled
+	}
+
+	recordAuthEvent(ctx, eventType, user.ID, nil, map[string]any{"admin_id": admin.ID, "session_ids": sessionIDs})
+
+	return user, sessionIDs, nil
+}
+
+// ForcePasswordReset removes password of the user, ends their sessions and personal access tokens and mails them
+// password reset link, e.g. when the account is suspected to be compromised. Returns ids of the ended sessions
+func ForcePasswordReset(admin *types.User, userID *string) (types.User, []string, error) {
+	if admin == nil || userID == nil {
+		return types.User{}, nil, utils.NewBadRequestError(errors.New("admin or userID is nil"))
+	}
+
+	if *userID == types.DeletedUserID {
+		return types.User{}, nil, utils.NewBadRequestError(errors.New("placeholder user has no password"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	user, sessionIDs, err := repository.ForcePasswordReset(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, nil, utils.NewNotFoundError(errors.New("user not found"))
+	} else if err != nil {
+		return types.User{}, nil, utils.NewInternalError(err)
+	}
+
+	recordAuthEvent(ctx, types.AuthEventPasswordResetForced, user.ID, nil, map[string]any{"admin_id": admin.ID, "session_ids": sessionIDs})
+
+	err = sendPasswordResetEmail(ctx, &user,
+		"An administrator of squid reset your password. Follow the link below to choose a new one:",
+		"Request another link with \"Forgot password\" once it expires.")
+	if err != nil {
+		return types.User{}, nil, utils.NewInternalError(errors.Wrap(err, "password was removed but the reset email was not sent"))
+	}
+
+	return user, sessionIDs, nil
+}
+
+// ReassignProjectOwner makes the user owner of the project without asking them, the same as an accepted transfer.
+// Previous owner stays in the project as admin
+func ReassignProjectOwner(projectID *string, reassign *types.ReassignProjectOwner) (types.Project, error) {
+	if projectID == nil || reassign == nil {
+		return types.Project{}, utils.NewBadRequestError(errors.New("all parameters must not be nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	project, err := repository.GetProject(ctx, projectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
+	} else if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
+	if project.DeletedAt != nil {
+		return types.Project{}, utils.NewBadRequestError(errors.New("project is in trash, it has to be restored first"))
+	}
+
+	if err = checkNewOwner(&project, reassign.UserID); err != nil {
+		return types.Project{}, err
+	}
+
+	err = repository.ReassignProjectOwner(ctx, projectID, &project.CreatorID, &reassign.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Project{}, utils.NewBadRequestError(errors.New("project changed hands in the meantime"))
+	} else if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
+	project, err = repository.GetProject(ctx, projectID)
+	if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
+	return project, nil
+}
+
+// GetAllProjects lists projects of every user
+func GetAllProjects(page *types.PageQuery) (types.ProjectPage, error) {
+	if page == nil {
+		return types.ProjectPage{}, utils.NewBadRequestError(errors.New("page is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	projects, total, err := repository.GetAllProjects(ctx, page.Limit, page.Offset)
+	if err != nil {
+		return types.ProjectPage{}, utils.NewInternalError(err)
+	}
+
+	return types.ProjectPage{
+		Projects: projects,
+		Total:    total,
+		Limit:    page.Limit,
+		Offset:   page.Offset,
+	}, nil
+}
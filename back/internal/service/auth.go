@@ -5,9 +5,18 @@ import (
 	"fmt"
 
 	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/mailer"
+	"github.com/finkabaj/squid/back/internal/passhash"
+	"github.com/finkabaj/squid/back/internal/revocation"
+	"github.com/finkabaj/squid/back/internal/signing"
+	"github.com/finkabaj/squid/back/internal/throttle"
 	"github.com/golang-jwt/jwt/v5"
 
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/finkabaj/squid/back/internal/repository"
@@ -15,10 +24,11 @@ import (
 	"github.com/finkabaj/squid/back/internal/utils"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pkg/errors"
 )
 
-func Register(user *types.RegisterUser) (types.AuthUser, error) {
+func Register(user *types.RegisterUser, client *types.ClientInfo) (types.AuthUser, error) {
 	if user == nil {
 		return types.AuthUser{}, utils.NewBadRequestError(errors.New("user is nil"))
 	}
@@ -38,10 +48,10 @@ func Register(user *types.RegisterUser) (types.AuthUser, error) {
 		}
 	}
 
-	passwordHash, err := utils.HashPassword(&user.Password)
+	passwordHash, err := hashPassword(&user.Password)
 
 	if err != nil {
-		return types.AuthUser{}, utils.NewInternalError(err)
+		return types.AuthUser{}, err
 	}
 
 	id := uuid.New().String()
@@ -52,24 +62,98 @@ func Register(user *types.RegisterUser) (types.AuthUser, error) {
 		return types.AuthUser{}, utils.NewInternalError(err)
 	}
 
-	id = uuid.New().String()
+	if err = sendVerificationEmail(ctx, &newUser); err != nil {
+		logger.Logger.Error().Err(err).Str("user_id", newUser.ID).Msg("Failed to send verification email")
+	}
+
+	// invitations to the email wait until it is verified
+	joinedProjects := joinInvitedProjects(ctx, &newUser)
+
+	// no session is started until the email is verified, the client has to log in afterwards
+	if config.Data.RequireVerifiedEmailLogin {
+		return types.AuthUser{User: newUser, JoinedProjects: joinedProjects}, nil
+	}
+
+	authUser, err := createSession(ctx, &newUser, client)
+	authUser.JoinedProjects = joinedProjects
+
+	return authUser, err
+}
 
-	expAt := time.Now().Add(time.Hour * time.Duration(config.Data.RefreshTokenExpHours))
+// sendVerificationEmail issues new verification token for the current email of the user and mails it
+func sendVerificationEmail(ctx context.Context, user *types.User) error {
+	token, tokenHash, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
 
-	refreshToken, err := repository.CreateRefreshToken(ctx, &id, &newUser.ID, &expAt)
+	expiresAt := time.Now().Add(time.Hour * time.Duration(config.Data.EmailVerificationExpHours))
+
+	_, err = repository.CreateEmailVerificationToken(ctx, &types.EmailVerificationToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your squid email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nFollow the link below to verify your email address:\n%s/verify-email?token=%s\n\n"+
+				"The link expires in %d hours. If you did not create a squid account, ignore this email.",
+			user.FirstName, config.Data.FrontendURL, url.QueryEscape(token), config.Data.EmailVerificationExpHours),
+	})
+}
+
+// createSession starts a new session for the user on the client and issues a token pair for it
+func createSession(ctx context.Context, user *types.User, client *types.ClientInfo) (types.AuthUser, error) {
+	if client == nil {
+		client = &types.ClientInfo{}
+	}
+
+	refreshToken, err := repository.CreateRefreshToken(ctx, &types.RefreshToken{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		ExpiresAt:  time.Now().Add(time.Hour * time.Duration(config.Data.RefreshTokenExpHours)),
+		SessionID:  uuid.New().String(),
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		SignedInAt: time.Now(),
+	})
 
 	if err != nil {
 		return types.AuthUser{}, utils.NewInternalError(err)
 	}
 
-	jwtPair, jwtExp, err := utils.CreateJWTPair(&newUser, &refreshToken)
+	return issueTokenPair(user, &refreshToken)
+}
+
+// startLoginSession creates session for the user who proved their identity with the method and records the login
+func startLoginSession(ctx context.Context, user *types.User, client *types.ClientInfo, method string) (types.AuthUser, error) {
+	authUser, err := createSession(ctx, user, client)
+	if err != nil {
+		return types.AuthUser{}, err
+	}
+
+	recordAuthEvent(ctx, types.AuthEventLoginSucceeded, user.ID, client, map[string]any{"method": method})
+
+	return authUser, nil
+}
+
+func issueTokenPair(user *types.User, refreshToken *types.RefreshToken) (types.AuthUser, error) {
+	jwtPair, jwtExp, err := utils.CreateJWTPair(user, refreshToken)
 
 	if err != nil {
 		return types.AuthUser{}, utils.NewInternalError(err)
 	}
 
 	return types.AuthUser{
-		User: newUser,
+		User: *user,
 		TokenPair: types.TokenPair{
 			AccessToken:        jwtPair["accessToken"],
 			AccessTokenExpiry:  jwtExp["accessToken"],
@@ -79,17 +163,24 @@ func Register(user *types.RegisterUser) (types.AuthUser, error) {
 	}, nil
 }
 
-func Login(login *types.Login) (types.AuthUser, error) {
+func Login(login *types.Login, client *types.ClientInfo) (types.AuthUser, error) {
 	if login == nil {
 		return types.AuthUser{}, utils.NewBadRequestError(errors.New("login is nil"))
 	}
 
+	return throttled(newAttempt(client, login.Email), func() (types.AuthUser, error) {
+		return loginWithPassword(login, client)
+	})
+}
+
+func loginWithPassword(login *types.Login, client *types.ClientInfo) (types.AuthUser, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	user, err := repository.GetUser(ctx, nil, &login.Email)
 
 	if errors.Is(errors.Cause(err), pgx.ErrNoRows) {
+		recordAuthEvent(ctx, types.AuthEventLoginFailed, "", client, map[string]any{"reason": "unknown_email", "email": login.Email})
 		return types.AuthUser{}, utils.AppError{
 			Type: utils.ErrorType{
 				Status:  http.StatusUnauthorized,
@@ -101,6 +192,7 @@ func Login(login *types.Login) (types.AuthUser, error) {
 	}
 
 	if !utils.CheckPasswordHash(&login.Password, &user.PasswordHash) {
+		recordAuthEvent(ctx, types.AuthEventLoginFailed, user.ID, client, map[string]any{"reason": "invalid_password"})
 		return types.AuthUser{}, utils.AppError{
 			Type: utils.ErrorType{
 				Status:  http.StatusUnauthorized,
@@ -109,37 +201,72 @@ func Login(login *types.Login) (types.AuthUser, error) {
 		}
 	}
 
-	err = repository.DeleteRefreshToken(ctx, &user.ID)
+	if user.DisabledAt != nil {
+		recordAuthEvent(ctx, types.AuthEventLoginFailed, user.ID, client, map[string]any{"reason": "account_disabled"})
+		return types.AuthUser{}, accountDisabled()
+	}
+
+	if utils.PasswordNeedsRehash(&user.PasswordHash) {
+		rehashPassword(ctx, &user, &login.Password)
+	}
+
+	if config.Data.RequireVerifiedEmailLogin && !user.EmailVerified {
+		return types.AuthUser{}, utils.AppError{
+			Type: utils.ErrorType{
+				Status:  http.StatusForbidden,
+				Message: "Email is not verified",
+			},
+		}
+	}
 
-	if err != nil && !errors.Is(errors.Cause(err), pgx.ErrNoRows) {
+	if user.TwoFactorEnabled {
+		return createLoginChallenge(ctx, &user)
+	}
+
+	if err = repository.DeleteExpiredRefreshTokens(ctx, &user.ID); err != nil {
 		return types.AuthUser{}, utils.NewInternalError(err)
 	}
 
-	id := uuid.New().String()
+	return startLoginSession(ctx, &user, client, "password")
+}
 
-	exp := time.Now().Add(time.Hour * time.Duration(config.Data.RefreshTokenExpHours))
+// hashPassword hashes new password of the user, rejecting ones the configured algorithm cannot hash whole
+func hashPassword(password *string) (string, error) {
+	passwordHash, err := utils.HashPassword(password)
+	if errors.Is(err, passhash.ErrTooLong) {
+		return "", utils.NewValidationError(map[string]string{"Password": "max"})
+	} else if err != nil {
+		return "", utils.NewInternalError(err)
+	}
 
-	refreshToken, err := repository.CreateRefreshToken(ctx, &id, &user.ID, &exp)
+	return passwordHash, nil
+}
 
+// rehashPassword upgrades outdated password hash of the user after the password was verified. Failure
+// does not fail the login, the upgrade is attempted again the next time
+func rehashPassword(ctx context.Context, user *types.User, password *string) {
+	passwordHash, err := utils.HashPassword(password)
 	if err != nil {
-		return types.AuthUser{}, utils.NewInternalError(err)
+		// e.g. bcrypt is preferred again and the password is too long for it
+		logger.Logger.Warn().Err(err).Str("user_id", user.ID).Msg("Failed to rehash password")
+		return
 	}
 
-	jwtPair, jwtExp, err := utils.CreateJWTPair(&user, &refreshToken)
-
+	// pgx.ErrNoRows means the password was changed since it was verified
+	err = repository.RehashPassword(ctx, &user.ID, &user.PasswordHash, &passwordHash)
 	if err != nil {
-		return types.AuthUser{}, utils.NewInternalError(err)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			logger.Logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to store rehashed password")
+		}
+		return
 	}
 
-	return types.AuthUser{
-		User: user,
-		TokenPair: types.TokenPair{
-			AccessToken:        jwtPair["accessToken"],
-			AccessTokenExpiry:  jwtExp["accessToken"],
-			RefreshToken:       jwtPair["refreshToken"],
-			RefreshTokenExpiry: jwtExp["refreshToken"],
-		},
-	}, nil
+	user.PasswordHash = passwordHash
+}
+
+// GetJWKS returns public keys access and refresh tokens can be verified with
+func GetJWKS() signing.JWKSet {
+	return signing.Default.JWKS()
 }
 
 func invalidRefreshToken(err error) utils.AppError {
@@ -152,21 +279,79 @@ func invalidRefreshToken(err error) utils.AppError {
 	}
 }
 
-func RefreshToken(refreshTokenStr *string) (types.AuthUser, error) {
+func accountDisabled() utils.AppError {
+	return utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusForbidden,
+			Message: "Account is disabled",
+		},
+	}
+}
+
+func invalidPassword() utils.AppError {
+	return utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid password",
+		},
+	}
+}
+
+// ssoReauthWindow is how long after signing in with SSO users without password can confirm sensitive changes
+// without a code
+const ssoReauthWindow = 10 * time.Minute
+
+// confirmIdentity checks confirmation of sensitive change in the session. Users with password confirm it. Users
+// signed up with SSO have none, they confirm with two-factor or recovery code when they have two-factor
+// authentication enabled, or by having signed in with SSO in the session recently
+func confirmIdentity(ctx context.Context, user *types.User, sessionID *string, confirmation *types.PasswordConfirmation) error {
+	if user.PasswordHash != "" {
+		if !utils.CheckPasswordHash(&confirmation.Password, &user.PasswordHash) {
+			return invalidPassword()
+		}
+
+		return nil
+	}
+
+	if confirmation.Code != "" && user.TwoFactorEnabled {
+		return verifySecondFactor(ctx, user, confirmation.Code)
+	}
+
+	signedInAt, err := repository.GetSessionSignedInAt(ctx, &user.ID, sessionID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewInternalError(err)
+	}
+
+	if err != nil || time.Since(signedInAt) > ssoReauthWindow {
+		return utils.AppError{
+			Type: utils.ErrorType{
+				Status:  http.StatusUnauthorized,
+				Message: "Sign in with SSO again to confirm",
+			},
+		}
+	}
+
+	return nil
+}
+
+func RefreshToken(refreshTokenStr *string, client *types.ClientInfo) (types.AuthUser, error) {
 	if refreshTokenStr == nil {
 		return types.AuthUser{}, utils.NewBadRequestError(errors.New("refresh token is nil"))
 	}
 
+	attempt := newAttempt(client, "")
+	attempt.Kind = throttle.KindRefresh
+
+	return throttled(attempt, func() (types.AuthUser, error) {
+		return rotateRefreshToken(refreshTokenStr, client)
+	})
+}
+
+func rotateRefreshToken(refreshTokenStr *string, client *types.ClientInfo) (types.AuthUser, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	token, err := jwt.Parse(*refreshTokenStr, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return config.Data.JWTSecret, nil
-	})
+	token, err := signing.Default.Parse(*refreshTokenStr)
 
 	if err != nil {
 		return types.AuthUser{}, invalidRefreshToken(err)
@@ -198,6 +383,14 @@ func RefreshToken(refreshTokenStr *string) (types.AuthUser, error) {
 		return types.AuthUser{}, utils.NewInternalError(err)
 	}
 
+	if client == nil {
+		client = &types.ClientInfo{}
+	}
+
+	if refreshToken.RotatedAt != nil {
+		return types.AuthUser{}, revokeRefreshTokenFamily(ctx, &refreshToken, client)
+	}
+
 	user, err := repository.GetUser(ctx, &refreshToken.UserID, nil)
 
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -206,34 +399,573 @@ func RefreshToken(refreshTokenStr *string) (types.AuthUser, error) {
 		return types.AuthUser{}, utils.NewInternalError(err)
 	}
 
-	err = repository.DeleteRefreshToken(ctx, &refreshToken.UserID)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+	if user.DisabledAt != nil {
+		return types.AuthUser{}, invalidRefreshToken(errors.New("account is disabled"))
+	}
+
+	newRefreshToken, err := repository.RotateRefreshToken(ctx, &refreshToken.ID, &types.RefreshToken{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		ExpiresAt:  time.Now().Add(time.Hour * time.Duration(config.Data.RefreshTokenExpHours)),
+		SessionID:  refreshToken.SessionID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		SignedInAt: refreshToken.SignedInAt,
+	})
+
+	// the token was rotated concurrently by someone else
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.AuthUser{}, revokeRefreshTokenFamily(ctx, &refreshToken, client)
+	} else if err != nil {
 		return types.AuthUser{}, utils.NewInternalError(err)
 	}
 
-	newTokenID := uuid.New().String()
-	expAt := time.Now().Add(time.Hour * time.Duration(config.Data.RefreshTokenExpHours))
+	recordAuthEvent(ctx, types.AuthEventTokenRefreshed, user.ID, client, map[string]any{"session_id": refreshToken.SessionID})
 
-	newRefreshToken, err := repository.CreateRefreshToken(ctx, &newTokenID, &user.ID, &expAt)
+	return issueTokenPair(&user, &newRefreshToken)
+}
 
-	if err != nil {
-		return types.AuthUser{}, utils.NewInternalError(err)
+// revokeRefreshTokenFamily handles presentation of an already rotated refresh token.
+// Either the legitimate client or an attacker holds a stolen token, so the whole session is revoked
+func revokeRefreshTokenFamily(ctx context.Context, refreshToken *types.RefreshToken, client *types.ClientInfo) error {
+	recordAuthEvent(ctx, types.AuthEventRefreshTokenReuse, refreshToken.UserID, client, map[string]any{
+		"session_id": refreshToken.SessionID,
+		"token_id":   refreshToken.ID,
+	})
+
+	if err := repository.DeleteRefreshTokenFamily(ctx, &refreshToken.SessionID); err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	return invalidRefreshToken(errors.New("refresh token was already used"))
+}
+
+func GetSessions(userID *string, currentSessionID *string) ([]types.Session, error) {
+	if userID == nil || currentSessionID == nil {
+		return []types.Session{}, utils.NewBadRequestError(errors.New("userID or currentSessionID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	refreshTokens, err := repository.GetSessions(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return []types.Session{}, utils.NewInternalError(err)
+	}
+
+	return utils.Map(func(_ int, refreshToken types.RefreshToken) types.Session {
+		return types.Session{
+			ID:         refreshToken.SessionID,
+			UserAgent:  refreshToken.UserAgent,
+			IP:         refreshToken.IP,
+			SignedInAt: refreshToken.SignedInAt,
+			LastUsedAt: refreshToken.LastUsedAt,
+			ExpiresAt:  refreshToken.ExpiresAt,
+			Current:    refreshToken.SessionID == *currentSessionID,
+		}
+	}, refreshTokens), nil
+}
+
+func RevokeSession(userID *string, sessionID *string, client *types.ClientInfo) error {
+	if userID == nil || sessionID == nil {
+		return utils.NewBadRequestError(errors.New("userID or sessionID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := repository.DeleteSession(ctx, userID, sessionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewNotFoundError(errors.New(fmt.Sprintf("session with id: %s not found", *sessionID)))
+	} else if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	recordAuthEvent(ctx, types.AuthEventSessionRevoked, *userID, client, map[string]any{"session_ids": []string{*sessionID}})
+
+	return nil
+}
+
+// Logout ends the session the tokens belong to: the refresh token is deleted and the access token is revoked
+// until it expires. Invalid or expired tokens are ignored. Returns the user and session that were logged out
+func Logout(accessTokenStr *string, refreshTokenStr *string, client *types.ClientInfo) (userID string, sessionID string, err error) {
+	if accessTokenStr == nil || refreshTokenStr == nil {
+		return "", "", utils.NewBadRequestError(errors.New("accessToken or refreshToken is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if token, err := signing.Default.Parse(*accessTokenStr); err == nil {
+		claims, _ := token.Claims.(jwt.MapClaims)
+		jti, _ := claims["jti"].(string)
+		exp, _ := claims["expires_at"].(float64)
+		userID, _ = claims["user_id"].(string)
+		sessionID, _ = claims["session_id"].(string)
+
+		if jti != "" && userID != "" && time.Now().Unix() < int64(exp) {
+			err = revocation.Default.Revoke(ctx, &types.RevokedAccessToken{
+				JTI:       jti,
+				UserID:    userID,
+				SessionID: sessionID,
+				ExpiresAt: time.Unix(int64(exp), 0),
+			})
+			if err != nil {
+				return "", "", utils.NewInternalError(err)
+			}
+		}
 	}
 
-	jwtPair, jwtExp, err := utils.CreateJWTPair(&user, &newRefreshToken)
+	if token, err := signing.Default.Parse(*refreshTokenStr); err == nil {
+		claims, _ := token.Claims.(jwt.MapClaims)
+		id, _ := claims["id"].(string)
 
+		refreshToken, err := repository.GetRefreshToken(ctx, &id)
+		if err == nil {
+			userID, sessionID = refreshToken.UserID, refreshToken.SessionID
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return "", "", utils.NewInternalError(err)
+		}
+	}
+
+	if userID == "" || sessionID == "" {
+		return userID, sessionID, nil
+	}
+
+	if err = repository.DeleteSession(ctx, &userID, &sessionID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", "", utils.NewInternalError(err)
+	}
+
+	recordAuthEvent(ctx, types.AuthEventLogout, userID, client, map[string]any{"session_id": sessionID})
+
+	return userID, sessionID, nil
+}
+
+// RevokeOtherSessions revokes every session of the user except the current one and returns ids of revoked sessions
+func RevokeOtherSessions(userID *string, currentSessionID *string, client *types.ClientInfo) ([]string, error) {
+	if userID == nil || currentSessionID == nil {
+		return []string{}, utils.NewBadRequestError(errors.New("userID or currentSessionID is nil"))
+	}
+
+	if *currentSessionID == "" {
+		return []string{}, utils.NewBadRequestError(errors.New("current session is unknown, please log in again"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessionIDs, err := repository.DeleteOtherSessions(ctx, userID, currentSessionID)
 	if err != nil {
-		return types.AuthUser{}, utils.NewInternalError(err)
+		return []string{}, utils.NewInternalError(err)
 	}
 
-	return types.AuthUser{
-		User: user,
-		TokenPair: types.TokenPair{
-			AccessToken:        jwtPair["accessToken"],
-			AccessTokenExpiry:  jwtExp["accessToken"],
-			RefreshToken:       jwtPair["refreshToken"],
-			RefreshTokenExpiry: jwtExp["refreshToken"],
+	if len(sessionIDs) > 0 {
+		recordAuthEvent(ctx, types.AuthEventSessionRevoked, *userID, client, map[string]any{"session_ids": sessionIDs})
+	}
+
+	return sessionIDs, nil
+}
+
+// VerifyEmail marks the email verified, returning projects the user joined by invitations sent to it
+func VerifyEmail(verifyEmail *types.VerifyEmail) (types.User, []types.Project, error) {
+	if verifyEmail == nil {
+		return types.User{}, nil, utils.NewBadRequestError(errors.New("verifyEmail is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tokenHash := utils.HashToken(verifyEmail.Token)
+
+	user, err := repository.VerifyEmail(ctx, &tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, nil, utils.NewBadRequestError(errors.New("verification token is invalid or expired"))
+	} else if err != nil {
+		return types.User{}, nil, utils.NewInternalError(err)
+	}
+
+	return user, joinInvitedProjects(ctx, &user), nil
+}
+
+// ResendVerification sends new verification link to the email. Like ForgotPassword it does not
+// reveal whether the email is registered or already verified
+func ResendVerification(resend *types.ResendVerification) error {
+	if resend == nil {
+		return utils.NewBadRequestError(errors.New("resend is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	user, err := repository.GetUser(ctx, nil, &resend.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	if user.EmailVerified {
+		return nil
+	}
+
+	if err = sendVerificationEmail(ctx, &user); err != nil {
+		logger.Logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to send verification email")
+	}
+
+	return nil
+}
+
+func emailInUse() utils.AppError {
+	return utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusConflict,
+			Message: "Email is already in use",
 		},
+	}
+}
+
+// RequestEmailChange sends confirmation link to the new email and a notice to the current one.
+// The email is changed only once the link is followed, see ConfirmEmailChange
+func RequestEmailChange(user *types.User, sessionID *string, changeEmail *types.ChangeEmail) error {
+	if user == nil || sessionID == nil || changeEmail == nil {
+		return utils.NewBadRequestError(errors.New("user, sessionID or changeEmail is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := confirmIdentity(ctx, user, sessionID, &changeEmail.PasswordConfirmation); err != nil {
+		return err
+	}
+
+	if strings.EqualFold(changeEmail.NewEmail, user.Email) {
+		return utils.NewBadRequestError(errors.New("new email is the current email"))
+	}
+
+	_, err := repository.GetUser(ctx, nil, &changeEmail.NewEmail)
+	if err == nil {
+		return emailInUse()
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewInternalError(err)
+	}
+
+	token, tokenHash, err := utils.GenerateToken()
+	if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	_, err = repository.CreateEmailChangeToken(ctx, &types.EmailChangeToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		OldEmail:  user.Email,
+		NewEmail:  changeEmail.NewEmail,
+		SessionID: *sessionID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(time.Hour * time.Duration(config.Data.EmailVerificationExpHours)),
+	})
+	if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	err = mailer.Send(ctx, mailer.Message{
+		To:      changeEmail.NewEmail,
+		Subject: "Confirm your new squid email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nFollow the link below to use this address for your squid account:\n%s/confirm-email-change?token=%s\n\n"+
+				"The link expires in %d hours. If you did not request this change, ignore this email.",
+			user.FirstName, config.Data.FrontendURL, url.QueryEscape(token), config.Data.EmailVerificationExpHours),
+	})
+	if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	err = mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your squid email is about to change",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone requested to change the email of your squid account to %s. "+
+				"It changes once the link sent to the new address is followed.\n\n"+
+				"If it was not you, change your password and revoke your sessions right away.",
+			user.FirstName, changeEmail.NewEmail),
+	})
+	if err != nil {
+		logger.Logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to send email change notice")
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange swaps email of the user to the confirmed one and revokes every other session
+// than the one the change was requested from
+func ConfirmEmailChange(confirm *types.ConfirmEmailChange, client *types.ClientInfo) (types.EmailChanged, error) {
+	if confirm == nil {
+		return types.EmailChanged{}, utils.NewBadRequestError(errors.New("confirm is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tokenHash := utils.HashToken(confirm.Token)
+
+	changed, err := repository.ChangeEmail(ctx, &tokenHash)
+
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.EmailChanged{}, utils.NewBadRequestError(errors.New("email change token is invalid or expired"))
+	} else if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+		// someone registered with the address after the change was requested
+		return types.EmailChanged{}, emailInUse()
+	} else if err != nil {
+		return types.EmailChanged{}, utils.NewInternalError(err)
+	}
+
+	recordAuthEvent(ctx, types.AuthEventEmailChanged, changed.User.ID, client, map[string]any{
+		"old_email":   changed.OldEmail,
+		"new_email":   changed.User.Email,
+		"session_ids": changed.RevokedSessionIDs,
+	})
+
+	// the new address is verified by now
+	changed.JoinedProjects = joinInvitedProjects(ctx, &changed.User)
+
+	return changed, nil
+}
+
+func CreatePersonalAccessToken(userID *string, create *types.CreatePersonalAccessToken) (types.CreatedPersonalAccessToken, error) {
+	if userID == nil || create == nil {
+		return types.CreatedPersonalAccessToken{}, utils.NewBadRequestError(errors.New("userID or create is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, _, err := utils.GenerateToken()
+	if err != nil {
+		return types.CreatedPersonalAccessToken{}, utils.NewInternalError(err)
+	}
+
+	token = utils.PersonalAccessTokenPrefix + token
+
+	accessToken, err := repository.CreatePersonalAccessToken(ctx, &types.PersonalAccessToken{
+		ID:        uuid.New().String(),
+		UserID:    *userID,
+		Name:      create.Name,
+		TokenHash: utils.HashToken(token),
+		Scope:     create.Scope,
+		ExpiresAt: time.Now().AddDate(0, 0, create.ExpiresInDays),
+	})
+	if err != nil {
+		return types.CreatedPersonalAccessToken{}, utils.NewInternalError(err)
+	}
+
+	return types.CreatedPersonalAccessToken{
+		PersonalAccessToken: accessToken,
+		Token:               token,
+	}, nil
+}
+
+func GetPersonalAccessTokens(userID *string) ([]types.PersonalAccessToken, error) {
+	if userID == nil {
+		return []types.PersonalAccessToken{}, utils.NewBadRequestError(errors.New("userID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	accessTokens, err := repository.GetPersonalAccessTokens(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return []types.PersonalAccessToken{}, utils.NewInternalError(err)
+	}
+
+	return accessTokens, nil
+}
+
+func RevokePersonalAccessToken(userID *string, id *string, client *types.ClientInfo) error {
+	if userID == nil || id == nil {
+		return utils.NewBadRequestError(errors.New("userID or id is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := repository.DeletePersonalAccessToken(ctx, userID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.NewNotFoundError(errors.New(fmt.Sprintf("access token with id: %s not found", *id)))
+	} else if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	recordAuthEvent(ctx, types.AuthEventAccessTokenRevoked, *userID, client, map[string]any{"token_id": *id})
+
+	return nil
+}
+
+// DeleteAccount deletes account of the user after confirming the password
+func DeleteAccount(user *types.User, sessionID *string, deleteAccount *types.DeleteAccount, client *types.ClientInfo) (types.DeletedAccount, error) {
+	if user == nil || sessionID == nil || deleteAccount == nil {
+		return types.DeletedAccount{}, utils.NewBadRequestError(errors.New("user, sessionID or deleteAccount is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := confirmIdentity(ctx, user, sessionID, &deleteAccount.PasswordConfirmation); err != nil {
+		return types.DeletedAccount{}, err
+	}
+
+	return deleteAccountOf(user, deleteAccount, client)
+}
+
+// AdminDeleteAccount deletes account of any user without password confirmation
+func AdminDeleteAccount(userID *string, deleteAccount *types.DeleteAccount) (types.DeletedAccount, error) {
+	if userID == nil || deleteAccount == nil {
+		return types.DeletedAccount{}, utils.NewBadRequestError(errors.New("userID or deleteAccount is nil"))
+	}
+
+	user, err := GetUserById(userID)
+	if err != nil {
+		return types.DeletedAccount{}, err
+	}
+
+	return deleteAccountOf(&user, deleteAccount, nil)
+}
+
+// deleteAccountOf hands owned projects over to the requested users, or to the first admin or member when
+// not requested. Projects nobody else is part of, or all not transferred ones with DeleteOwnedProjects, are deleted
+func deleteAccountOf(user *types.User, deleteAccount *types.DeleteAccount, client *types.ClientInfo) (types.DeletedAccount, error) {
+	if user.ID == types.DeletedUserID {
+		return types.DeletedAccount{}, utils.NewBadRequestError(errors.New("placeholder user cannot be deleted"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	projects, err := repository.GetProjectsByUserID(ctx, &user.ID, true)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return types.DeletedAccount{}, utils.NewInternalError(err)
+	}
+
+	// templates are handed over the same way as projects
+	templates, err := repository.GetTemplatesByUserID(ctx, &user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return types.DeletedAccount{}, utils.NewInternalError(err)
+	}
+	projects = append(projects, templates...)
+
+	requestedTransfers := make(map[string]string, len(deleteAccount.Transfers))
+	for _, transfer := range deleteAccount.Transfers {
+		requestedTransfers[transfer.ProjectID] = transfer.NewOwnerID
+	}
+
+	deleted := types.DeletedAccount{
+		UserID:          user.ID,
+		DeletedProjects: []types.Project{},
+		UpdatedProjects: []types.Project{},
+	}
+	transfers := make(map[string]string)
+	var deleteProjectIDs []string
+
+	for _, project := range projects {
+		project.Users = slices.DeleteFunc(project.Users, func(projectUser types.ProjectUser) bool { return projectUser.UserID == user.ID })
+
+		if project.CreatorID != user.ID {
+			deleted.UpdatedProjects = append(deleted.UpdatedProjects, project)
+			continue
+		}
+
+		newOwnerID, requested := requestedTransfers[project.ID]
+		delete(requestedTransfers, project.ID)
+
+		if requested {
+			if !canOwnProject(projectRole(&project, newOwnerID)) {
+				return types.DeletedAccount{}, utils.NewBadRequestError(errors.New(fmt.Sprintf("new owner of project %s must be its admin or member", project.ID)))
+			}
+		} else if !deleteAccount.DeleteOwnedProjects {
+			newOwnerID = projectSuccessor(&project)
+		}
+
+		if newOwnerID == "" {
+			deleteProjectIDs = append(deleteProjectIDs, project.ID)
+			deleted.DeletedProjects = append(deleted.DeletedProjects, project)
+			continue
+		}
+
+		transfers[project.ID] = newOwnerID
+		project.CreatorID = newOwnerID
+		project.Users = slices.DeleteFunc(project.Users, func(projectUser types.ProjectUser) bool { return projectUser.UserID == newOwnerID })
+		deleted.UpdatedProjects = append(deleted.UpdatedProjects, project)
+	}
+
+	for projectID := range requestedTransfers {
+		return types.DeletedAccount{}, utils.NewBadRequestError(errors.New(fmt.Sprintf("project %s is not owned by the user", projectID)))
+	}
+
+	err = repository.DeleteAccount(ctx, &user.ID, transfers, deleteProjectIDs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.DeletedAccount{}, utils.NewNotFoundError(errors.New("user not found"))
+	} else if err != nil {
+		return types.DeletedAccount{}, utils.NewInternalError(err)
+	}
+
+	if user.AvatarKey != nil {
+		deleteStoredFiles(ctx, avatarKeys(*user.AvatarKey))
+	}
+
+	recordAuthEvent(ctx, types.AuthEventAccountDeleted, user.ID, client, map[string]any{
+		"by_admin":             client == nil,
+		"deleted_projects":     len(deleted.DeletedProjects),
+		"transferred_projects": len(transfers),
+	})
+
+	return deleted, nil
+}
+
+func GetUserByEmail(email *string) (types.User, error) {
+	if email == nil {
+		return types.User{}, utils.NewBadRequestError(errors.New("email is required"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := repository.GetUser(ctx, nil, email)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, utils.NewNotFoundError(errors.New("user not found"))
+	} else if err != nil {
+		return types.User{}, utils.NewInternalError(err)
+	}
+
+	return user, nil
+}
+
+// SearchUsers finds users the user shares a project with, to be assigned or invited
+func SearchUsers(userID *string, search *types.UserSearch) (types.UserPage, error) {
+	if userID == nil || search == nil {
+		return types.UserPage{}, utils.NewBadRequestError(errors.New("userID or search is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := strings.ToLower(strings.TrimSpace(search.Query))
+	if query == "" {
+		return types.UserPage{}, utils.NewValidationError(map[string]string{"Query": "required"})
+	}
+
+	// the query is matched with LIKE, its wildcards have to be taken literally
+	query = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query)
+
+	users, total, err := repository.SearchUsers(ctx, userID, &query, search.Limit, search.Offset)
+	if err != nil {
+		return types.UserPage{}, utils.NewInternalError(err)
+	}
+
+	return types.UserPage{
+		Users:  users,
+		Total:  total,
+		Limit:  search.Limit,
+		Offset: search.Offset,
 	}, nil
 }
 
@@ -275,7 +1007,7 @@ func UpdateUser(user *types.User, updateUser *types.UpdateUser) (types.User, err
 	return busser, nil
 }
 
-func UpdateUserPassword(user *types.User, updatePassword *types.UpdatePassword) (types.User, error) {
+func UpdateUserPassword(user *types.User, updatePassword *types.UpdatePassword, client *types.ClientInfo) (types.User, error) {
 	if user == nil || updatePassword == nil {
 		return types.User{}, utils.NewBadRequestError(errors.New("user or updatePassword is nil"))
 	}
@@ -288,18 +1020,12 @@ func UpdateUserPassword(user *types.User, updatePassword *types.UpdatePassword)
 	}
 
 	if !utils.CheckPasswordHash(&updatePassword.OldPassword, &user.PasswordHash) {
-		return types.User{}, utils.AppError{
-			Type: utils.ErrorType{
-				Status:  http.StatusUnauthorized,
-				Message: "Invalid password",
-			},
-			OriginalError: nil,
-		}
+		return types.User{}, invalidPassword()
 	}
 
-	passwordHash, err := utils.HashPassword(&updatePassword.Password)
+	passwordHash, err := hashPassword(&updatePassword.Password)
 	if err != nil {
-		return types.User{}, utils.NewInternalError(err)
+		return types.User{}, err
 	}
 
 	busser, err := repository.UpdateUser(ctx, user, nil, &passwordHash)
@@ -310,5 +1036,108 @@ func UpdateUserPassword(user *types.User, updatePassword *types.UpdatePassword)
 		return types.User{}, utils.NewInternalError(err)
 	}
 
+	recordAuthEvent(ctx, types.AuthEventPasswordChanged, user.ID, client, nil)
+
 	return busser, nil
 }
+
+// ForgotPassword sends password reset link to the email. It succeeds for unknown emails as well,
+// so the endpoint cannot be used to find out who is registered
+func ForgotPassword(forgotPassword *types.ForgotPassword) error {
+	if forgotPassword == nil {
+		return utils.NewBadRequestError(errors.New("forgotPassword is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	user, err := repository.GetUser(ctx, nil, &forgotPassword.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	err = sendPasswordResetEmail(ctx, &user,
+		"Follow the link below to choose a new password:",
+		"If you did not request a password reset, ignore this email.")
+	if err != nil {
+		logger.Logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to send password reset email")
+	}
+
+	return nil
+}
+
+// sendPasswordResetEmail issues new password reset token for the user and mails its link between intro and outro
+func sendPasswordResetEmail(ctx context.Context, user *types.User, intro string, outro string) error {
+	token, tokenHash, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(time.Minute * time.Duration(config.Data.PasswordResetExpMinutes))
+
+	_, err = repository.CreatePasswordResetToken(ctx, &types.PasswordResetToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your squid password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\n%s\n%s/reset-password?token=%s\n\nThe link expires in %d minutes. %s",
+			user.FirstName, intro, config.Data.FrontendURL, url.QueryEscape(token), config.Data.PasswordResetExpMinutes, outro),
+	})
+}
+
+func ResetPassword(resetPassword *types.ResetPassword, client *types.ClientInfo) (types.User, error) {
+	if resetPassword == nil {
+		return types.User{}, utils.NewBadRequestError(errors.New("resetPassword is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	passwordHash, err := hashPassword(&resetPassword.Password)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	tokenHash := utils.HashToken(resetPassword.Token)
+
+	user, err := repository.ResetPassword(ctx, &tokenHash, &passwordHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, utils.NewBadRequestError(errors.New("reset token is invalid or expired"))
+	} else if err != nil {
+		return types.User{}, utils.NewInternalError(err)
+	}
+
+	recordAuthEvent(ctx, types.AuthEventPasswordReset, user.ID, client, nil)
+
+	return user, nil
+}
+
+// SetUserAdmin grants or revokes system administration of the user with the email
+func SetUserAdmin(email *string, isAdmin bool) (types.User, error) {
+	if email == nil {
+		return types.User{}, utils.NewBadRequestError(errors.New("email is required"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := repository.SetUserAdmin(ctx, email, isAdmin)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, utils.NewNotFoundError(errors.New("user not found"))
+	} else if err != nil {
+		return types.User{}, utils.NewInternalError(err)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/avatar"
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/storage"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// UploadAvatar validates the image, stores its renditions and replaces previous avatar of the user
+func UploadAvatar(user *types.User, data []byte) (types.User, error) {
+	if user == nil {
+		return types.User{}, utils.NewBadRequestError(errors.New("user is nil"))
+	}
+
+	if len(data) > config.Data.AvatarMaxBytes {
+		return types.User{}, utils.AppError{
+			Type: utils.ErrorType{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("Avatar must not be larger than %d bytes", config.Data.AvatarMaxBytes),
+			},
+		}
+	}
+
+	renditions, err := avatar.Render(data)
+	if errors.Is(err, avatar.ErrUnsupportedFormat) || errors.Is(err, avatar.ErrInvalidDimensions) {
+		return types.User{}, utils.NewBadRequestError(err)
+	} else if err != nil {
+		return types.User{}, utils.NewInternalError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// every upload gets new keys, so stored files can be cached forever
+	prefix := fmt.Sprintf("avatars/%s/%s", user.ID, uuid.New().String())
+	keys := make([]string, 0, len(renditions))
+
+	for _, rendition := range renditions {
+		key := fmt.Sprintf("%s/%d.%s", prefix, rendition.Size, rendition.Extension)
+
+		if err = storage.Default.Put(ctx, key, rendition.Data, rendition.ContentType); err != nil {
+			deleteStoredFiles(ctx, keys)
+			return types.User{}, utils.NewInternalError(err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	largest := keys[len(keys)-1]
+	url := storage.Default.URL(largest)
+
+	updatedUser, err := repository.UpdateUserAvatar(ctx, &user.ID, &largest, &url)
+	if errors.Is(err, pgx.ErrNoRows) {
+		deleteStoredFiles(ctx, keys)
+		return types.User{}, utils.NewNotFoundError(errors.New("user not found"))
+	} else if err != nil {
+		deleteStoredFiles(ctx, keys)
+		return types.User{}, utils.NewInternalError(err)
+	}
+
+	if user.AvatarKey != nil {
+		deleteStoredFiles(ctx, avatarKeys(*user.AvatarKey))
+	}
+
+	return updatedUser, nil
+}
+
+func DeleteAvatar(user *types.User) (types.User, error) {
+	if user == nil {
+		return types.User{}, utils.NewBadRequestError(errors.New("user is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	updatedUser, err := repository.UpdateUserAvatar(ctx, &user.ID, nil, nil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, utils.NewNotFoundError(errors.New("user not found"))
+	} else if err != nil {
+		return types.User{}, utils.NewInternalError(err)
+	}
+
+	if user.AvatarKey != nil {
+		deleteStoredFiles(ctx, avatarKeys(*user.AvatarKey))
+	}
+
+	return updatedUser, nil
+}
+
+// avatarKeys returns keys of every rendition of the avatar stored under key of the largest one
+func avatarKeys(key string) []string {
+	dir, ext := path.Dir(key), path.Ext(key)
+
+	keys := make([]string, len(avatar.Sizes))
+	for i, size := range avatar.Sizes {
+		keys[i] = fmt.Sprintf("%s/%d%s", dir, size, ext)
+	}
+
+	return keys
+}
+
+// deleteStoredFiles removes files that are no longer referenced. Failures only leave orphaned files behind
+func deleteStoredFiles(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			logger.Logger.Error().Err(err).Str("key", key).Msg("Failed to delete stored file")
+		}
+	}
+}
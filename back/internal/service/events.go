@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// recordAuthEvent persists account activity. Failing to record it does not fail the action it describes
+func recordAuthEvent(ctx context.Context, eventType types.AuthEventType, userID string, client *types.ClientInfo, details map[string]any) {
+	event := types.AuthEvent{
+		ID:      uuid.New().String(),
+		Type:    eventType,
+		Details: details,
+	}
+
+	if userID != "" {
+		event.UserID = &userID
+	}
+
+	if client != nil {
+		event.IP = client.IP
+		event.UserAgent = client.UserAgent
+	}
+
+	if event.Details == nil {
+		event.Details = map[string]any{}
+	}
+
+	if err := repository.CreateAuthEvent(ctx, &event); err != nil {
+		logger.Logger.Error().Err(err).Str("event", string(eventType)).Str("user_id", userID).Msg("Failed to record auth event")
+	}
+}
+
+// GetOwnAuthEvents returns account activity of the user, the user filter of the query is ignored
+func GetOwnAuthEvents(userID *string, query *types.AuthEventQuery) (types.AuthEventPage, error) {
+	if userID == nil || query == nil {
+		return types.AuthEventPage{}, utils.NewBadRequestError(errors.New("userID or query is nil"))
+	}
+
+	own := *query
+	own.UserID = *userID
+
+	return GetAuthEvents(&own)
+}
+
+// GetAuthEvents returns account activity of all users matching the query, for administrators
+func GetAuthEvents(query *types.AuthEventQuery) (types.AuthEventPage, error) {
+	if query == nil {
+		return types.AuthEventPage{}, utils.NewBadRequestError(errors.New("query is nil"))
+	}
+
+	from, err := parseEventTime(query.From)
+	if err != nil {
+		return types.AuthEventPage{}, utils.NewValidationError(map[string]string{"From": "datetime"})
+	}
+
+	to, err := parseEventTime(query.To)
+	if err != nil {
+		return types.AuthEventPage{}, utils.NewValidationError(map[string]string{"To": "datetime"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, total, err := repository.GetAuthEvents(ctx, &query.UserID, &query.Type, from, to, query.Limit, query.Offset)
+	if err != nil {
+		return types.AuthEventPage{}, utils.NewInternalError(err)
+	}
+
+	return types.AuthEventPage{
+		Events: events,
+		Total:  total,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	}, nil
+}
+
+// parseEventTime parses optional RFC 3339 timestamp into local time, timestamps are stored without time zone
+func parseEventTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+
+	t = t.Local()
+	return &t, nil
+}
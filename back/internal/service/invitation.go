@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/mailer"
+	"github.com/finkabaj/squid/back/internal/policy"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// findInvitee returns the user registered with the email, or nil when nobody is
+func findInvitee(ctx context.Context, email string) (*types.User, error) {
+	user, err := repository.GetUser(ctx, nil, &email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, utils.NewInternalError(err)
+	}
+
+	if user.ID == types.DeletedUserID {
+		return nil, utils.NewBadRequestError(errors.New(fmt.Sprintf("user with email: %s cannot be invited", email)))
+	}
+
+	return &user, nil
+}
+
+func newInvitation(inviter *types.User, projectID string, email string, invitee *types.User, role types.ProjectRole) types.ProjectInvitation {
+	invitation := types.ProjectInvitation{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Email:     email,
+		InviterID: inviter.ID,
+		Role:      role,
+		Status:    types.InvitationPending,
+		ExpiresAt: time.Now().Add(time.Hour * time.Duration(config.Data.ProjectInvitationExpHours)),
+	}
+
+	if invitee != nil {
+		invitation.InviteeID = &invitee.ID
+	}
+
+	return invitation
+}
+
+// isInvitee reports whether the invitation is for the user. Invitations sent to email before anyone registered
+// with it are only for the user once they prove they own the address
+func isInvitee(user *types.User, invitation *types.ProjectInvitation) bool {
+	if invitation.InviteeID != nil {
+		return *invitation.InviteeID == user.ID
+	}
+
+	return user.EmailVerified && strings.EqualFold(invitation.Email, user.Email)
+}
+
+// mailInvitation asks people that are not registered yet to create an account, registered users are notified
+// over websocket instead. Failing to send the email does not fail the invitation
+func mailInvitation(ctx context.Context, inviter *types.User, project *types.Project, invitation *types.ProjectInvitation) {
+	if invitation.InviteeID != nil {
+		return
+	}
+
+	err := mailer.Send(ctx, mailer.Message{
+		To:      invitation.Email,
+		Subject: "You are invited to a squid project",
+		Body: fmt.Sprintf(
+			"Hi,\n\n%s invited you to join project %q on squid as %s. Create an account with this email address "+
+				"and verify it to join:\n%s/register?email=%s\n\nThe invitation expires in %d hours. If you do not want to join, ignore this email.",
+			inviter.Username, project.Name, invitation.Role, config.Data.FrontendURL, url.QueryEscape(invitation.Email),
+			config.Data.ProjectInvitationExpHours),
+	})
+	if err != nil {
+		logger.Logger.Error().Err(err).Str("invitation_id", invitation.ID).Msg("Failed to send invitation email")
+	}
+}
+
+// joinInvitedProjects accepts invitations sent to the email of the user before they registered, once the email
+// is verified whether or not membership requires it. Users that cannot join projects yet keep the invitations
+// until they can. Returns the joined projects, so that their participants can be notified
+func joinInvitedProjects(ctx context.Context, user *types.User) []types.Project {
+	if !user.EmailVerified || canJoinProject(user, nil) != nil {
+		return nil
+	}
+
+	invitations, err := repository.AcceptPendingInvitations(ctx, &user.ID, &user.Email)
+	if err != nil {
+		logger.Logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to accept pending invitations")
+		return nil
+	}
+
+	projects := make([]types.Project, 0, len(invitations))
+	for _, invitation := range invitations {
+		project, err := repository.GetProject(ctx, &invitation.ProjectID)
+		if err != nil {
+			logger.Logger.Error().Err(err).Str("project_id", invitation.ProjectID).Msg("Failed to get joined project")
+			continue
+		}
+
+		projects = append(projects, project)
+	}
+
+	return projects
+}
+
+// InviteToProject invites the email to the project. Users allowed to manage members can invite, only creator can invite admins
+func InviteToProject(user *types.User, createInvitation *types.CreateProjectInvitation) (types.ProjectInvitation, error) {
+	if user == nil || createInvitation == nil {
+		return types.ProjectInvitation{}, utils.NewBadRequestError(errors.New("user or createInvitation is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if _, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, createInvitation.ProjectID, types.ProjectPermissionManageMembers); err != nil {
+		return types.ProjectInvitation{}, err
+	}
+
+	project, err := repository.GetProject(ctx, &createInvitation.ProjectID)
+	if err != nil {
+		return types.ProjectInvitation{}, utils.NewInternalError(err)
+	}
+
+	if createInvitation.Role == types.ProjectRoleAdmin && user.ID != project.CreatorID {
+		return types.ProjectInvitation{}, policy.Forbidden(errors.New("only creator can invite admins"))
+	}
+
+	invitee, err := findInvitee(ctx, createInvitation.Email)
+	if err != nil {
+		return types.ProjectInvitation{}, err
+	}
+
+	if invitee != nil && projectRole(&project, invitee.ID) != "" {
+		return types.ProjectInvitation{}, utils.NewBadRequestError(errors.New(fmt.Sprintf("user with email: %s is already part of the project", createInvitation.Email)))
+	}
+
+	invitation := newInvitation(user, project.ID, createInvitation.Email, invitee, createInvitation.Role)
+
+	invitation, err = repository.CreateProjectInvitation(ctx, &invitation)
+	if err != nil {
+		return types.ProjectInvitation{}, utils.NewInternalError(err)
+	}
+
+	mailInvitation(ctx, user, &project, &invitation)
+
+	return invitation, nil
+}
+
+// GetProjectInvitations returns pending invitations to the project, for users allowed to manage its members
+func GetProjectInvitations(userID *string, projectID *string) ([]types.ProjectInvitation, error) {
+	if userID == nil || projectID == nil {
+		return nil, utils.NewBadRequestError(errors.New("userID or projectID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, *projectID, types.ProjectPermissionManageMembers); err != nil {
+		return nil, err
+	}
+
+	invitations, err := repository.GetProjectInvitations(ctx, projectID)
+	if err != nil {
+		return nil, utils.NewInternalError(err)
+	}
+
+	return invitations, nil
+}
+
+// RevokeProjectInvitation deletes pending invitation. Invitations of admins can only be revoked by creator
+func RevokeProjectInvitation(user *types.User, invitationID *string) (types.ProjectInvitation, error) {
+	if user == nil || invitationID == nil {
+		return types.ProjectInvitation{}, utils.NewBadRequestError(errors.New("user or invitationID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	access, err := policy.Authorize(ctx, user.ID, types.ProjectResourceInvitation, *invitationID, types.ProjectPermissionManageMembers)
+	if err != nil {
+		return types.ProjectInvitation{}, err
+	}
+
+	invitation, err := repository.GetProjectInvitation(ctx, invitationID)
+	if err != nil {
+		return types.ProjectInvitation{}, utils.NewInternalError(err)
+	}
+
+	if invitation.Role == types.ProjectRoleAdmin && user.ID != access.CreatorID {
+		return types.ProjectInvitation{}, policy.Forbidden(errors.New("only creator can revoke invitations of admins"))
+	}
+
+	if invitation.Status != types.InvitationPending {
+		return types.ProjectInvitation{}, utils.NewBadRequestError(errors.New("only pending invitations can be revoked"))
+	}
+
+	if err = repository.DeleteProjectInvitation(ctx, invitationID); err != nil {
+		return types.ProjectInvitation{}, utils.NewInternalError(err)
+	}
+
+	return invitation, nil
+}
+
+// GetReceivedInvitations returns invitations the user can accept or decline
+func GetReceivedInvitations(user *types.User) ([]types.ReceivedProjectInvitation, error) {
+	if user == nil {
+		return nil, utils.NewBadRequestError(errors.New("user is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	invitations, err := repository.GetReceivedInvitations(ctx, &user.ID, &user.Email)
+	if err != nil {
+		return nil, utils.NewInternalError(err)
+	}
+
+	invitations = slices.DeleteFunc(invitations, func(invitation types.ReceivedProjectInvitation) bool {
+		return !isInvitee(user, &invitation.ProjectInvitation)
+	})
+
+	return invitations, nil
+}
+
+// getReceivedInvitation returns invitation sent to the user, invitations of others are reported as not found
+func getReceivedInvitation(ctx context.Context, user *types.User, invitationID *string) (types.ProjectInvitation, error) {
+	invitation, err := repository.GetProjectInvitation(ctx, invitationID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return types.ProjectInvitation{}, utils.NewInternalError(err)
+	}
+
+	if err != nil || !isInvitee(user, &invitation) {
+		return types.ProjectInvitation{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("invitation with id: %s not found", *invitationID)))
+	}
+
+	return invitation, nil
+}
+
+// AcceptProjectInvitation adds the user to the project with the role of the invitation, returns the project they joined
+func AcceptProjectInvitation(user *types.User, invitationID *string) (types.ProjectInvitation, types.Project, error) {
+	if user == nil || invitationID == nil {
+		return types.ProjectInvitation{}, types.Project{}, utils.NewBadRequestError(errors.New("user or invitationID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	invitation, err := getReceivedInvitation(ctx, user, invitationID)
+	if err != nil {
+		return types.ProjectInvitation{}, types.Project{}, err
+	}
+
+	if err = canJoinProject(user, nil); err != nil {
+		return types.ProjectInvitation{}, types.Project{}, err
+	}
+
+	invitation, err = repository.AcceptProjectInvitation(ctx, invitationID, &user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ProjectInvitation{}, types.Project{}, utils.NewBadRequestError(errors.New("invitation is no longer pending or has expired"))
+	} else if err != nil {
+		return types.ProjectInvitation{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	project, err := repository.GetProject(ctx, &invitation.ProjectID)
+	if err != nil {
+		return types.ProjectInvitation{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	return invitation, project, nil
+}
+
+func DeclineProjectInvitation(user *types.User, invitationID *string) (types.ProjectInvitation, error) {
+	if user == nil || invitationID == nil {
+		return types.ProjectInvitation{}, utils.NewBadRequestError(errors.New("user or invitationID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := getReceivedInvitation(ctx, user, invitationID); err != nil {
+		return types.ProjectInvitation{}, err
+	}
+
+	invitation, err := repository.DeclineProjectInvitation(ctx, invitationID, &user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ProjectInvitation{}, utils.NewBadRequestError(errors.New("invitation is no longer pending or has expired"))
+	} else if err != nil {
+		return types.ProjectInvitation{}, utils.NewInternalError(err)
+	}
+
+	return invitation, nil
+}
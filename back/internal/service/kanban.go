@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/policy"
 	"github.com/finkabaj/squid/back/internal/repository"
 	"github.com/finkabaj/squid/back/internal/types"
 	"github.com/finkabaj/squid/back/internal/utils"
@@ -13,59 +15,110 @@ import (
 	"github.com/pkg/errors"
 )
 
-func CreateProject(user *types.User, project *types.CreateProject) (types.Project, error) {
+// CreateProject creates the project and invites admin and member emails to it, returns the invitations
+func CreateProject(user *types.User, project *types.CreateProject) (types.Project, []types.ProjectInvitation, error) {
 	if user == nil || project == nil {
-		return types.Project{}, utils.NewBadRequestError(errors.New("user or project is nil"))
+		return types.Project{}, nil, utils.NewBadRequestError(errors.New("user or project is nil"))
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
+	id := uuid.New().String()
+
 	for i, adminEmail := range project.AdminEmails {
 		if adminEmail == user.Email || utils.Have(func(_ int, memberEmail string) bool {
 			return memberEmail == adminEmail
 		}, project.MemberEmails) {
-			return types.Project{}, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
+			return types.Project{}, nil, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
 		}
 
 		if utils.Have(func(j int, aEmail string) bool { return i != j && aEmail == adminEmail }, project.AdminEmails) {
-			return types.Project{}, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
+			return types.Project{}, nil, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
 		}
-		admin, err := repository.GetUser(ctx, nil, &adminEmail)
-		project.AdminIDs = append(project.AdminIDs, admin.ID)
-		if errors.Is(err, pgx.ErrNoRows) {
-			return types.Project{}, utils.NewBadRequestError(errors.New(fmt.Sprintf("no user with email: %s found", adminEmail)))
-		} else if err != nil {
-			return types.Project{}, utils.NewInternalError(err)
+
+		admin, err := findInvitee(ctx, adminEmail)
+		if err != nil {
+			return types.Project{}, nil, err
 		}
+
+		project.Invitations = append(project.Invitations, newInvitation(user, id, adminEmail, admin, types.ProjectRoleAdmin))
 	}
 
 	for i, memberEmail := range project.MemberEmails {
 		if memberEmail == user.Email {
-			return types.Project{}, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
+			return types.Project{}, nil, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
 		}
 
 		if utils.Have(func(j int, mEmail string) bool { return i != j && mEmail == memberEmail }, project.MemberEmails) {
-			return types.Project{}, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
+			return types.Project{}, nil, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
 		}
 
-		member, err := repository.GetUser(ctx, nil, &memberEmail)
-		project.MemberIDs = append(project.MemberIDs, member.ID)
-		if errors.Is(err, pgx.ErrNoRows) {
-			return types.Project{}, utils.NewBadRequestError(errors.New(fmt.Sprintf("no user with email: %s found", memberEmail)))
-		} else if err != nil {
-			return types.Project{}, utils.NewInternalError(err)
+		member, err := findInvitee(ctx, memberEmail)
+		if err != nil {
+			return types.Project{}, nil, err
 		}
-	}
 
-	id := uuid.New().String()
+		project.Invitations = append(project.Invitations, newInvitation(user, id, memberEmail, member, types.ProjectRoleMember))
+	}
 
 	newProject, err := repository.CreateProject(ctx, &id, &user.ID, project)
 	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+		return types.Project{}, nil, utils.NewInternalError(err)
+	}
+
+	for _, invitation := range project.Invitations {
+		mailInvitation(ctx, user, &newProject, &invitation)
+	}
+
+	return newProject, project.Invitations, nil
+}
+
+// canJoinProject checks whether the user may be added to the project. Users that are already
+// part of the project are not checked again
+func canJoinProject(user *types.User, project *types.Project) error {
+	if user.ID == types.DeletedUserID {
+		return utils.NewBadRequestError(errors.New(fmt.Sprintf("no user with email: %s found", user.Email)))
+	}
+
+	if !config.Data.RequireVerifiedEmailMembership || user.EmailVerified {
+		return nil
+	}
+
+	if project != nil && projectRole(project, user.ID) != "" {
+		return nil
+	}
+
+	return utils.NewBadRequestError(errors.New(fmt.Sprintf("user with email: %s has not verified email", user.Email)))
+}
+
+// projectRole returns role of the user in the project, empty when they are not part of it
+func projectRole(project *types.Project, userID string) types.ProjectRole {
+	if project.CreatorID == userID {
+		return types.ProjectRoleOwner
 	}
 
-	return newProject, nil
+	for _, projectUser := range project.Users {
+		if projectUser.UserID == userID {
+			return projectUser.Role
+		}
+	}
+
+	return ""
+}
+
+// projectSuccessor returns the user that takes the project over when its owner leaves, admins are preferred
+// over members. Empty when there is nobody to take it over
+func projectSuccessor(project *types.Project) string {
+	for _, role := range []types.ProjectRole{types.ProjectRoleAdmin, types.ProjectRoleMember} {
+		for _, projectUser := range project.Users {
+			if projectUser.Role == role {
+				return projectUser.UserID
+			}
+		}
+	}
+
+	return ""
 }
 
 func GetProject(userID *string, projectID *string) (types.Project, error) {
@@ -76,10 +129,12 @@ func GetProject(userID *string, projectID *string) (types.Project, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, *projectID, types.ProjectPermissionView); err != nil {
+		return types.Project{}, err
+	}
+
 	project, err := repository.GetProject(ctx, projectID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
-	} else if err != nil {
+	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
 	}
 	columns, err := repository.GetColumns(ctx, projectID)
@@ -117,24 +172,19 @@ func GetProject(userID *string, projectID *string) (types.Project, error) {
 
 	project.Columns = &columns
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("you cannot fetch a project in which you are not participating"))
-	}
-
 	return project, nil
 }
 
-func GetProjects(userID *string) ([]types.Project, error) {
-	if userID == nil {
-		return []types.Project{}, utils.NewBadRequestError(errors.New("userID is nil"))
+// GetProjects lists projects of the user, archived ones only when asked for
+func GetProjects(userID *string, query *types.ProjectsQuery) ([]types.Project, error) {
+	if userID == nil || query == nil {
+		return []types.Project{}, utils.NewBadRequestError(errors.New("userID or query is nil"))
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	projects, err := repository.GetProjectsByUserID(ctx, userID)
+	projects, err := repository.GetProjectsByUserID(ctx, userID, query.Archived)
 
 	if err != nil {
 		return []types.Project{}, utils.NewInternalError(err)
@@ -151,20 +201,12 @@ func GetProjectUsers(userID *string, projectID *string) (types.ProjectUsers, err
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	project, err := repository.GetProject(ctx, projectID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.ProjectUsers{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
-	} else if err != nil {
-		return types.ProjectUsers{}, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return types.ProjectUsers{}, utils.NewUnauthorizedError(errors.New("you cannot fetch a project in which you are not participating"))
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, *projectID, types.ProjectPermissionView)
+	if err != nil {
+		return types.ProjectUsers{}, err
 	}
 
-	users, err := repository.GetProjectUsers(ctx, projectID, &project.CreatorID)
+	users, err := repository.GetProjectUsers(ctx, projectID, &access.CreatorID)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		return types.ProjectUsers{}, utils.NewInternalError(err)
 	}
@@ -172,32 +214,33 @@ func GetProjectUsers(userID *string, projectID *string) (types.ProjectUsers, err
 	return users, nil
 }
 
-func UpdateProject(id *string, user *types.User, updateProject *types.UpdateProject) (types.Project, error) {
+// UpdateProject updates the project, listed emails of people not yet part of the project are invited to it.
+// Returns the invitations
+func UpdateProject(id *string, user *types.User, updateProject *types.UpdateProject) (types.Project, []types.ProjectInvitation, error) {
 	if id == nil || user == nil || updateProject == nil {
-		return types.Project{}, utils.NewBadRequestError(errors.New("all parameters must not be nil"))
+		return types.Project{}, nil, utils.NewBadRequestError(errors.New("all parameters must not be nil"))
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
 	if updateProject.Name == nil && updateProject.AdminEmails == nil && updateProject.MemberEmails == nil && updateProject.Description == nil {
-		return types.Project{}, utils.NewBadRequestError(errors.New("at least one field must be updated"))
+		return types.Project{}, nil, utils.NewBadRequestError(errors.New("at least one field must be updated"))
 	}
 
-	project, err := repository.GetProject(ctx, id)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *id)))
-	} else if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, *id, types.ProjectPermissionManageBoard)
+	if err != nil {
+		return types.Project{}, nil, err
 	}
 
-	if user.ID != project.CreatorID && !utils.Have(func(i int, adminID string) bool { return adminID == user.ID }, project.AdminIDs) {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("only creator and admins allowed to update project"))
+	project, err := repository.GetProject(ctx, id)
+	if err != nil {
+		return types.Project{}, nil, utils.NewInternalError(err)
 	}
 
 	creator, err := repository.GetUser(ctx, &project.CreatorID, nil)
 	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+		return types.Project{}, nil, utils.NewInternalError(err)
 	}
 
 	if updateProject.AdminEmails != nil && user.ID == project.CreatorID {
@@ -205,70 +248,136 @@ func UpdateProject(id *string, user *types.User, updateProject *types.UpdateProj
 			if adminEmail == creator.Email || (updateProject.MemberEmails != nil && utils.Have(func(_ int, memberEmail string) bool {
 				return memberEmail == adminEmail
 			}, *updateProject.MemberEmails)) {
-				return types.Project{}, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
+				return types.Project{}, nil, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
 			}
-			admin, err := repository.GetUser(ctx, nil, &adminEmail)
-			if errors.Is(err, pgx.ErrNoRows) {
-				return types.Project{}, utils.NewBadRequestError(errors.New(fmt.Sprintf("no user with email: %s found", adminEmail)))
-			} else if err != nil {
-				return types.Project{}, utils.NewInternalError(err)
+
+			admin, err := findInvitee(ctx, adminEmail)
+			if err != nil {
+				return types.Project{}, nil, err
+			}
+
+			if admin != nil && projectRole(&project, admin.ID) != "" {
+				updateProject.AdminIDs = append(updateProject.AdminIDs, admin.ID)
+				continue
 			}
-			updateProject.AdminIDs = append(updateProject.AdminIDs, admin.ID)
+
+			updateProject.Invitations = append(updateProject.Invitations, newInvitation(user, project.ID, adminEmail, admin, types.ProjectRoleAdmin))
 		}
 	} else if updateProject.AdminEmails != nil {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("only creator can update admin emails"))
+		return types.Project{}, nil, policy.Forbidden(errors.New("only creator can update admin emails"))
+	}
+
+	if updateProject.MemberEmails != nil && !policy.Allowed(access.Role, types.ProjectPermissionManageMembers) {
+		return types.Project{}, nil, policy.Forbidden(errors.New("you are not allowed to update member emails"))
 	}
 
 	if updateProject.MemberEmails != nil {
 		for _, memberEmail := range *updateProject.MemberEmails {
 			if memberEmail == creator.Email {
-				return types.Project{}, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
+				return types.Project{}, nil, utils.NewBadRequestError(errors.New("user email should be unique for each category"))
 			}
 
-			member, err := repository.GetUser(ctx, nil, &memberEmail)
-			if errors.Is(err, pgx.ErrNoRows) {
-				return types.Project{}, utils.NewBadRequestError(errors.New(fmt.Sprintf("no user with email: %s found", memberEmail)))
-			} else if err != nil {
-				return types.Project{}, utils.NewInternalError(err)
+			member, err := findInvitee(ctx, memberEmail)
+			if err != nil {
+				return types.Project{}, nil, err
+			}
+
+			// demoting admins is up to creator, the same as promoting
+			if member != nil && projectRole(&project, member.ID) == types.ProjectRoleAdmin && user.ID != project.CreatorID {
+				return types.Project{}, nil, policy.Forbidden(errors.New("only creator can change roles of admins"))
+			}
+
+			if member != nil && projectRole(&project, member.ID) != "" {
+				updateProject.MembersIDs = append(updateProject.MembersIDs, member.ID)
+				continue
 			}
-			updateProject.MembersIDs = append(updateProject.MembersIDs, member.ID)
+
+			updateProject.Invitations = append(updateProject.Invitations, newInvitation(user, project.ID, memberEmail, member, types.ProjectRoleMember))
 		}
 	}
 
 	updatedProject, err := repository.UpdateProject(ctx, id, updateProject)
 
 	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+		return types.Project{}, nil, utils.NewInternalError(err)
+	}
+
+	for _, invitation := range updateProject.Invitations {
+		mailInvitation(ctx, user, &updatedProject, &invitation)
 	}
 
-	return updatedProject, nil
+	return updatedProject, updateProject.Invitations, nil
 }
 
-func DeleteProject(user *types.User, projectID *string) (types.Project, error) {
-	if user == nil || projectID == nil {
-		return types.Project{}, utils.NewBadRequestError(errors.New("user or projectID is nil"))
+// UpdateProjectRole changes role of the user in the project. Only creator can make users admins or change roles of admins
+func UpdateProjectRole(user *types.User, projectID *string, updateRole *types.UpdateProjectRole) (types.Project, error) {
+	if user == nil || projectID == nil || updateRole == nil {
+		return types.Project{}, utils.NewBadRequestError(errors.New("all parameters must not be nil"))
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if _, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, *projectID, types.ProjectPermissionManageMembers); err != nil {
+		return types.Project{}, err
+	}
+
 	project, err := repository.GetProject(ctx, projectID)
+	if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
+	role := projectRole(&project, updateRole.UserID)
+	if role == "" {
+		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("user with id: %s is not part of the project", updateRole.UserID)))
+	} else if role == types.ProjectRoleOwner {
+		return types.Project{}, utils.NewBadRequestError(errors.New("role of creator cannot be changed"))
+	}
+
+	if (role == types.ProjectRoleAdmin || updateRole.Role == types.ProjectRoleAdmin) && user.ID != project.CreatorID {
+		return types.Project{}, policy.Forbidden(errors.New("only creator can change roles of admins"))
+	}
+
+	_, err = repository.SetProjectUserRole(ctx, projectID, &updateRole.UserID, updateRole.Role)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
+		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("user with id: %s is not part of the project", updateRole.UserID)))
 	} else if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != user.ID {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("only creator can delete project"))
+	project, err = repository.GetProject(ctx, projectID)
+	if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
 	}
 
-	err = repository.DeleteProject(ctx, projectID)
+	return project, nil
+}
+
+// DeleteProject moves the project to trash, it is deleted for good once trash retention period passes
+func DeleteProject(user *types.User, projectID *string) (types.Project, error) {
+	if user == nil || projectID == nil {
+		return types.Project{}, utils.NewBadRequestError(errors.New("user or projectID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, *projectID, types.ProjectPermissionDeleteProject); err != nil {
+		return types.Project{}, err
+	}
 
+	project, err := repository.GetProject(ctx, projectID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
 	}
 
+	err = repository.TrashProject(ctx, projectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
+	} else if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
 	return project, nil
 }
 
@@ -280,16 +389,13 @@ func CreateColumn(user *types.User, createColumn *types.CreateKanbanColumn) (typ
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	project, err := repository.GetProject(ctx, &createColumn.ProjectID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", createColumn.ProjectID)))
-	} else if err != nil {
-		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
+	if _, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, createColumn.ProjectID, types.ProjectPermissionManageBoard); err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, err
 	}
 
-	if project.CreatorID != user.ID && !utils.Have(func(_ int, adminID string) bool { return adminID == user.ID }, project.AdminIDs) {
-		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only creator and admin can create new column"))
+	project, err := repository.GetProject(ctx, &createColumn.ProjectID)
+	if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
 	}
 
 	if createColumn.LabelID != nil {
@@ -353,26 +459,15 @@ func GetColumn(columnID *string, userID *string) (types.KanbanColumn, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	column, err := repository.GetKanbanColumn(ctx, columnID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanColumn{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found", *columnID)))
-	} else if err != nil {
-		return types.KanbanColumn{}, utils.NewInternalError(err)
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceColumn, *columnID, types.ProjectPermissionView); err != nil {
+		return types.KanbanColumn{}, err
 	}
 
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-
+	column, err := repository.GetKanbanColumn(ctx, columnID)
 	if err != nil {
 		return types.KanbanColumn{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(_ int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(_ int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return types.KanbanColumn{}, utils.NewUnauthorizedError(errors.New("user not participating in that project"))
-	}
-
 	return column, nil
 }
 
@@ -388,28 +483,23 @@ func UpdateColumn(columnID *string, user *types.User, updateColumn *types.Update
 		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewBadRequestError(errors.New("nothing to update"))
 	}
 
-	project, err := repository.GetProject(ctx, &updateColumn.ProjectID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", updateColumn.ProjectID)))
-	} else if err != nil {
-		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, user.ID, types.ProjectResourceColumn, *columnID, types.ProjectPermissionManageBoard)
+	if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, err
 	}
 
-	if project.CreatorID != user.ID && !utils.Have(func(_ int, adminID string) bool { return adminID == user.ID }, project.AdminIDs) {
-		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only creator and admin can update column"))
+	if access.ProjectID != updateColumn.ProjectID {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewBadRequestError(errors.New("column does not belong to project"))
 	}
 
-	column, err := repository.GetKanbanColumn(ctx, columnID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found", *columnID)))
-	} else if err != nil {
+	project, err := repository.GetProject(ctx, &access.ProjectID)
+	if err != nil {
 		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if column.ProjectID != project.ID {
-		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewBadRequestError(errors.New("column does not belong to project"))
+	column, err := repository.GetKanbanColumn(ctx, columnID)
+	if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
 	}
 
 	if updateColumn.LabelID != nil {
@@ -465,6 +555,7 @@ func UpdateColumn(columnID *string, user *types.User, updateColumn *types.Update
 	return updatedColumn, updatedColumns, project, nil
 }
 
+// DeleteColumn moves the column to trash along with its rows
 func DeleteColumn(columnID *string, user *types.User) ([]types.KanbanColumn, types.Project, error) {
 	if columnID == nil || user == nil {
 		return []types.KanbanColumn{}, types.Project{}, utils.NewBadRequestError(errors.New("columnID or user is nil"))
@@ -473,27 +564,20 @@ func DeleteColumn(columnID *string, user *types.User) ([]types.KanbanColumn, typ
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	column, err := repository.GetKanbanColumn(ctx, columnID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return []types.KanbanColumn{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found", *columnID)))
-	} else if err != nil {
-		return []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, user.ID, types.ProjectResourceColumn, *columnID, types.ProjectPermissionManageBoard)
+	if err != nil {
+		return []types.KanbanColumn{}, types.Project{}, err
 	}
 
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != user.ID && !utils.Have(func(_ int, adminID string) bool { return adminID == user.ID }, project.AdminIDs) {
-		return []types.KanbanColumn{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only creator can delete column"))
-	}
-
-	err = repository.DeleteKanbanColumn(ctx, columnID)
-
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+	err = repository.TrashKanbanColumn(ctx, columnID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return []types.KanbanColumn{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found", *columnID)))
+	} else if err != nil {
 		return []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
 	}
 
@@ -513,18 +597,8 @@ func GetColumns(projectID *string, userID *string) ([]types.KanbanColumn, error)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	project, err := repository.GetProject(ctx, projectID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return []types.KanbanColumn{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
-	} else if err != nil {
-		return []types.KanbanColumn{}, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return []types.KanbanColumn{}, utils.NewUnauthorizedError(errors.New("you cannot fetch a project in which you are not participating"))
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, *projectID, types.ProjectPermissionView); err != nil {
+		return []types.KanbanColumn{}, err
 	}
 
 	columns, err := repository.GetColumns(ctx, projectID)
@@ -544,16 +618,13 @@ func CreateColumnLabel(userID *string, createColumnLabel *types.CreateKanbanColu
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	project, err := repository.GetProject(ctx, &createColumnLabel.ProjectID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanColumnLabel{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", createColumnLabel.ProjectID)))
-	} else if err != nil {
-		return types.KanbanColumnLabel{}, types.Project{}, utils.NewInternalError(err)
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, createColumnLabel.ProjectID, types.ProjectPermissionManageBoard); err != nil {
+		return types.KanbanColumnLabel{}, types.Project{}, err
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.KanbanColumnLabel{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can create column label"))
+	project, err := repository.GetProject(ctx, &createColumnLabel.ProjectID)
+	if err != nil {
+		return types.KanbanColumnLabel{}, types.Project{}, utils.NewInternalError(err)
 	}
 
 	id := uuid.New().String()
@@ -574,23 +645,16 @@ func DeleteColumnLabel(userID *string, labelID *string) (types.Project, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	label, err := repository.GetKanbanColumnLabel(ctx, labelID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found", *labelID)))
-	} else if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceColumnLabel, *labelID, types.ProjectPermissionManageBoard)
+	if err != nil {
+		return types.Project{}, err
 	}
 
-	project, err := repository.GetProject(ctx, &label.ProjectID)
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can delete column label"))
-	}
-
 	err = repository.DeleteKanbanColumnLabel(ctx, labelID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
@@ -611,16 +675,18 @@ func UpdateColumnLabel(userID *string, labelID *string, updateLabel *types.Updat
 		return types.KanbanColumnLabel{}, types.Project{}, utils.NewBadRequestError(errors.New("at least one field must be updated"))
 	}
 
-	project, err := repository.GetProject(ctx, &updateLabel.ProjectID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanColumnLabel{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", updateLabel.ProjectID)))
-	} else if err != nil {
-		return types.KanbanColumnLabel{}, types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceColumnLabel, *labelID, types.ProjectPermissionManageBoard)
+	if err != nil {
+		return types.KanbanColumnLabel{}, types.Project{}, err
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.KanbanColumnLabel{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can update column label"))
+	if access.ProjectID != updateLabel.ProjectID {
+		return types.KanbanColumnLabel{}, types.Project{}, utils.NewBadRequestError(errors.New("label does not belong to project"))
+	}
+
+	project, err := repository.GetProject(ctx, &access.ProjectID)
+	if err != nil {
+		return types.KanbanColumnLabel{}, types.Project{}, utils.NewInternalError(err)
 	}
 
 	updatedLabel, err := repository.UpdateKanbanColumnLabel(ctx, labelID, updateLabel)
@@ -639,17 +705,8 @@ func GetColumnLabels(userID *string, projectID *string) ([]types.KanbanColumnLab
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	project, err := repository.GetProject(ctx, projectID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
-	} else if err != nil {
-		return nil, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return nil, utils.NewUnauthorizedError(errors.New("you cannot fetch labels in a project in which you are not participating"))
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, *projectID, types.ProjectPermissionView); err != nil {
+		return nil, err
 	}
 
 	labels, err := repository.GetKanbanColumnLabels(ctx, projectID)
@@ -670,29 +727,20 @@ func CreateRow(userID *string, createRow *types.CreateKanbanRow) (types.KanbanRo
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	column, err := repository.GetKanbanColumn(ctx, &createRow.ColumnID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found", createRow.ColumnID)))
-	} else if err != nil {
-		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceColumn, createRow.ColumnID, types.ProjectPermissionEditRows)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, err
 	}
 
 	if createRow.Priority != nil && *createRow.Priority != types.LowPriority && *createRow.Priority != types.MediumPriority && *createRow.Priority != types.HighPriority {
 		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("invalid priority"))
 	}
 
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(_ int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can create row"))
-	}
-
 	assigneeMap := make(map[string]bool, len(createRow.AssignedUsersIDs))
 	for _, assigneeID := range createRow.AssignedUsersIDs {
 		if assigneeMap[assigneeID] {
@@ -701,8 +749,7 @@ func CreateRow(userID *string, createRow *types.CreateKanbanRow) (types.KanbanRo
 		}
 		assigneeMap[assigneeID] = true
 
-		if !utils.Have(func(_ int, id string) bool { return id == assigneeID },
-			append(append(project.MembersIDs, project.AdminIDs...), project.CreatorID)) {
+		if projectRole(&project, assigneeID) == "" {
 			return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(
 				errors.New(fmt.Sprintf("user %s is not a project member", assigneeID)))
 		}
@@ -794,10 +841,17 @@ func UpdateRow(userID *string, rowID *string, updateRow *types.UpdateKanbanRow)
 		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("invalid priority"))
 	}
 
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceRow, *rowID, types.ProjectPermissionEditRows)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, err
+	}
+
+	if access.ProjectID != updateRow.ProjectID {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("projectID cannot be changed"))
+	}
+
 	row, err := repository.GetRow(ctx, rowID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("row with id: %s not found", *rowID)))
-	} else if err != nil {
+	if err != nil {
 		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
 	}
 
@@ -810,20 +864,11 @@ func UpdateRow(userID *string, rowID *string, updateRow *types.UpdateKanbanRow)
 		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if column.ProjectID != updateRow.ProjectID {
-		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("projectID cannot be changed"))
-	}
-
-	project, err := repository.GetProject(ctx, &updateRow.ProjectID)
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(_ int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can update row"))
-	}
-
 	if updateRow.LabelID != nil {
 		_, err := repository.GetKanbanRowLabel(ctx, updateRow.LabelID)
 
@@ -843,8 +888,7 @@ func UpdateRow(userID *string, rowID *string, updateRow *types.UpdateKanbanRow)
 			}
 			assigneeMap[assigneeID] = true
 
-			if !utils.Have(func(_ int, id string) bool { return id == assigneeID },
-				append(append(project.MembersIDs, project.AdminIDs...), project.CreatorID)) {
+			if projectRole(&project, assigneeID) == "" {
 				return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(
 					errors.New(fmt.Sprintf("user %s is not a project member", assigneeID)))
 			}
@@ -910,6 +954,104 @@ func UpdateRow(userID *string, rowID *string, updateRow *types.UpdateKanbanRow)
 	return updatedRow, updatedRows, project, nil
 }
 
+func MoveRow(userID *string, rowID *string, moveRow *types.MoveKanbanRow) (types.KanbanRow, []types.KanbanRow, []types.KanbanRow, types.Project, error) {
+	if userID == nil || rowID == nil || moveRow == nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("userID or rowID or moveRow is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceRow, *rowID, types.ProjectPermissionEditRows)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, err
+	}
+
+	if access.ProjectID != moveRow.ProjectID {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("row does not belong to project"))
+	}
+
+	row, err := repository.GetRow(ctx, rowID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	sourceColumn, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	targetColumn, err := repository.GetKanbanColumn(ctx, &moveRow.ColumnID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	// rows cannot be moved to columns in trash
+	if err != nil || targetColumn.DeletedAt != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found", moveRow.ColumnID)))
+	}
+
+	if targetColumn.ProjectID != sourceColumn.ProjectID {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("row cannot be moved to another project"))
+	}
+
+	project, err := repository.GetProject(ctx, &access.ProjectID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	targetRows, err := repository.GetRows(ctx, &targetColumn.ID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	maxOrder := len(targetRows) + 1
+	if targetColumn.ID == sourceColumn.ID {
+		maxOrder = len(targetRows)
+	}
+
+	if moveRow.Order < 1 {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("order must be at least 1"))
+	}
+
+	if moveRow.Order > maxOrder {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("cannot move row with gaps in order"))
+	}
+
+	historyText := fmt.Sprintf("moved from %s to %s", sourceColumn.Name, targetColumn.Name)
+	if targetColumn.ID == sourceColumn.ID {
+		historyText = fmt.Sprintf("moved within %s", sourceColumn.Name)
+	}
+
+	err = repository.MoveKanbanRow(ctx, rowID, moveRow, &types.HistoryPoint{
+		ID:     uuid.NewString(),
+		RowID:  row.ID,
+		UserID: *userID,
+		Text:   historyText,
+	})
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	movedRow, err := repository.GetRow(ctx, rowID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	sourceRows, err := repository.GetRows(ctx, &sourceColumn.ID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	targetRows, err = repository.GetRows(ctx, &targetColumn.ID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	return movedRow, sourceRows, targetRows, project, nil
+}
+
+// DeleteRow moves the row to trash
 func DeleteRow(userID *string, rowID *string) ([]types.KanbanRow, types.Project, error) {
 	if userID == nil || rowID == nil {
 		return []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("userID or rowID is nil"))
@@ -918,30 +1060,25 @@ func DeleteRow(userID *string, rowID *string) ([]types.KanbanRow, types.Project,
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	row, err := repository.GetRow(ctx, rowID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return []types.KanbanRow{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("row with id: %s not found", *rowID)))
-	} else if err != nil {
-		return []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceRow, *rowID, types.ProjectPermissionEditRows)
+	if err != nil {
+		return []types.KanbanRow{}, types.Project{}, err
 	}
 
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+	row, err := repository.GetRow(ctx, rowID)
 	if err != nil {
 		return []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	project, err := repository.GetProject(ctx, &column.ProjectID)
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(_ int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return []types.KanbanRow{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can delete row"))
-	}
-
-	err = repository.DeleteRow(ctx, rowID)
-	if err != nil {
+	err = repository.TrashRow(ctx, rowID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return []types.KanbanRow{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("row with id: %s not found", *rowID)))
+	} else if err != nil {
 		return []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
 	}
 
@@ -961,22 +1098,8 @@ func GetRows(userID *string, columnID *string) ([]types.KanbanRow, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	column, err := repository.GetKanbanColumn(ctx, columnID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return []types.KanbanRow{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found", *columnID)))
-	} else if err != nil {
-		return []types.KanbanRow{}, utils.NewInternalError(err)
-	}
-
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-	if err != nil {
-		return []types.KanbanRow{}, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(_ int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(_ int, memberId string) bool { return memberId == *userID }, project.MembersIDs) {
-		return []types.KanbanRow{}, utils.NewUnauthorizedError(errors.New("only participants can get rows"))
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceColumn, *columnID, types.ProjectPermissionView); err != nil {
+		return []types.KanbanRow{}, err
 	}
 
 	rows, err := repository.GetRows(ctx, columnID)
@@ -995,16 +1118,13 @@ func CreateRowLabel(userID *string, createRowLabel *types.CreateKanbanRowLabel)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	project, err := repository.GetProject(ctx, &createRowLabel.ProjectID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanRowLabel{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", createRowLabel.ProjectID)))
-	} else if err != nil {
-		return types.KanbanRowLabel{}, types.Project{}, utils.NewInternalError(err)
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, createRowLabel.ProjectID, types.ProjectPermissionManageBoard); err != nil {
+		return types.KanbanRowLabel{}, types.Project{}, err
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.KanbanRowLabel{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can create row label"))
+	project, err := repository.GetProject(ctx, &createRowLabel.ProjectID)
+	if err != nil {
+		return types.KanbanRowLabel{}, types.Project{}, utils.NewInternalError(err)
 	}
 
 	id := uuid.New().String()
@@ -1025,23 +1145,16 @@ func DeleteRowLabel(userID *string, labelID *string) (types.Project, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	label, err := repository.GetKanbanRowLabel(ctx, labelID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("row with id: %s not found", *labelID)))
-	} else if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceRowLabel, *labelID, types.ProjectPermissionManageBoard)
+	if err != nil {
+		return types.Project{}, err
 	}
 
-	project, err := repository.GetProject(ctx, &label.ProjectID)
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can delete row label"))
-	}
-
 	err = repository.DeleteKanbanRowLabel(ctx, labelID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
@@ -1062,16 +1175,18 @@ func UpdateRowLabel(userID *string, labelID *string, updateLabel *types.UpdateKa
 		return types.KanbanRowLabel{}, types.Project{}, utils.NewBadRequestError(errors.New("at least one field must be updated"))
 	}
 
-	project, err := repository.GetProject(ctx, &updateLabel.ProjectID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.KanbanRowLabel{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", updateLabel.ProjectID)))
-	} else if err != nil {
-		return types.KanbanRowLabel{}, types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceRowLabel, *labelID, types.ProjectPermissionManageBoard)
+	if err != nil {
+		return types.KanbanRowLabel{}, types.Project{}, err
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.KanbanRowLabel{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can update row label"))
+	if access.ProjectID != updateLabel.ProjectID {
+		return types.KanbanRowLabel{}, types.Project{}, utils.NewBadRequestError(errors.New("label does not belong to project"))
+	}
+
+	project, err := repository.GetProject(ctx, &access.ProjectID)
+	if err != nil {
+		return types.KanbanRowLabel{}, types.Project{}, utils.NewInternalError(err)
 	}
 
 	updatedLabel, err := repository.UpdateKanbanRowLabel(ctx, labelID, updateLabel)
@@ -1090,17 +1205,8 @@ func GetRowLabels(userID *string, projectID *string) ([]types.KanbanRowLabel, er
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	project, err := repository.GetProject(ctx, projectID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
-	} else if err != nil {
-		return nil, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return nil, utils.NewUnauthorizedError(errors.New("you cannot fetch labels in a project in which you are not participating"))
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, *projectID, types.ProjectPermissionView); err != nil {
+		return nil, err
 	}
 
 	labels, err := repository.GetKanbanRowLabels(ctx, projectID)
@@ -1121,11 +1227,9 @@ func CreateChecklist(userID *string, rowID *string) (types.Checklist, types.Proj
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	row, err := repository.GetRow(ctx, rowID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Checklist{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("row with id: %s not found", *rowID)))
-	} else if err != nil {
-		return types.Checklist{}, types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceRow, *rowID, types.ProjectPermissionEditRows)
+	if err != nil {
+		return types.Checklist{}, types.Project{}, err
 	}
 
 	if exists, err := repository.ChecklistExists(ctx, rowID); err != nil {
@@ -1134,21 +1238,11 @@ func CreateChecklist(userID *string, rowID *string) (types.Checklist, types.Proj
 		return types.Checklist{}, types.Project{}, utils.NewBadRequestError(errors.New("checklist already exists"))
 	}
 
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.Checklist{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-	if err != nil {
-		return types.Checklist{}, types.Project{}, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.Checklist{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can create checklist"))
-	}
-
 	checklist, err := repository.CreateChecklist(ctx, &types.Checklist{
 		ID:    uuid.New().String(),
 		RowID: *rowID,
@@ -1169,33 +1263,16 @@ func DeleteChecklist(userID *string, checklistID *string) (types.Project, error)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	checklist, err := repository.GetChecklist(ctx, checklistID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("checklist with id: %s not found", *checklistID)))
-	} else if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
-	}
-
-	row, err := repository.GetRow(ctx, &checklist.RowID)
-	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
-	}
-
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceChecklist, *checklistID, types.ProjectPermissionEditRows)
 	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+		return types.Project{}, err
 	}
 
-	project, err := repository.GetProject(ctx, &column.ProjectID)
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can delete checklist"))
-	}
-
 	err = repository.DeleteChecklist(ctx, checklistID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
@@ -1212,33 +1289,16 @@ func CreatePoint(userID *string, createPoint *types.CreatePoint) (types.Point, t
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	checklist, err := repository.GetChecklist(ctx, &createPoint.ChecklistID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Point{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("checklist with id: %s not found", createPoint.ChecklistID)))
-	} else if err != nil {
-		return types.Point{}, types.Project{}, utils.NewInternalError(err)
-	}
-
-	row, err := repository.GetRow(ctx, &checklist.RowID)
-	if err != nil {
-		return types.Point{}, types.Project{}, utils.NewInternalError(err)
-	}
-
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceChecklist, createPoint.ChecklistID, types.ProjectPermissionEditRows)
 	if err != nil {
-		return types.Point{}, types.Project{}, utils.NewInternalError(err)
+		return types.Point{}, types.Project{}, err
 	}
 
-	project, err := repository.GetProject(ctx, &column.ProjectID)
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.Point{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.Point{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can create point"))
-	}
-
 	id := uuid.New().String()
 
 	point, err := repository.CreatePoint(ctx, &id, createPoint)
@@ -1257,21 +1317,18 @@ func UpdatePoint(userID *string, id *string, updatePoint *types.UpdatePoint) (ty
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := repository.GetPoint(ctx, id)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Point{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("point with id: %s not found", *id)))
-	} else if err != nil {
-		return types.Point{}, types.Project{}, utils.NewInternalError(err)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourcePoint, *id, types.ProjectPermissionEditRows)
+	if err != nil {
+		return types.Point{}, types.Project{}, err
 	}
 
-	project, err := repository.GetProject(ctx, &updatePoint.ProjectID)
-	if err != nil {
-		return types.Point{}, types.Project{}, utils.NewInternalError(err)
+	if access.ProjectID != updatePoint.ProjectID {
+		return types.Point{}, types.Project{}, utils.NewBadRequestError(errors.New("point does not belong to project"))
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.Point{}, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can update point"))
+	project, err := repository.GetProject(ctx, &access.ProjectID)
+	if err != nil {
+		return types.Point{}, types.Project{}, utils.NewInternalError(err)
 	}
 
 	point, err := repository.UpdatePoint(ctx, id, updatePoint, false)
@@ -1290,36 +1347,21 @@ func UpdatePointStatus(userID *string, id *string) (types.Point, types.Project,
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	point, err := repository.GetPoint(ctx, id)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Point{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("point with id: %s not found", *id)))
-	} else if err != nil {
-		return types.Point{}, types.Project{}, utils.NewInternalError(err)
-	}
-
-	checklist, err := repository.GetChecklist(ctx, &point.ChecklistID)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourcePoint, *id, types.ProjectPermissionEditRows)
 	if err != nil {
-		return types.Point{}, types.Project{}, utils.NewInternalError(err)
+		return types.Point{}, types.Project{}, err
 	}
-	row, err := repository.GetRow(ctx, &checklist.RowID)
-	if err != nil {
-		return types.Point{}, types.Project{}, utils.NewInternalError(err)
-	}
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+
+	point, err := repository.GetPoint(ctx, id)
 	if err != nil {
 		return types.Point{}, types.Project{}, utils.NewInternalError(err)
 	}
-	project, err := repository.GetProject(ctx, &column.ProjectID)
+
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.Point{}, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return types.Point{}, types.Project{}, utils.NewUnauthorizedError(errors.New("you not participate in this project"))
-	}
-
 	var pointInfo types.UpdatePoint
 	completed := !point.Completed
 	pointInfo.Completed = &completed
@@ -1348,35 +1390,16 @@ func DeletePoint(userID *string, id *string) (types.Project, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	point, err := repository.GetPoint(ctx, id)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("point with id: %s not found", *id)))
-	} else if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
-	}
-
-	checklist, err := repository.GetChecklist(ctx, &point.ChecklistID)
-	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
-	}
-	row, err := repository.GetRow(ctx, &checklist.RowID)
-	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
-	}
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourcePoint, *id, types.ProjectPermissionEditRows)
 	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+		return types.Project{}, err
 	}
-	project, err := repository.GetProject(ctx, &column.ProjectID)
+
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can delete point"))
-	}
-
 	err = repository.DeletePoint(ctx, id)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
@@ -1393,29 +1416,8 @@ func GetPoints(userID *string, checklistID *string) ([]types.Point, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	checklist, err := repository.GetChecklist(ctx, checklistID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return []types.Point{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("checklist with id: %s not found", *checklistID)))
-	} else if err != nil {
-		return []types.Point{}, utils.NewInternalError(err)
-	}
-	row, err := repository.GetRow(ctx, &checklist.RowID)
-	if err != nil {
-		return []types.Point{}, utils.NewInternalError(err)
-	}
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
-	if err != nil {
-		return []types.Point{}, utils.NewInternalError(err)
-	}
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-	if err != nil {
-		return []types.Point{}, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return []types.Point{}, utils.NewUnauthorizedError(errors.New("you not participate in this project"))
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceChecklist, *checklistID, types.ProjectPermissionView); err != nil {
+		return []types.Point{}, err
 	}
 
 	points, err := repository.GetPoints(ctx, checklistID)
@@ -1434,31 +1436,17 @@ func UpdateCanComment(userID *string, commentSectionID *string) (bool, types.Pro
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	commentSection, err := repository.GetCommentSection(ctx, commentSectionID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return false, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("comment section with id: %s not found", *commentSectionID)))
-	} else if err != nil {
-		return false, types.Project{}, utils.NewInternalError(err)
-	}
-	row, err := repository.GetRow(ctx, &commentSection.RowID)
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceCommentSection, *commentSectionID, types.ProjectPermissionManageBoard)
 	if err != nil {
-		return false, types.Project{}, utils.NewInternalError(err)
+		return false, types.Project{}, err
 	}
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
-	if err != nil {
-		return false, types.Project{}, utils.NewInternalError(err)
-	}
-	project, err := repository.GetProject(ctx, &column.ProjectID)
+
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return false, types.Project{}, utils.NewInternalError(err)
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) {
-		return false, types.Project{}, utils.NewUnauthorizedError(errors.New("only admins can update comment section"))
-	}
-
-	commentSection, err = repository.ChangeCanComment(ctx, commentSectionID)
+	commentSection, err := repository.ChangeCanComment(ctx, commentSectionID)
 	if err != nil {
 		return false, types.Project{}, utils.NewInternalError(err)
 	}
@@ -1474,29 +1462,8 @@ func GetComments(userID *string, commentSectionID *string) ([]types.Comment, err
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	commentSection, err := repository.GetCommentSection(ctx, commentSectionID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return []types.Comment{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("comment section with id: %s not found", *commentSectionID)))
-	} else if err != nil {
-		return []types.Comment{}, utils.NewInternalError(err)
-	}
-	row, err := repository.GetRow(ctx, &commentSection.RowID)
-	if err != nil {
-		return []types.Comment{}, utils.NewInternalError(err)
-	}
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
-	if err != nil {
-		return []types.Comment{}, utils.NewInternalError(err)
-	}
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-	if err != nil {
-		return []types.Comment{}, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return []types.Comment{}, utils.NewUnauthorizedError(errors.New("you not participate in this project"))
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceCommentSection, *commentSectionID, types.ProjectPermissionView); err != nil {
+		return []types.Comment{}, err
 	}
 
 	comments, err := repository.GetComments(ctx, commentSectionID)
@@ -1515,10 +1482,13 @@ func CreateComment(userID *string, createComment *types.CreateComment) (types.Co
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceCommentSection, createComment.CommentSectionID, types.ProjectPermissionComment)
+	if err != nil {
+		return types.Comment{}, types.Project{}, err
+	}
+
 	commentSection, err := repository.GetCommentSection(ctx, &createComment.CommentSectionID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Comment{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("comment section with id: %s not found", createComment.CommentSectionID)))
-	} else if err != nil {
+	if err != nil {
 		return types.Comment{}, types.Project{}, utils.NewInternalError(err)
 	}
 
@@ -1526,24 +1496,10 @@ func CreateComment(userID *string, createComment *types.CreateComment) (types.Co
 		return types.Comment{}, types.Project{}, utils.NewBadRequestError(errors.New("this comment section can't be commented"))
 	}
 
-	row, err := repository.GetRow(ctx, &commentSection.RowID)
+	project, err := repository.GetProject(ctx, &access.ProjectID)
 	if err != nil {
 		return types.Comment{}, types.Project{}, utils.NewInternalError(err)
 	}
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
-	if err != nil {
-		return types.Comment{}, types.Project{}, utils.NewInternalError(err)
-	}
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-	if err != nil {
-		return types.Comment{}, types.Project{}, utils.NewInternalError(err)
-	}
-
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		!utils.Have(func(i int, memberID string) bool { return memberID == *userID }, project.MembersIDs) {
-		return types.Comment{}, types.Project{}, utils.NewUnauthorizedError(errors.New("you not participate in this project"))
-	}
 
 	id := uuid.New().String()
 	comment, err := repository.CreateComment(ctx, userID, &id, createComment)
@@ -1562,33 +1518,30 @@ func DeleteComment(userID *string, commentID *string) (types.Project, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	comment, err := repository.GetComment(ctx, commentID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("comment with id: %s not found", *commentID)))
-	} else if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
-	}
-	commentSection, err := repository.GetCommentSection(ctx, &comment.CommentSectionID)
+	// authors can delete their comments as long as they can see the project, the rest is up to board managers
+	access, err := policy.Authorize(ctx, *userID, types.ProjectResourceComment, *commentID, types.ProjectPermissionView)
 	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+		return types.Project{}, err
 	}
-	row, err := repository.GetRow(ctx, &commentSection.RowID)
-	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+
+	if access.Archived {
+		return types.Project{}, policy.Forbidden(errors.New("project is archived"))
 	}
-	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+
+	comment, err := repository.GetComment(ctx, commentID)
 	if err != nil {
 		return types.Project{}, utils.NewInternalError(err)
 	}
-	project, err := repository.GetProject(ctx, &column.ProjectID)
-	if err != nil {
-		return types.Project{}, utils.NewInternalError(err)
+
+	if comment.UserID != *userID {
+		if err = policy.Check(&access, types.ProjectResourceComment, *commentID, types.ProjectPermissionManageBoard); err != nil {
+			return types.Project{}, err
+		}
 	}
 
-	if project.CreatorID != *userID &&
-		!utils.Have(func(i int, adminID string) bool { return adminID == *userID }, project.AdminIDs) &&
-		comment.UserID != *userID {
-		return types.Project{}, utils.NewUnauthorizedError(errors.New("you cannot delete this comment"))
+	project, err := repository.GetProject(ctx, &access.ProjectID)
+	if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
 	}
 
 	err = repository.DeleteComment(ctx, commentID)
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/policy"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// canOwnProject reports whether the role is enough to take the project over, the same as when owners delete their accounts
+func canOwnProject(role types.ProjectRole) bool {
+	return role == types.ProjectRoleAdmin || role == types.ProjectRoleMember
+}
+
+// checkNewOwner checks that the user can take the project over from its owner
+func checkNewOwner(project *types.Project, userID string) error {
+	if userID == project.CreatorID {
+		return utils.NewBadRequestError(errors.New("user already owns the project"))
+	}
+
+	role := projectRole(project, userID)
+	if role == "" {
+		return utils.NewNotFoundError(errors.New(fmt.Sprintf("user with id: %s is not part of the project", userID)))
+	} else if !canOwnProject(role) {
+		return utils.NewBadRequestError(errors.New("new owner must be admin or member of the project"))
+	}
+
+	return nil
+}
+
+// TransferProject asks the user to take the project over, the owner stays in the project as admin once they accept.
+// Pending transfer of the project is replaced
+func TransferProject(user *types.User, projectID *string, createTransfer *types.CreateOwnershipTransfer) (types.OwnershipTransfer, error) {
+	if user == nil || projectID == nil || createTransfer == nil {
+		return types.OwnershipTransfer{}, utils.NewBadRequestError(errors.New("all parameters must not be nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, *projectID, types.ProjectPermissionTransferProject); err != nil {
+		return types.OwnershipTransfer{}, err
+	}
+
+	if createTransfer.UserID == user.ID {
+		return types.OwnershipTransfer{}, utils.NewBadRequestError(errors.New("you already own the project"))
+	}
+
+	project, err := repository.GetProject(ctx, projectID)
+	if err != nil {
+		return types.OwnershipTransfer{}, utils.NewInternalError(err)
+	}
+
+	if err = checkNewOwner(&project, createTransfer.UserID); err != nil {
+		return types.OwnershipTransfer{}, err
+	}
+
+	transfer, err := repository.CreateOwnershipTransfer(ctx, &types.OwnershipTransfer{
+		ID:         uuid.New().String(),
+		ProjectID:  project.ID,
+		FromUserID: user.ID,
+		ToUserID:   createTransfer.UserID,
+		ExpiresAt:  time.Now().Add(time.Hour * time.Duration(config.Data.ProjectTransferExpHours)),
+	})
+	if err != nil {
+		return types.OwnershipTransfer{}, utils.NewInternalError(err)
+	}
+
+	return transfer, nil
+}
+
+// CancelProjectTransfer withdraws pending transfer of the project
+func CancelProjectTransfer(user *types.User, projectID *string) (types.OwnershipTransfer, error) {
+	if user == nil || projectID == nil {
+		return types.OwnershipTransfer{}, utils.NewBadRequestError(errors.New("user or projectID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, *projectID, types.ProjectPermissionTransferProject); err != nil {
+		return types.OwnershipTransfer{}, err
+	}
+
+	transfer, err := repository.CancelOwnershipTransfer(ctx, projectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.OwnershipTransfer{}, utils.NewNotFoundError(errors.New("project has no pending transfer"))
+	} else if err != nil {
+		return types.OwnershipTransfer{}, utils.NewInternalError(err)
+	}
+
+	return transfer, nil
+}
+
+// GetReceivedTransfers returns transfers of projects the user can accept or decline
+func GetReceivedTransfers(user *types.User) ([]types.ReceivedOwnershipTransfer, error) {
+	if user == nil {
+		return nil, utils.NewBadRequestError(errors.New("user is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transfers, err := repository.GetReceivedOwnershipTransfers(ctx, &user.ID)
+	if err != nil {
+		return nil, utils.NewInternalError(err)
+	}
+
+	return transfers, nil
+}
+
+// getReceivedTransfer returns transfer to the user, transfers to others are reported as not found
+func getReceivedTransfer(ctx context.Context, user *types.User, transferID *string) (types.OwnershipTransfer, error) {
+	transfer, err := repository.GetOwnershipTransfer(ctx, transferID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return types.OwnershipTransfer{}, utils.NewInternalError(err)
+	}
+
+	if err != nil || transfer.ToUserID != user.ID {
+		return types.OwnershipTransfer{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("transfer with id: %s not found", *transferID)))
+	}
+
+	return transfer, nil
+}
+
+// AcceptProjectTransfer makes the user owner of the project, returns the transferred project
+func AcceptProjectTransfer(user *types.User, transferID *string) (types.OwnershipTransfer, types.Project, error) {
+	if user == nil || transferID == nil {
+		return types.OwnershipTransfer{}, types.Project{}, utils.NewBadRequestError(errors.New("user or transferID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transfer, err := getReceivedTransfer(ctx, user, transferID)
+	if err != nil {
+		return types.OwnershipTransfer{}, types.Project{}, err
+	}
+
+	// projects in trash cannot be taken over, and the role could have changed since the transfer was created
+	access, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, transfer.ProjectID, types.ProjectPermissionView)
+	if err != nil {
+		return types.OwnershipTransfer{}, types.Project{}, err
+	}
+
+	if !canOwnProject(access.Role) {
+		return types.OwnershipTransfer{}, types.Project{}, utils.NewBadRequestError(errors.New("you must be admin or member of the project to take it over"))
+	}
+
+	transfer, err = repository.AcceptOwnershipTransfer(ctx, transferID, &user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.OwnershipTransfer{}, types.Project{}, utils.NewBadRequestError(errors.New("transfer is no longer pending or has expired"))
+	} else if err != nil {
+		return types.OwnershipTransfer{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	project, err := repository.GetProject(ctx, &transfer.ProjectID)
+	if err != nil {
+		return types.OwnershipTransfer{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	return transfer, project, nil
+}
+
+func DeclineProjectTransfer(user *types.User, transferID *string) (types.OwnershipTransfer, error) {
+	if user == nil || transferID == nil {
+		return types.OwnershipTransfer{}, utils.NewBadRequestError(errors.New("user or transferID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := getReceivedTransfer(ctx, user, transferID); err != nil {
+		return types.OwnershipTransfer{}, err
+	}
+
+	transfer, err := repository.DeclineOwnershipTransfer(ctx, transferID, &user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.OwnershipTransfer{}, utils.NewBadRequestError(errors.New("transfer is no longer pending or has expired"))
+	} else if err != nil {
+		return types.OwnershipTransfer{}, utils.NewInternalError(err)
+	}
+
+	return transfer, nil
+}
+
+// LeaveProject removes the user from the project and unassigns them from its rows. Owners have to transfer
+// the project before they can leave it, and nobody can leave archived projects as their rows are read-only
+func LeaveProject(user *types.User, projectID *string) (types.LeftProject, error) {
+	if user == nil || projectID == nil {
+		return types.LeftProject{}, utils.NewBadRequestError(errors.New("user or projectID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	access, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, *projectID, types.ProjectPermissionView)
+	if err != nil {
+		return types.LeftProject{}, err
+	}
+
+	if access.Role == types.ProjectRoleOwner {
+		return types.LeftProject{}, utils.NewBadRequestError(errors.New("owner cannot leave the project, transfer it first"))
+	}
+
+	if access.Archived {
+		return types.LeftProject{}, policy.Forbidden(errors.New("project is archived, it has to be unarchived before leaving it"))
+	}
+
+	assignedRowIDs, err := repository.GetAssignedRowIDs(ctx, projectID, &user.ID)
+	if err != nil {
+		return types.LeftProject{}, utils.NewInternalError(err)
+	}
+
+	historyPoints := make([]types.HistoryPoint, 0, len(assignedRowIDs))
+	for _, rowID := range assignedRowIDs {
+		historyPoints = append(historyPoints, types.HistoryPoint{
+			ID:     uuid.NewString(),
+			RowID:  rowID,
+			UserID: user.ID,
+			Text:   fmt.Sprintf("%s left the project and was unassigned", user.Username),
+		})
+	}
+
+	rowIDs, err := repository.LeaveProject(ctx, projectID, &user.ID, historyPoints)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.LeftProject{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found", *projectID)))
+	} else if err != nil {
+		return types.LeftProject{}, utils.NewInternalError(err)
+	}
+
+	left := types.LeftProject{UpdatedRows: make([]types.KanbanRow, 0, len(rowIDs))}
+
+	left.Project, err = repository.GetProject(ctx, projectID)
+	if err != nil {
+		return types.LeftProject{}, utils.NewInternalError(err)
+	}
+
+	for _, rowID := range rowIDs {
+		row, err := repository.GetRow(ctx, &rowID)
+		if err != nil {
+			return types.LeftProject{}, utils.NewInternalError(err)
+		}
+
+		left.UpdatedRows = append(left.UpdatedRows, row)
+	}
+
+	return left, nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/oidc"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// oidcStateExpiry is how long the user has to complete login at the identity provider
+const oidcStateExpiry = 10 * time.Minute
+
+func ssoFailed(err error) utils.AppError {
+	return utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusUnauthorized,
+			Message: "Single sign-on failed",
+		},
+		OriginalError: err,
+	}
+}
+
+// StartOIDCLogin returns url of the identity provider the user agent has to be redirected to, along with
+// state that has to be bound to the user agent and presented back in CompleteOIDCLogin
+func StartOIDCLogin() (string, string, error) {
+	if oidc.Default == nil {
+		return "", "", utils.NewNotFoundError(errors.New("single sign-on is not configured"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	state, stateHash, err := utils.GenerateToken()
+	if err != nil {
+		return "", "", utils.NewInternalError(err)
+	}
+
+	nonce, _, err := utils.GenerateToken()
+	if err != nil {
+		return "", "", utils.NewInternalError(err)
+	}
+
+	codeVerifier, codeChallenge, err := oidc.GenerateVerifier()
+	if err != nil {
+		return "", "", utils.NewInternalError(err)
+	}
+
+	_, err = repository.CreateOIDCState(ctx, &types.OIDCState{
+		StateHash:    stateHash,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(oidcStateExpiry),
+	})
+	if err != nil {
+		return "", "", utils.NewInternalError(err)
+	}
+
+	authURL, err := oidc.Default.AuthCodeURL(ctx, state, nonce, codeChallenge)
+	if err != nil {
+		return "", "", utils.NewInternalError(err)
+	}
+
+	return authURL, state, nil
+}
+
+// CompleteOIDCLogin exchanges authorization code for ID token and signs in the user it belongs to,
+// provisioning new user or linking existing one by email when the identity is seen for the first time
+func CompleteOIDCLogin(callback *types.OIDCCallback, boundState string, client *types.ClientInfo) (types.AuthUser, error) {
+	if callback == nil {
+		return types.AuthUser{}, utils.NewBadRequestError(errors.New("callback is nil"))
+	}
+
+	if oidc.Default == nil {
+		return types.AuthUser{}, utils.NewNotFoundError(errors.New("single sign-on is not configured"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// the state must come back to the same user agent that started login, otherwise an attacker
+	// could make the victim sign in into attacker's account
+	if boundState == "" || subtle.ConstantTimeCompare([]byte(boundState), []byte(callback.State)) != 1 {
+		return types.AuthUser{}, ssoFailed(errors.New("state does not match"))
+	}
+
+	stateHash := utils.HashToken(callback.State)
+
+	state, err := repository.ConsumeOIDCState(ctx, &stateHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.AuthUser{}, ssoFailed(errors.New("state is invalid or expired"))
+	} else if err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	if callback.Error != "" {
+		return types.AuthUser{}, ssoFailed(errors.Errorf("identity provider returned %s: %s", callback.Error, callback.ErrorDescription))
+	}
+
+	rawIDToken, err := oidc.Default.Exchange(ctx, callback.Code, state.CodeVerifier)
+	if err != nil {
+		return types.AuthUser{}, ssoFailed(err)
+	}
+
+	claims, err := oidc.Default.VerifyIDToken(ctx, rawIDToken, state.Nonce)
+	if err != nil {
+		return types.AuthUser{}, ssoFailed(err)
+	}
+
+	user, joinedProjects, err := resolveOIDCUser(ctx, &claims, client)
+	if err != nil {
+		return types.AuthUser{}, err
+	}
+
+	if user.DisabledAt != nil {
+		return types.AuthUser{}, accountDisabled()
+	}
+
+	if config.Data.RequireVerifiedEmailLogin && !user.EmailVerified {
+		return types.AuthUser{}, utils.AppError{
+			Type: utils.ErrorType{
+				Status:  http.StatusForbidden,
+				Message: "Email is not verified",
+			},
+		}
+	}
+
+	// the identity provider only stands in for the password
+	if user.TwoFactorEnabled {
+		return createLoginChallenge(ctx, &user)
+	}
+
+	if err = repository.DeleteExpiredRefreshTokens(ctx, &user.ID); err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	authUser, err := startLoginSession(ctx, &user, client, "sso")
+	authUser.JoinedProjects = joinedProjects
+
+	return authUser, err
+}
+
+// resolveOIDCUser returns the user the identity belongs to, linking or provisioning it on first login, along
+// with projects a provisioned user joined by invitations
+func resolveOIDCUser(ctx context.Context, claims *oidc.Claims, client *types.ClientInfo) (types.User, []types.Project, error) {
+	user, err := repository.GetUserByIdentity(ctx, &claims.Issuer, &claims.Subject)
+	if err == nil {
+		return user, nil, nil
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, nil, utils.NewInternalError(err)
+	}
+
+	if claims.Email == "" {
+		return types.User{}, nil, ssoFailed(errors.New("identity provider did not share email"))
+	}
+
+	identity := types.UserIdentity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+
+	user, err = repository.GetUser(ctx, nil, &claims.Email)
+	if err == nil {
+		if user.ID == types.DeletedUserID {
+			return types.User{}, nil, ssoFailed(errors.New("placeholder user cannot be linked"))
+		}
+
+		// a disabled user would be kept out after linking anyway, the identity must not stay linked meanwhile
+		if user.DisabledAt != nil {
+			return types.User{}, nil, accountDisabled()
+		}
+
+		// linking on unverified email would let anyone with an account at the provider take over squid accounts
+		if !claims.EmailVerified {
+			return types.User{}, nil, utils.AppError{
+				Type: utils.ErrorType{
+					Status:  http.StatusConflict,
+					Message: "Account with this email already exists, verify the email at the identity provider to link it",
+				},
+			}
+		}
+
+		linkedUser, err := repository.LinkUserIdentity(ctx, &user.ID, &identity)
+		if err != nil {
+			return types.User{}, nil, utils.NewInternalError(err)
+		}
+
+		recordAuthEvent(ctx, types.AuthEventSSOAccountLinked, user.ID, client, map[string]any{"issuer": claims.Issuer})
+
+		return linkedUser, nil, nil
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, nil, utils.NewInternalError(err)
+	}
+
+	newUser := types.User{
+		ID:            uuid.New().String(),
+		Username:      claims.PreferredUsername,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}
+
+	if newUser.Username == "" {
+		newUser.Username, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	if birthdate, err := time.Parse(time.DateOnly, claims.Birthdate); err == nil {
+		newUser.DateOfBirth = &birthdate
+	}
+
+	user, err = repository.CreateOIDCUser(ctx, &newUser, &identity)
+	if err != nil {
+		return types.User{}, nil, utils.NewInternalError(errors.Wrapf(err, "error provisioning user for %s", claims.Subject))
+	}
+
+	return user, joinInvitedProjects(ctx, &user), nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/policy"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SaveProjectAsTemplate copies the project, or another template, into a new template owned by the user
+func SaveProjectAsTemplate(user *types.User, projectID *string, clone *types.CloneProject) (types.Project, []types.ProjectInvitation, error) {
+	return cloneProject(user, projectID, clone, true)
+}
+
+// CloneProject copies the project into a new one owned by the user, templates are turned into projects this way
+func CloneProject(user *types.User, projectID *string, clone *types.CloneProject) (types.Project, []types.ProjectInvitation, error) {
+	return cloneProject(user, projectID, clone, false)
+}
+
+// GetTemplates lists templates the user is part of
+func GetTemplates(user *types.User) ([]types.Project, error) {
+	if user == nil {
+		return nil, utils.NewBadRequestError(errors.New("user is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	templates, err := repository.GetTemplatesByUserID(ctx, &user.ID)
+	if err != nil {
+		return nil, utils.NewInternalError(err)
+	}
+
+	return templates, nil
+}
+
+// cloneProject copies labels and columns of the source, and the rest clone asks for, giving everything new ids.
+// Anyone who can view the source can copy it, inviting its members needs the permission to manage them
+func cloneProject(user *types.User, sourceID *string, clone *types.CloneProject, asTemplate bool) (types.Project, []types.ProjectInvitation, error) {
+	if user == nil || sourceID == nil || clone == nil {
+		return types.Project{}, nil, utils.NewBadRequestError(errors.New("all parameters must not be nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	access, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, *sourceID, types.ProjectPermissionView)
+	if err != nil {
+		return types.Project{}, nil, err
+	}
+
+	if clone.IncludeMembers {
+		if err = policy.Check(&access, types.ProjectResourceProject, *sourceID, types.ProjectPermissionManageMembers); err != nil {
+			return types.Project{}, nil, err
+		}
+	}
+
+	projectClone := types.ProjectClone{
+		CloneProject:        *clone,
+		SourceID:            *sourceID,
+		ID:                  uuid.New().String(),
+		CreatorID:           user.ID,
+		IsTemplate:          asTemplate,
+		InvitationsExpireAt: time.Now().Add(time.Hour * time.Duration(config.Data.ProjectInvitationExpHours)),
+	}
+
+	newProject, err := repository.CloneProject(ctx, &projectClone)
+	if err != nil {
+		return types.Project{}, nil, utils.NewInternalError(err)
+	}
+
+	return newProject, projectClone.Invitations, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/throttle"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/pkg/errors"
+)
+
+func newAttempt(client *types.ClientInfo, account string) throttle.Attempt {
+	attempt := throttle.Attempt{Account: account}
+	if client != nil {
+		attempt.IP = client.IP
+	}
+
+	return attempt
+}
+
+// throttled runs authenticate unless the attempt is locked out. The attempt is reserved as failed before
+// authenticate runs, so concurrent guesses cannot get past the lockout, and is taken back unless
+// authenticate rejects the credentials
+func throttled(attempt throttle.Attempt, authenticate func() (types.AuthUser, error)) (types.AuthUser, error) {
+	if throttle.Default == nil {
+		return authenticate()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reservation, retryAfter, err := throttle.Default.Reserve(ctx, attempt)
+	if err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	if retryAfter > 0 {
+		return types.AuthUser{}, utils.NewTooManyRequestsError(errors.New("too many failed attempts"), retryAfter)
+	}
+
+	authUser, err := authenticate()
+	settleAttempt(ctx, reservation, err)
+
+	return authUser, err
+}
+
+func settleAttempt(ctx context.Context, reservation *throttle.Reservation, authErr error) {
+	if authErr == nil {
+		if err := throttle.Default.Succeed(ctx, reservation); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to reset throttle")
+		}
+		return
+	}
+
+	var appErr utils.AppError
+	if !errors.As(authErr, &appErr) || appErr.Type.Status != http.StatusUnauthorized {
+		if err := throttle.Default.Release(ctx, reservation); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to release throttle reservation")
+		}
+		return
+	}
+
+	outcome := throttle.Default.Fail(reservation)
+	if len(outcome.LockedOut) == 0 {
+		return
+	}
+
+	// the lockout of an account is listed among activity of its user
+	userID := ""
+	if reservation.Account != "" {
+		if user, err := repository.GetUser(ctx, nil, &reservation.Account); err == nil {
+			userID = user.ID
+		}
+	}
+
+	for _, key := range outcome.LockedOut {
+		recordAuthEvent(ctx, types.AuthEventLockout, userID, &types.ClientInfo{IP: reservation.IP}, map[string]any{"key": key})
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/policy"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// ArchiveProject makes the project read-only and hides it from the project list
+func ArchiveProject(user *types.User, projectID *string) (types.Project, error) {
+	return setProjectArchived(user, projectID, true)
+}
+
+func UnarchiveProject(user *types.User, projectID *string) (types.Project, error) {
+	return setProjectArchived(user, projectID, false)
+}
+
+func setProjectArchived(user *types.User, projectID *string, archived bool) (types.Project, error) {
+	if user == nil || projectID == nil {
+		return types.Project{}, utils.NewBadRequestError(errors.New("user or projectID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := policy.Authorize(ctx, user.ID, types.ProjectResourceProject, *projectID, types.ProjectPermissionArchiveProject); err != nil {
+		return types.Project{}, err
+	}
+
+	err := repository.SetProjectArchived(ctx, projectID, archived)
+	if errors.Is(err, pgx.ErrNoRows) && archived {
+		return types.Project{}, utils.NewBadRequestError(errors.New("project is already archived"))
+	} else if errors.Is(err, pgx.ErrNoRows) {
+		return types.Project{}, utils.NewBadRequestError(errors.New("project is not archived"))
+	} else if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
+	project, err := repository.GetProject(ctx, projectID)
+	if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
+	return project, nil
+}
+
+// GetTrashedProjects returns projects in trash the user can restore
+func GetTrashedProjects(user *types.User) ([]types.Project, error) {
+	if user == nil {
+		return nil, utils.NewBadRequestError(errors.New("user is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	projects, err := repository.GetTrashedProjects(ctx, &user.ID)
+	if err != nil {
+		return nil, utils.NewInternalError(err)
+	}
+
+	return projects, nil
+}
+
+// RestoreProject takes the project out of trash, only those allowed to delete the project can restore it
+func RestoreProject(user *types.User, projectID *string) (types.Project, error) {
+	if user == nil || projectID == nil {
+		return types.Project{}, utils.NewBadRequestError(errors.New("user or projectID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := policy.AuthorizeTrashed(ctx, user.ID, types.ProjectResourceProject, *projectID, types.ProjectPermissionDeleteProject); err != nil {
+		return types.Project{}, err
+	}
+
+	err := repository.RestoreProject(ctx, projectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("project with id: %s not found in trash", *projectID)))
+	} else if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
+	project, err := repository.GetProject(ctx, projectID)
+	if err != nil {
+		return types.Project{}, utils.NewInternalError(err)
+	}
+
+	return project, nil
+}
+
+// GetProjectTrash returns columns and rows of the project that are in trash
+func GetProjectTrash(userID *string, projectID *string) (types.ProjectTrash, error) {
+	if userID == nil || projectID == nil {
+		return types.ProjectTrash{}, utils.NewBadRequestError(errors.New("userID or projectID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := policy.Authorize(ctx, *userID, types.ProjectResourceProject, *projectID, types.ProjectPermissionView); err != nil {
+		return types.ProjectTrash{}, err
+	}
+
+	columns, err := repository.GetTrashedColumns(ctx, projectID)
+	if err != nil {
+		return types.ProjectTrash{}, utils.NewInternalError(err)
+	}
+
+	rows, err := repository.GetTrashedRows(ctx, projectID)
+	if err != nil {
+		return types.ProjectTrash{}, utils.NewInternalError(err)
+	}
+
+	return types.ProjectTrash{Columns: columns, Rows: rows}, nil
+}
+
+// RestoreColumn takes the column out of trash along with its rows and puts it after the rest of the columns
+func RestoreColumn(user *types.User, columnID *string) (types.KanbanColumn, []types.KanbanColumn, types.Project, error) {
+	if user == nil || columnID == nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewBadRequestError(errors.New("user or columnID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	access, err := policy.AuthorizeTrashed(ctx, user.ID, types.ProjectResourceColumn, *columnID, types.ProjectPermissionManageBoard)
+	if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, err
+	}
+
+	project, err := repository.GetProject(ctx, &access.ProjectID)
+	if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	if project.DeletedAt != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewBadRequestError(errors.New("restore the project first"))
+	}
+
+	err = repository.RestoreKanbanColumn(ctx, columnID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("column with id: %s not found in trash", *columnID)))
+	} else if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	column, err := repository.GetKanbanColumn(ctx, columnID)
+	if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	rows, err := repository.GetRows(ctx, columnID)
+	if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
+	}
+	column.Rows = &rows
+
+	columns, err := repository.GetColumns(ctx, &access.ProjectID)
+	if err != nil {
+		return types.KanbanColumn{}, []types.KanbanColumn{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	return column, columns, project, nil
+}
+
+// RestoreRow takes the row out of trash and puts it at the end of its column
+func RestoreRow(userID *string, rowID *string) (types.KanbanRow, []types.KanbanRow, types.Project, error) {
+	if userID == nil || rowID == nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("userID or rowID is nil"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	access, err := policy.AuthorizeTrashed(ctx, *userID, types.ProjectResourceRow, *rowID, types.ProjectPermissionEditRows)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, err
+	}
+
+	project, err := repository.GetProject(ctx, &access.ProjectID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	if project.DeletedAt != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("restore the project first"))
+	}
+
+	row, err := repository.GetRow(ctx, rowID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	column, err := repository.GetKanbanColumn(ctx, &row.ColumnID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	if column.DeletedAt != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewBadRequestError(errors.New("restore the column first"))
+	}
+
+	err = repository.RestoreRow(ctx, rowID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewNotFoundError(errors.New(fmt.Sprintf("row with id: %s not found in trash", *rowID)))
+	} else if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	row, err = repository.GetRow(ctx, rowID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	rows, err := repository.GetRows(ctx, &row.ColumnID)
+	if err != nil {
+		return types.KanbanRow{}, []types.KanbanRow{}, types.Project{}, utils.NewInternalError(err)
+	}
+
+	return row, rows, project, nil
+}
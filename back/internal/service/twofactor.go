@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/finkabaj/squid/back/internal/totp"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/finkabaj/squid/back/internal/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	recoveryCodesCount = 10
+	// twoFactorMaxAttempts is the number of codes that can be tried against a single login challenge
+	twoFactorMaxAttempts = 5
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func twoFactorAlreadyEnabled() utils.AppError {
+	return utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusConflict,
+			Message: "Two-factor authentication is already enabled",
+		},
+	}
+}
+
+// EnrollTwoFactor generates new TOTP secret for the user. It is not used for login until confirmed with ConfirmTwoFactor
+func EnrollTwoFactor(user *types.User) (types.TwoFactorEnrollment, error) {
+	if user == nil {
+		return types.TwoFactorEnrollment{}, utils.NewBadRequestError(errors.New("user is nil"))
+	}
+
+	if user.TwoFactorEnabled {
+		return types.TwoFactorEnrollment{}, twoFactorAlreadyEnabled()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return types.TwoFactorEnrollment{}, utils.NewInternalError(err)
+	}
+
+	if _, err = repository.UpsertUserTOTP(ctx, &user.ID, &secret); err != nil {
+		return types.TwoFactorEnrollment{}, utils.NewInternalError(err)
+	}
+
+	return types.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(config.Data.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves the authenticator app works
+// and returns recovery codes. Recovery codes are not retrievable later
+func ConfirmTwoFactor(user *types.User, code *types.TwoFactorCode, client *types.ClientInfo) (types.RecoveryCodes, error) {
+	if user == nil || code == nil {
+		return types.RecoveryCodes{}, utils.NewBadRequestError(errors.New("user or code is nil"))
+	}
+
+	if user.TwoFactorEnabled {
+		return types.RecoveryCodes{}, twoFactorAlreadyEnabled()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userTOTP, err := repository.GetUserTOTP(ctx, &user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.RecoveryCodes{}, utils.NewBadRequestError(errors.New("two-factor enrollment is not started"))
+	} else if err != nil {
+		return types.RecoveryCodes{}, utils.NewInternalError(err)
+	}
+
+	step, ok := totp.Validate(userTOTP.Secret, code.Code, time.Now())
+	if !ok {
+		return types.RecoveryCodes{}, utils.NewBadRequestError(errors.New("invalid code"))
+	}
+
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return types.RecoveryCodes{}, utils.NewInternalError(err)
+	}
+
+	_, err = repository.EnableTwoFactor(ctx, &user.ID, step, codeHashes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.RecoveryCodes{}, utils.NewBadRequestError(errors.New("two-factor enrollment is not started"))
+	} else if err != nil {
+		return types.RecoveryCodes{}, utils.NewInternalError(err)
+	}
+
+	recordAuthEvent(ctx, types.AuthEventTwoFactorEnabled, user.ID, client, nil)
+
+	return types.RecoveryCodes{Codes: codes}, nil
+}
+
+func DisableTwoFactor(user *types.User, sessionID *string, confirmation *types.PasswordConfirmation, client *types.ClientInfo) (types.User, error) {
+	if user == nil || sessionID == nil || confirmation == nil {
+		return types.User{}, utils.NewBadRequestError(errors.New("user, sessionID or confirmation is nil"))
+	}
+
+	if !user.TwoFactorEnabled {
+		return types.User{}, utils.NewBadRequestError(errors.New("two-factor authentication is not enabled"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := confirmIdentity(ctx, user, sessionID, confirmation); err != nil {
+		return types.User{}, err
+	}
+
+	updatedUser, err := repository.DisableTwoFactor(ctx, &user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, utils.NewNotFoundError(errors.New("user not found"))
+	} else if err != nil {
+		return types.User{}, utils.NewInternalError(err)
+	}
+
+	recordAuthEvent(ctx, types.AuthEventTwoFactorDisabled, user.ID, client, nil)
+
+	return updatedUser, nil
+}
+
+// RegenerateRecoveryCodes invalidates all recovery codes of the user and returns new ones
+func RegenerateRecoveryCodes(user *types.User, sessionID *string, confirmation *types.PasswordConfirmation) (types.RecoveryCodes, error) {
+	if user == nil || sessionID == nil || confirmation == nil {
+		return types.RecoveryCodes{}, utils.NewBadRequestError(errors.New("user, sessionID or confirmation is nil"))
+	}
+
+	if !user.TwoFactorEnabled {
+		return types.RecoveryCodes{}, utils.NewBadRequestError(errors.New("two-factor authentication is not enabled"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := confirmIdentity(ctx, user, sessionID, confirmation); err != nil {
+		return types.RecoveryCodes{}, err
+	}
+
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return types.RecoveryCodes{}, utils.NewInternalError(err)
+	}
+
+	if err = repository.ReplaceRecoveryCodes(ctx, &user.ID, codeHashes); err != nil {
+		return types.RecoveryCodes{}, utils.NewInternalError(err)
+	}
+
+	return types.RecoveryCodes{Codes: codes}, nil
+}
+
+// createLoginChallenge is the first step of login with two-factor authentication. The challenge is exchanged
+// for the token pair in LoginTwoFactor
+func createLoginChallenge(ctx context.Context, user *types.User) (types.AuthUser, error) {
+	token, tokenHash, err := utils.GenerateToken()
+	if err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	challenge, err := repository.CreateTwoFactorChallenge(ctx, &types.TwoFactorChallenge{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(time.Minute * time.Duration(config.Data.TwoFactorChallengeExpMinutes)),
+	})
+	if err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	return types.AuthUser{
+		User: *user,
+		Challenge: &types.LoginChallenge{
+			TwoFactorRequired: true,
+			Challenge:         token,
+			ExpiresAt:         challenge.ExpiresAt,
+		},
+	}, nil
+}
+
+func invalidLoginChallenge() utils.AppError {
+	return utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid or expired challenge",
+		},
+	}
+}
+
+func LoginTwoFactor(login *types.LoginTwoFactor, client *types.ClientInfo) (types.AuthUser, error) {
+	if login == nil {
+		return types.AuthUser{}, utils.NewBadRequestError(errors.New("login is nil"))
+	}
+
+	return throttled(newAttempt(client, ""), func() (types.AuthUser, error) {
+		return loginWithSecondFactor(login, client)
+	})
+}
+
+func loginWithSecondFactor(login *types.LoginTwoFactor, client *types.ClientInfo) (types.AuthUser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tokenHash := utils.HashToken(login.Challenge)
+
+	challenge, err := repository.AttemptTwoFactorChallenge(ctx, &tokenHash, twoFactorMaxAttempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.AuthUser{}, invalidLoginChallenge()
+	} else if err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	user, err := repository.GetUser(ctx, &challenge.UserID, nil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.AuthUser{}, invalidLoginChallenge()
+	} else if err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	if user.DisabledAt != nil {
+		return types.AuthUser{}, accountDisabled()
+	}
+
+	if err = verifySecondFactor(ctx, &user, login.Code); err != nil {
+		recordAuthEvent(ctx, types.AuthEventLoginFailed, user.ID, client, map[string]any{"reason": "invalid_second_factor"})
+		return types.AuthUser{}, err
+	}
+
+	if err = repository.DeleteTwoFactorChallenges(ctx, &user.ID, &challenge.ID); err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	if err = repository.DeleteExpiredRefreshTokens(ctx, &user.ID); err != nil {
+		return types.AuthUser{}, utils.NewInternalError(err)
+	}
+
+	return startLoginSession(ctx, &user, client, "two_factor")
+}
+
+// verifySecondFactor accepts either current TOTP code or unused recovery code of the user
+func verifySecondFactor(ctx context.Context, user *types.User, code string) error {
+	invalidCode := utils.AppError{
+		Type: utils.ErrorType{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid code",
+		},
+	}
+
+	userTOTP, err := repository.GetUserTOTP(ctx, &user.ID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && userTOTP.ConfirmedAt == nil) {
+		return invalidCode
+	} else if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	if step, ok := totp.Validate(userTOTP.Secret, code, time.Now()); ok {
+		err = repository.UseTOTPStep(ctx, &user.ID, step)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return invalidCode
+		} else if err != nil {
+			return utils.NewInternalError(err)
+		}
+
+		return nil
+	}
+
+	codeHash := utils.HashToken(normalizeRecoveryCode(code))
+
+	err = repository.UseRecoveryCode(ctx, &user.ID, &codeHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return invalidCode
+	} else if err != nil {
+		return utils.NewInternalError(err)
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes returns recovery codes formatted as xxxxx-xxxxx along with their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodesCount)
+	codeHashes := make([]string, recoveryCodesCount)
+
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		codeHashes[i] = utils.HashToken(code)
+	}
+
+	return codes, codeHashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,43 @@
+// Package sessions deletes refresh tokens of every user once they expire, the ones of users that never sign in
+// again would be kept forever otherwise
+package sessions
+
+import (
+	"context"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/pkg/errors"
+)
+
+// purgeInterval is how often expired refresh tokens are deleted
+const purgeInterval = time.Hour
+
+// InitSessions purges expired refresh tokens and keeps purging them every purgeInterval
+func InitSessions() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := purge(ctx); err != nil {
+		return err
+	}
+
+	go purgeLoop()
+
+	return nil
+}
+
+func purge(ctx context.Context) error {
+	return errors.Wrap(repository.PurgeRefreshTokens(ctx), "error purging refresh tokens")
+}
+
+func purgeLoop() {
+	for range time.Tick(purgeInterval) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := purge(ctx); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to purge refresh tokens")
+		}
+		cancel()
+	}
+}
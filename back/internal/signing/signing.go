@@ -0,0 +1,362 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const (
+	// rotationCheckInterval is how often keys are reloaded and checked for rotation
+	rotationCheckInterval = 10 * time.Minute
+	rsaKeyBits            = 2048
+)
+
+// Store persists signing keys shared by all instances
+type Store interface {
+	// GetSigningKeys returns keys that still verify tokens, the newest first
+	GetSigningKeys(ctx context.Context) ([]types.SigningKey, error)
+	// RotateSigningKey retires active keys and activates key, unless an active key was created after notBefore
+	RotateSigningKey(ctx context.Context, key *types.SigningKey, notBefore time.Time, retention time.Duration) (bool, error)
+	DeleteExpiredSigningKeys(ctx context.Context) error
+}
+
+// Default is the keyring tokens are signed and verified with
+var Default *Keyring
+
+// InitSigning configures Default keyring, creating the first key when the store has none,
+// and starts scheduled rotation
+func InitSigning(store Store) error {
+	switch config.Data.JWTAlgorithm {
+	case AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return errors.Errorf("unsupported jwt algorithm: %s", config.Data.JWTAlgorithm)
+	}
+
+	keyring := NewKeyring(
+		store,
+		config.Data.JWTAlgorithm,
+		time.Duration(config.Data.JWTKeyRotationHours)*time.Hour,
+		// a retired key has to verify every token it signed, refresh tokens live the longest
+		time.Duration(config.Data.RefreshTokenExpHours)*time.Hour+time.Duration(config.Data.AccessTokenExpMinutes)*time.Minute,
+		config.Data.JWTSecret,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := keyring.rotateIfDue(ctx); err != nil {
+		return err
+	}
+
+	Default = keyring
+
+	go keyring.rotateLoop()
+
+	return nil
+}
+
+type key struct {
+	id         string
+	algorithm  string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+	createdAt  time.Time
+	retired    bool
+}
+
+type Keyring struct {
+	store     Store
+	algorithm string
+	rotation  time.Duration
+	retention time.Duration
+	// legacySecret verifies HS256 tokens issued before asymmetric signing, nil disables them
+	legacySecret []byte
+
+	mu         sync.RWMutex
+	keys       map[string]*key
+	signingKey *key
+	// unknownKid is the key id the last reload was done for and did not find, it is not reloaded for again
+	// until keys are loaded for another reason
+	unknownKid string
+}
+
+func NewKeyring(store Store, algorithm string, rotation, retention time.Duration, legacySecret []byte) *Keyring {
+	if len(legacySecret) == 0 {
+		legacySecret = nil
+	}
+
+	return &Keyring{
+		store:        store,
+		algorithm:    algorithm,
+		rotation:     rotation,
+		retention:    retention,
+		legacySecret: legacySecret,
+		keys:         map[string]*key{},
+	}
+}
+
+// Sign signs claims with the active key, putting its id in the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	signingKey := k.signingKey
+	k.mu.RUnlock()
+
+	if signingKey == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(signingKey.method, claims)
+	token.Header["kid"] = signingKey.id
+
+	tokenStr, err := token.SignedString(signingKey.privateKey)
+
+	return tokenStr, errors.WithStack(err)
+}
+
+// Parse verifies signature of the token with the key named by its kid header
+func (k *Keyring) Parse(tokenString string) (*jwt.Token, error) {
+	methods := []string{AlgorithmRS256, AlgorithmEdDSA}
+	if k.legacySecret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	return jwt.Parse(tokenString, k.keyfunc, jwt.WithValidMethods(methods))
+}
+
+func (k *Keyring) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if kid != "" || k.legacySecret == nil {
+			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return k.legacySecret, nil
+	}
+
+	verificationKey, err := k.key(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	// the algorithm is bound to the key, so a token cannot pick another one
+	if verificationKey.algorithm != token.Method.Alg() {
+		return nil, errors.Errorf("key %q does not sign with %v", kid, token.Header["alg"])
+	}
+
+	return verificationKey.privateKey.Public(), nil
+}
+
+// key returns verification key by id, reloading keys when the id is unknown, e.g. because
+// another instance has just rotated. An id the last reload failed for does not reload again
+func (k *Keyring) key(kid string) (*key, error) {
+	k.mu.RLock()
+	verificationKey, ok := k.keys[kid]
+	failed := k.unknownKid == kid
+	k.mu.RUnlock()
+
+	if ok {
+		return verificationKey, nil
+	}
+
+	if kid == "" || failed {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := k.load(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err == nil {
+		if verificationKey, ok = k.keys[kid]; ok {
+			return verificationKey, nil
+		}
+
+		err = errors.Errorf("unknown signing key %q", kid)
+	}
+
+	k.unknownKid = kid
+
+	return nil, err
+}
+
+// JWKS returns public keys of every key that verifies tokens
+func (k *Keyring) JWKS() JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(k.keys))}
+	for _, verificationKey := range k.keys {
+		set.Keys = append(set.Keys, newJWK(verificationKey))
+	}
+
+	return set
+}
+
+func (k *Keyring) load(ctx context.Context) error {
+	signingKeys, err := k.store.GetSigningKeys(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error loading signing keys")
+	}
+
+	keys := make(map[string]*key, len(signingKeys))
+	var signingKey *key
+
+	for _, signingKeyData := range signingKeys {
+		parsed, err := parseKey(&signingKeyData)
+		if err != nil {
+			return err
+		}
+
+		keys[parsed.id] = parsed
+		if !parsed.retired && (signingKey == nil || parsed.createdAt.After(signingKey.createdAt)) {
+			signingKey = parsed
+		}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.signingKey = signingKey
+	k.unknownKid = ""
+	k.mu.Unlock()
+
+	return nil
+}
+
+// rotateIfDue activates new key when there is no active key or the active one is older than rotation period
+func (k *Keyring) rotateIfDue(ctx context.Context) error {
+	if err := k.load(ctx); err != nil {
+		return err
+	}
+
+	k.mu.RLock()
+	signingKey := k.signingKey
+	k.mu.RUnlock()
+
+	if signingKey != nil && signingKey.algorithm == k.algorithm && time.Since(signingKey.createdAt) < k.rotation {
+		return nil
+	}
+
+	newKey, err := generateKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+
+	// another instance may have rotated since the keys were loaded
+	var notBefore time.Time
+	if signingKey != nil {
+		notBefore = signingKey.createdAt
+	}
+
+	rotated, err := k.store.RotateSigningKey(ctx, &newKey, notBefore, k.retention)
+	if err != nil {
+		return errors.Wrap(err, "error rotating signing key")
+	}
+
+	if rotated {
+		logger.Logger.Info().
+			Str("event", "signing_key_rotated").
+			Str("kid", newKey.ID).
+			Str("algorithm", newKey.Algorithm).
+			Msg("Signing key rotated")
+	}
+
+	return k.load(ctx)
+}
+
+func (k *Keyring) rotateLoop() {
+	for range time.Tick(rotationCheckInterval) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+		if err := k.rotateIfDue(ctx); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to rotate signing key")
+		}
+
+		if err := k.store.DeleteExpiredSigningKeys(ctx); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to delete expired signing keys")
+		}
+
+		cancel()
+	}
+}
+
+func generateKey(algorithm string) (types.SigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return types.SigningKey{}, errors.Errorf("unsupported jwt algorithm: %s", algorithm)
+	}
+
+	if err != nil {
+		return types.SigningKey{}, errors.Wrap(err, "error generating signing key")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return types.SigningKey{}, errors.WithStack(err)
+	}
+
+	return types.SigningKey{
+		ID:         uuid.New().String(),
+		Algorithm:  algorithm,
+		PrivateKey: der,
+	}, nil
+}
+
+func parseKey(signingKey *types.SigningKey) (*key, error) {
+	privateKey, err := x509.ParsePKCS8PrivateKey(signingKey.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid signing key %q", signingKey.ID)
+	}
+
+	parsed := &key{
+		id:        signingKey.ID,
+		algorithm: signingKey.Algorithm,
+		createdAt: signingKey.CreatedAt,
+		retired:   signingKey.RetiredAt != nil,
+	}
+
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		parsed.privateKey = privateKey
+	case ed25519.PrivateKey:
+		parsed.privateKey = privateKey
+	default:
+		return nil, errors.Errorf("unsupported type %T of signing key %q", privateKey, signingKey.ID)
+	}
+
+	parsed.method = jwt.GetSigningMethod(signingKey.Algorithm)
+	if parsed.method == nil {
+		return nil, errors.Errorf("unsupported algorithm %s of signing key %q", signingKey.Algorithm, signingKey.ID)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,276 @@
+package signing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testLegacySecret = []byte("legacy secret")
+
+// memoryStore keeps keys the way the database does and counts how often they are loaded
+type memoryStore struct {
+	keys  []types.SigningKey
+	loads int
+	// beforeRotate runs once before the next rotation, e.g. to rotate from another instance first
+	beforeRotate func()
+}
+
+func (s *memoryStore) GetSigningKeys(ctx context.Context) ([]types.SigningKey, error) {
+	s.loads++
+
+	return append([]types.SigningKey{}, s.keys...), nil
+}
+
+func (s *memoryStore) RotateSigningKey(ctx context.Context, key *types.SigningKey, notBefore time.Time, retention time.Duration) (bool, error) {
+	if s.beforeRotate != nil {
+		s.beforeRotate()
+		s.beforeRotate = nil
+	}
+
+	now := time.Now()
+	for _, active := range s.keys {
+		if active.RetiredAt == nil && active.CreatedAt.After(notBefore) {
+			return false, nil
+		}
+	}
+
+	for i := range s.keys {
+		if s.keys[i].RetiredAt == nil {
+			expiresAt := now.Add(retention)
+			s.keys[i].RetiredAt, s.keys[i].ExpiresAt = &now, &expiresAt
+		}
+	}
+
+	key.CreatedAt = now
+	s.keys = append(s.keys, *key)
+
+	return true, nil
+}
+
+func (s *memoryStore) DeleteExpiredSigningKeys(ctx context.Context) error {
+	return nil
+}
+
+func newTestKey(t *testing.T, algorithm string, age time.Duration) types.SigningKey {
+	t.Helper()
+
+	signingKey, err := generateKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey.CreatedAt = time.Now().Add(-age)
+
+	return signingKey
+}
+
+func newTestKeyring(t *testing.T, store *memoryStore, legacySecret []byte) *Keyring {
+	t.Helper()
+
+	keyring := NewKeyring(store, AlgorithmEdDSA, time.Hour, time.Hour, legacySecret)
+	if err := keyring.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+func newToken(method jwt.SigningMethod, kid string) *jwt.Token {
+	token := jwt.New(method)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	return token
+}
+
+func TestKeyfuncLegacy(t *testing.T) {
+	cases := []struct {
+		name         string
+		legacySecret []byte
+		kid          string
+		valid        bool
+	}{
+		{"legacy token", testLegacySecret, "", true},
+		{"legacy token with kid", testLegacySecret, "some-kid", false},
+		{"legacy tokens disabled", nil, "", false},
+		{"legacy tokens disabled with kid", nil, "some-kid", false},
+	}
+
+	for _, tc := range cases {
+		keyring := newTestKeyring(t, &memoryStore{}, tc.legacySecret)
+
+		verificationKey, err := keyring.keyfunc(newToken(jwt.SigningMethodHS256, tc.kid))
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("%s: keyfunc error = %v, want valid %v", tc.name, err, tc.valid)
+		} else if tc.valid && string(verificationKey.([]byte)) != string(testLegacySecret) {
+			t.Errorf("%s: keyfunc = %v, want legacy secret", tc.name, verificationKey)
+		}
+	}
+}
+
+func TestKeyfuncAlgorithm(t *testing.T) {
+	signingKey := newTestKey(t, AlgorithmEdDSA, 0)
+	keyring := newTestKeyring(t, &memoryStore{keys: []types.SigningKey{signingKey}}, testLegacySecret)
+
+	cases := []struct {
+		name   string
+		method jwt.SigningMethod
+		valid  bool
+	}{
+		{"key algorithm", jwt.SigningMethodEdDSA, true},
+		{"other algorithm", jwt.SigningMethodRS256, false},
+		{"symmetric algorithm", jwt.SigningMethodHS256, false},
+	}
+
+	for _, tc := range cases {
+		_, err := keyring.keyfunc(newToken(tc.method, signingKey.ID))
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("%s: keyfunc error = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestSignParse(t *testing.T) {
+	keyring := newTestKeyring(t, &memoryStore{keys: []types.SigningKey{newTestKey(t, AlgorithmEdDSA, 0)}}, nil)
+
+	tokenStr, err := keyring.Sign(jwt.MapClaims{"sub": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := keyring.Parse(tokenStr)
+	if err != nil {
+		t.Fatalf("Parse of signed token: %v", err)
+	}
+
+	if subject, _ := token.Claims.GetSubject(); subject != "user" {
+		t.Errorf("Parse subject = %q, want user", subject)
+	}
+
+	legacyStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user"}).SignedString(testLegacySecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = keyring.Parse(legacyStr); err == nil {
+		t.Error("Parse accepted legacy token with legacy tokens disabled")
+	}
+}
+
+func TestKeyReload(t *testing.T) {
+	known := newTestKey(t, AlgorithmEdDSA, 0)
+	rotated := newTestKey(t, AlgorithmEdDSA, 0)
+
+	store := &memoryStore{keys: []types.SigningKey{known}}
+	keyring := newTestKeyring(t, store, nil)
+
+	// loads counts every load of keys, including the one of newTestKeyring
+	steps := []struct {
+		name  string
+		kid   string
+		found bool
+		loads int
+	}{
+		{"known key", known.ID, true, 1},
+		{"unknown key", "missing", false, 2},
+		{"same unknown key", "missing", false, 2},
+		{"another unknown key", "other", false, 3},
+		{"key of another instance", rotated.ID, true, 4},
+		{"unknown key after reload for another one", "missing", false, 5},
+		{"without kid", "", false, 5},
+	}
+
+	for _, step := range steps {
+		if step.kid == rotated.ID {
+			store.keys = append(store.keys, rotated)
+		}
+
+		verificationKey, err := keyring.key(step.kid)
+		if found := err == nil; found != step.found {
+			t.Errorf("%s: key(%q) error = %v, want found %v", step.name, step.kid, err, step.found)
+		} else if found && verificationKey.id != step.kid {
+			t.Errorf("%s: key(%q) = %q", step.name, step.kid, verificationKey.id)
+		}
+
+		if store.loads != step.loads {
+			t.Errorf("%s: loads = %d, want %d", step.name, store.loads, step.loads)
+		}
+	}
+}
+
+func TestRotateIfDue(t *testing.T) {
+	ctx := context.Background()
+
+	fresh := newTestKey(t, AlgorithmEdDSA, time.Minute)
+	old := newTestKey(t, AlgorithmEdDSA, 2*time.Hour)
+	otherAlgorithm := newTestKey(t, AlgorithmRS256, time.Minute)
+	otherInstance := newTestKey(t, AlgorithmEdDSA, 0)
+
+	cases := []struct {
+		name         string
+		keys         []types.SigningKey
+		beforeRotate []types.SigningKey
+		// signingKey is the id of the key to sign with after rotation, empty for the key generated by rotation
+		signingKey string
+		keyCount   int
+	}{
+		{name: "no keys", keyCount: 1},
+		{name: "fresh key", keys: []types.SigningKey{fresh}, signingKey: fresh.ID, keyCount: 1},
+		{name: "old key", keys: []types.SigningKey{old}, keyCount: 2},
+		{name: "algorithm changed", keys: []types.SigningKey{otherAlgorithm}, keyCount: 2},
+		{
+			name:         "rotated by another instance",
+			keys:         []types.SigningKey{old},
+			beforeRotate: []types.SigningKey{otherInstance},
+			signingKey:   otherInstance.ID,
+			keyCount:     2,
+		},
+	}
+
+	for _, tc := range cases {
+		store := &memoryStore{keys: append([]types.SigningKey{}, tc.keys...)}
+		if tc.beforeRotate != nil {
+			store.beforeRotate = func() {
+				for i := range store.keys {
+					store.keys[i].RetiredAt = &otherInstance.CreatedAt
+				}
+
+				store.keys = append(store.keys, tc.beforeRotate...)
+			}
+		}
+
+		keyring := NewKeyring(store, AlgorithmEdDSA, time.Hour, time.Hour, nil)
+		if err := keyring.rotateIfDue(ctx); err != nil {
+			t.Fatalf("%s: rotateIfDue: %v", tc.name, err)
+		}
+
+		if keyring.signingKey == nil {
+			t.Errorf("%s: no signing key after rotateIfDue", tc.name)
+			continue
+		}
+
+		previous := map[string]bool{}
+		for _, signingKey := range append(tc.keys, tc.beforeRotate...) {
+			previous[signingKey.ID] = true
+		}
+
+		if tc.signingKey != "" && keyring.signingKey.id != tc.signingKey {
+			t.Errorf("%s: signing key = %q, want %q", tc.name, keyring.signingKey.id, tc.signingKey)
+		} else if tc.signingKey == "" && previous[keyring.signingKey.id] {
+			t.Errorf("%s: signing key = %q, want a new one", tc.name, keyring.signingKey.id)
+		}
+
+		if keyring.signingKey.algorithm != AlgorithmEdDSA {
+			t.Errorf("%s: signing key algorithm = %s, want %s", tc.name, keyring.signingKey.algorithm, AlgorithmEdDSA)
+		}
+
+		if len(keyring.keys) != tc.keyCount {
+			t.Errorf("%s: %d keys after rotateIfDue, want %d", tc.name, len(keyring.keys), tc.keyCount)
+		}
+	}
+}
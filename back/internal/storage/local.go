@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// LocalStorage keeps files in a directory served by the server itself
+type LocalStorage struct {
+	dir       string
+	publicURL string
+}
+
+func NewLocalStorage(dir, publicURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "error creating storage directory %s", dir)
+	}
+
+	return &LocalStorage{dir: dir, publicURL: publicURL}, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// written aside and renamed, so the file is never served half written
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.Rename(tmp, path))
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return joinURL(s.publicURL, key)
+}
+
+// Handler serves stored files. Directories are not listed, so files can only be found by their keys
+func (s *LocalStorage) Handler() http.Handler {
+	fileServer := http.FileServer(fileOnlyFS{http.Dir(s.dir)})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// keys are never reused, a changed file gets a new key
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if !filepath.IsLocal(key) {
+		return "", errors.Errorf("invalid storage key %q", key)
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+type fileOnlyFS struct {
+	fs http.FileSystem
+}
+
+func (f fileOnlyFS) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if stat.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+
+	return file, nil
+}
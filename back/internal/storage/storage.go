@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/pkg/errors"
+)
+
+// Storage keeps publicly readable files, e.g. avatars
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes the file, deleting a missing file is not an error
+	Delete(ctx context.Context, key string) error
+	// URL returns public url of the file
+	URL(key string) string
+}
+
+// LocalURLPath is where the server serves files of local storage
+const LocalURLPath = "/uploads/"
+
+// Default is the storage configured in config
+var Default Storage
+
+// InitStorage configures Default storage
+func InitStorage() error {
+	switch config.Data.Storage {
+	case "local", "":
+		publicURL := config.Data.StoragePublicURL
+		if publicURL == "" {
+			publicURL = fmt.Sprintf("http://%s:%d%s", config.Data.Host, config.Data.Port, LocalURLPath)
+		}
+
+		local, err := NewLocalStorage(config.Data.StorageLocalDir, publicURL)
+		if err != nil {
+			return err
+		}
+		Default = local
+	case "s3":
+		if config.Data.S3Endpoint == "" || config.Data.S3Bucket == "" {
+			return errors.New("s3 endpoint and bucket are required when storage is s3")
+		}
+
+		publicURL := config.Data.StoragePublicURL
+		if publicURL == "" {
+			publicURL = strings.TrimSuffix(config.Data.S3Endpoint, "/") + "/" + config.Data.S3Bucket
+		}
+
+		Default = NewS3Storage(
+			config.Data.S3Endpoint,
+			config.Data.S3Region,
+			config.Data.S3Bucket,
+			config.Data.S3AccessKeyID,
+			config.Data.S3SecretAccessKey,
+			publicURL,
+		)
+	default:
+		return errors.Errorf("unknown storage: %s", config.Data.Storage)
+	}
+
+	return nil
+}
+
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
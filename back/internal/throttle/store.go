@@ -0,0 +1,105 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/repository"
+)
+
+type memoryEntry struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// MemoryStore keeps counters in process memory. Every instance throttles on its own
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+	}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, key string, window time.Duration, delay func(int) time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	} else if lockedFor := time.Until(entry.lockedUntil); lockedFor > 0 {
+		return 0, lockedFor, nil
+	} else if time.Since(entry.lastFailureAt) > window {
+		entry.failures = 0
+	}
+
+	entry.failures++
+	entry.lastFailureAt = time.Now()
+	entry.lockedUntil = entry.lastFailureAt.Add(delay(entry.failures))
+
+	return entry.failures, 0, nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok {
+		entry.failures = max(entry.failures-1, 0)
+		entry.lockedUntil = time.Time{}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+func (s *MemoryStore) Purge(_ context.Context, window time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, entry := range s.entries {
+		if time.Since(entry.lastFailureAt) > window && time.Now().After(entry.lockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+
+	return nil
+}
+
+// PostgresStore shares counters between instances through authThrottles table
+type PostgresStore struct{}
+
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{}
+}
+
+func (s *PostgresStore) Reserve(ctx context.Context, key string, window time.Duration, delay func(int) time.Duration) (int, time.Duration, error) {
+	return repository.ReserveThrottle(ctx, &key, window, delay)
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	return repository.ReleaseThrottle(ctx, &key)
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return repository.DeleteThrottle(ctx, &key)
+}
+
+func (s *PostgresStore) Purge(ctx context.Context, window time.Duration) error {
+	return repository.PurgeThrottles(ctx, window)
+}
@@ -0,0 +1,249 @@
+package throttle
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/pkg/errors"
+)
+
+// Store keeps failure counters and locks of throttled keys
+type Store interface {
+	// Reserve counts an attempt of the key as failed up front unless the key is locked, in which case
+	// it returns for how long. The key is locked for delay of the new count in the same step, so that
+	// concurrent attempts see the lock. Failures that happened more than window ago are forgotten
+	Reserve(ctx context.Context, key string, window time.Duration, delay func(failures int) time.Duration) (int, time.Duration, error)
+	// Release takes back a reserved attempt that did not fail, lifting the lock it caused
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+	// Purge forgets keys without failures in window that are not locked
+	Purge(ctx context.Context, window time.Duration) error
+}
+
+// Policy describes how many failures in a row a key tolerates
+type Policy struct {
+	// FreeAttempts are failures without any delay, each further failure doubles the delay
+	FreeAttempts int
+	// LockoutAttempts are failures after which the key is locked out for the lockout duration
+	LockoutAttempts int
+}
+
+// KindRefresh is the kind of attempts to refresh a session, failed refreshes are counted apart from failed
+// logins, so that stale refresh cookies cannot lock an address out of signing in
+const KindRefresh = "refresh"
+
+// Attempt is an authentication attempt from the IP, optionally against the account. Kind separates counters of
+// attempts from the same IP, the default one is shared by login and second factor
+type Attempt struct {
+	Kind    string
+	IP      string
+	Account string
+}
+
+// Reservation is an attempt counted as failed until it is settled
+type Reservation struct {
+	Attempt
+	// failures are counts of the keys including the reserved attempt
+	failures map[string]int
+}
+
+// Outcome of a failed attempt
+type Outcome struct {
+	// RetryAfter is the longest delay imposed on keys of the attempt
+	RetryAfter time.Duration
+	// LockedOut are keys that reached lockout with this attempt
+	LockedOut []string
+}
+
+// Default is the throttler configured in config, nil disables throttling
+var Default *Throttler
+
+// InitThrottle configures Default throttler and starts purging forgotten keys
+func InitThrottle() error {
+	var store Store
+	switch config.Data.ThrottleStore {
+	case "postgres":
+		store = NewPostgresStore()
+	case "memory", "":
+		store = NewMemoryStore()
+	default:
+		return errors.Errorf("unknown throttle store: %s", config.Data.ThrottleStore)
+	}
+
+	Default = New(
+		store,
+		Policy{FreeAttempts: config.Data.ThrottleIPFreeAttempts, LockoutAttempts: config.Data.ThrottleIPLockoutAttempts},
+		Policy{FreeAttempts: config.Data.ThrottleAccountFreeAttempts, LockoutAttempts: config.Data.ThrottleAccountLockoutAttempts},
+		time.Duration(config.Data.ThrottleBaseDelaySeconds)*time.Second,
+		time.Duration(config.Data.ThrottleLockoutMinutes)*time.Minute,
+		time.Duration(config.Data.ThrottleWindowMinutes)*time.Minute,
+	)
+
+	go Default.purgeLoop()
+
+	return nil
+}
+
+type Throttler struct {
+	store     Store
+	ip        Policy
+	account   Policy
+	baseDelay time.Duration
+	lockout   time.Duration
+	window    time.Duration
+}
+
+func New(store Store, ip Policy, account Policy, baseDelay, lockout, window time.Duration) *Throttler {
+	return &Throttler{
+		store:     store,
+		ip:        ip,
+		account:   account,
+		baseDelay: baseDelay,
+		lockout:   lockout,
+		window:    window,
+	}
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+func AccountKey(account string) string {
+	return "account:" + strings.ToLower(account)
+}
+
+// Reserve counts the attempt as failed before it is made, so that concurrent attempts cannot get past
+// the limits. It returns for how long the attempt has to wait when one of its keys is locked
+func (t *Throttler) Reserve(ctx context.Context, attempt Attempt) (*Reservation, time.Duration, error) {
+	reservation := &Reservation{Attempt: attempt, failures: make(map[string]int, 2)}
+	var retryAfter time.Duration
+
+	for key, policy := range t.policies(attempt) {
+		failures, lockedFor, err := t.store.Reserve(ctx, key, t.window, func(failures int) time.Duration {
+			return t.delay(policy, failures)
+		})
+		if err != nil {
+			t.release(ctx, reservation)
+			return nil, 0, err
+		}
+
+		if lockedFor > 0 {
+			retryAfter = max(retryAfter, lockedFor)
+			continue
+		}
+
+		reservation.failures[key] = failures
+	}
+
+	if retryAfter > 0 {
+		t.release(ctx, reservation)
+		return nil, retryAfter, nil
+	}
+
+	return reservation, 0, nil
+}
+
+// Fail settles the reservation as failed attempt, its keys stay locked according to their policies
+func (t *Throttler) Fail(reservation *Reservation) Outcome {
+	var outcome Outcome
+
+	for key, policy := range t.policies(reservation.Attempt) {
+		failures, ok := reservation.failures[key]
+		if !ok {
+			continue
+		}
+
+		outcome.RetryAfter = max(outcome.RetryAfter, t.delay(policy, failures))
+		if failures == policy.LockoutAttempts {
+			outcome.LockedOut = append(outcome.LockedOut, key)
+		}
+	}
+
+	return outcome
+}
+
+// Succeed forgets failures of the account. Failures of the IP are kept, so an attacker
+// cannot reset them by signing in to own account in between guesses, only the reserved one is taken back
+func (t *Throttler) Succeed(ctx context.Context, reservation *Reservation) error {
+	if reservation.Account == "" {
+		return t.Release(ctx, reservation)
+	}
+
+	accountKey := AccountKey(reservation.Account)
+	delete(reservation.failures, accountKey)
+
+	if err := t.store.Reset(ctx, accountKey); err != nil {
+		return err
+	}
+
+	return t.Release(ctx, reservation)
+}
+
+// Release takes back the reserved attempt, for attempts that were not made or did not fail on credentials
+func (t *Throttler) Release(ctx context.Context, reservation *Reservation) error {
+	for key := range reservation.failures {
+		if err := t.store.Release(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// release takes back the reservation when the attempt is turned away, keys of the attempt would
+// otherwise count attempts that were never made
+func (t *Throttler) release(ctx context.Context, reservation *Reservation) {
+	if err := t.Release(ctx, reservation); err != nil {
+		logger.Logger.Error().Err(err).Msg("Failed to release throttle reservation")
+	}
+}
+
+func (t *Throttler) policies(attempt Attempt) map[string]Policy {
+	policies := make(map[string]Policy, 2)
+
+	if attempt.IP != "" {
+		key := IPKey(attempt.IP)
+		if attempt.Kind != "" {
+			key = attempt.Kind + "-" + key
+		}
+		policies[key] = t.ip
+	}
+
+	if attempt.Account != "" {
+		policies[AccountKey(attempt.Account)] = t.account
+	}
+
+	return policies
+}
+
+// delay returns for how long the key is locked after its failures-th failure in a row
+func (t *Throttler) delay(policy Policy, failures int) time.Duration {
+	if failures >= policy.LockoutAttempts {
+		return t.lockout
+	}
+
+	if failures <= policy.FreeAttempts {
+		return 0
+	}
+
+	exponent := failures - policy.FreeAttempts - 1
+	if exponent >= 30 {
+		return t.lockout
+	}
+
+	return min(time.Duration(math.Pow(2, float64(exponent)))*t.baseDelay, t.lockout)
+}
+
+func (t *Throttler) purgeLoop() {
+	for range time.Tick(t.window) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := t.store.Purge(ctx, t.window); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to purge throttle store")
+		}
+		cancel()
+	}
+}
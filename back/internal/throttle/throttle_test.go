@@ -0,0 +1,276 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const (
+	testIP      = "203.0.113.7"
+	testAccount = "Squid@Example.com"
+)
+
+var (
+	testIPKey      = IPKey(testIP)
+	testAccountKey = AccountKey(testAccount)
+)
+
+func newTestThrottler() (*Throttler, *MemoryStore) {
+	store := NewMemoryStore()
+
+	return New(
+		store,
+		Policy{FreeAttempts: 3, LockoutAttempts: 6},
+		Policy{FreeAttempts: 1, LockoutAttempts: 3},
+		time.Second,
+		time.Minute,
+		time.Hour,
+	), store
+}
+
+// fail records failures of the attempt as if each of them was made once the previous lock was over
+func fail(t *testing.T, throttler *Throttler, store *MemoryStore, attempt Attempt, failures int) {
+	t.Helper()
+
+	ctx := context.Background()
+	for range failures {
+		unlock(throttler, store, attempt)
+
+		reservation, retryAfter, err := throttler.Reserve(ctx, attempt)
+		if err != nil || retryAfter > 0 {
+			t.Fatalf("Reserve = %v, %v, want reservation", retryAfter, err)
+		}
+
+		throttler.Fail(reservation)
+	}
+}
+
+// unlock lifts locks of the attempt keys as if they were over
+func unlock(throttler *Throttler, store *MemoryStore, attempt Attempt) {
+	for key := range throttler.policies(attempt) {
+		if entry, ok := store.entries[key]; ok {
+			entry.lockedUntil = time.Time{}
+		}
+	}
+}
+
+func failures(store *MemoryStore, key string) int {
+	if entry, ok := store.entries[key]; ok {
+		return entry.failures
+	}
+
+	return 0
+}
+
+func TestDelay(t *testing.T) {
+	throttler, _ := newTestThrottler()
+
+	cases := []struct {
+		name     string
+		policy   Policy
+		failures int
+		delay    time.Duration
+	}{
+		{"no failures", Policy{FreeAttempts: 2, LockoutAttempts: 6}, 0, 0},
+		{"free attempt", Policy{FreeAttempts: 2, LockoutAttempts: 6}, 2, 0},
+		{"first delay", Policy{FreeAttempts: 2, LockoutAttempts: 6}, 3, time.Second},
+		{"doubled", Policy{FreeAttempts: 2, LockoutAttempts: 6}, 4, 2 * time.Second},
+		{"doubled twice", Policy{FreeAttempts: 2, LockoutAttempts: 6}, 5, 4 * time.Second},
+		{"lockout", Policy{FreeAttempts: 2, LockoutAttempts: 6}, 6, time.Minute},
+		{"after lockout", Policy{FreeAttempts: 2, LockoutAttempts: 6}, 9, time.Minute},
+		{"capped at lockout", Policy{FreeAttempts: 0, LockoutAttempts: 100}, 8, time.Minute},
+		{"huge exponent", Policy{FreeAttempts: 0, LockoutAttempts: 100}, 64, time.Minute},
+	}
+
+	for _, tc := range cases {
+		if got := throttler.delay(tc.policy, tc.failures); got != tc.delay {
+			t.Errorf("%s: delay(%+v, %d) = %v, want %v", tc.name, tc.policy, tc.failures, got, tc.delay)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name string
+		// accountFailures and ipFailures happened before the attempt
+		accountFailures, ipFailures int
+		locked                      bool
+		// accountAfter and ipAfter are counts once the attempt is reserved or turned away
+		accountAfter, ipAfter int
+	}{
+		{"free", 0, 0, false, 1, 1},
+		{"account locked", 3, 0, true, 3, 0},
+		{"ip locked", 0, 6, true, 0, 6},
+	}
+
+	for _, tc := range cases {
+		throttler, store := newTestThrottler()
+
+		fail(t, throttler, store, Attempt{Account: testAccount}, tc.accountFailures)
+		fail(t, throttler, store, Attempt{IP: testIP}, tc.ipFailures)
+
+		reservation, retryAfter, err := throttler.Reserve(ctx, Attempt{IP: testIP, Account: testAccount})
+		if err != nil {
+			t.Fatalf("%s: Reserve: %v", tc.name, err)
+		}
+
+		if tc.locked && (retryAfter <= 0 || reservation != nil) {
+			t.Errorf("%s: Reserve = %v, %v, want to be turned away", tc.name, reservation, retryAfter)
+		} else if !tc.locked && (retryAfter != 0 || reservation == nil) {
+			t.Errorf("%s: Reserve = %v, %v, want reservation", tc.name, reservation, retryAfter)
+		}
+
+		if got := failures(store, testAccountKey); got != tc.accountAfter {
+			t.Errorf("%s: account failures = %d, want %d", tc.name, got, tc.accountAfter)
+		}
+
+		if got := failures(store, testIPKey); got != tc.ipAfter {
+			t.Errorf("%s: ip failures = %d, want %d", tc.name, got, tc.ipAfter)
+		}
+	}
+}
+
+func TestReserveLocksConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	throttler, store := newTestThrottler()
+
+	// the second failure of the account is delayed, so the attempt reserving it holds off the next one
+	fail(t, throttler, store, Attempt{Account: testAccount}, 1)
+
+	attempt := Attempt{IP: testIP, Account: testAccount}
+	if _, retryAfter, err := throttler.Reserve(ctx, attempt); err != nil || retryAfter > 0 {
+		t.Fatalf("first Reserve = %v, %v, want reservation", retryAfter, err)
+	}
+
+	if _, retryAfter, err := throttler.Reserve(ctx, attempt); err != nil || retryAfter <= 0 {
+		t.Fatalf("concurrent Reserve = %v, %v, want to be turned away", retryAfter, err)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name                  string
+		settle                func(*Throttler, *Reservation) error
+		accountAfter, ipAfter int
+		locked                bool
+	}{
+		{
+			name:         "succeed resets the account only",
+			settle:       func(t *Throttler, r *Reservation) error { return t.Succeed(ctx, r) },
+			accountAfter: 0,
+			ipAfter:      2,
+		},
+		{
+			name:         "release takes the attempt back",
+			settle:       func(t *Throttler, r *Reservation) error { return t.Release(ctx, r) },
+			accountAfter: 1,
+			ipAfter:      2,
+		},
+		{
+			name:         "fail keeps the attempt",
+			settle:       func(t *Throttler, r *Reservation) error { t.Fail(r); return nil },
+			accountAfter: 2,
+			ipAfter:      3,
+			locked:       true,
+		},
+	}
+
+	for _, tc := range cases {
+		throttler, store := newTestThrottler()
+
+		fail(t, throttler, store, Attempt{Account: testAccount}, 1)
+		fail(t, throttler, store, Attempt{IP: testIP}, 2)
+
+		attempt := Attempt{IP: testIP, Account: testAccount}
+		reservation, _, err := throttler.Reserve(ctx, attempt)
+		if err != nil || reservation == nil {
+			t.Fatalf("%s: Reserve = %v, %v, want reservation", tc.name, reservation, err)
+		}
+
+		if err = tc.settle(throttler, reservation); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if got := failures(store, testAccountKey); got != tc.accountAfter {
+			t.Errorf("%s: account failures = %d, want %d", tc.name, got, tc.accountAfter)
+		}
+
+		if got := failures(store, testIPKey); got != tc.ipAfter {
+			t.Errorf("%s: ip failures = %d, want %d", tc.name, got, tc.ipAfter)
+		}
+
+		_, retryAfter, err := throttler.Reserve(ctx, attempt)
+		if err != nil {
+			t.Fatalf("%s: next Reserve: %v", tc.name, err)
+		}
+
+		if locked := retryAfter > 0; locked != tc.locked {
+			t.Errorf("%s: next attempt locked = %v, want %v", tc.name, locked, tc.locked)
+		}
+	}
+}
+
+func TestFailReportsLockout(t *testing.T) {
+	ctx := context.Background()
+	throttler, store := newTestThrottler()
+
+	fail(t, throttler, store, Attempt{IP: testIP, Account: testAccount}, 2)
+	unlock(throttler, store, Attempt{IP: testIP, Account: testAccount})
+
+	reservation, _, err := throttler.Reserve(ctx, Attempt{IP: testIP, Account: testAccount})
+	if err != nil || reservation == nil {
+		t.Fatalf("Reserve = %v, %v, want reservation", reservation, err)
+	}
+
+	outcome := throttler.Fail(reservation)
+	if len(outcome.LockedOut) != 1 || outcome.LockedOut[0] != testAccountKey {
+		t.Errorf("LockedOut = %v, want [%s]", outcome.LockedOut, testAccountKey)
+	}
+
+	if outcome.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter = %v, want %v", outcome.RetryAfter, time.Minute)
+	}
+}
+
+func TestKindsAreCountedApart(t *testing.T) {
+	ctx := context.Background()
+	throttler, store := newTestThrottler()
+
+	fail(t, throttler, store, Attempt{Kind: KindRefresh, IP: testIP}, 6)
+
+	if got := failures(store, testIPKey); got != 0 {
+		t.Errorf("login ip failures = %d, want 0", got)
+	}
+
+	if _, retryAfter, err := throttler.Reserve(ctx, Attempt{IP: testIP, Account: testAccount}); err != nil || retryAfter > 0 {
+		t.Errorf("login Reserve = %v, %v, want reservation", retryAfter, err)
+	}
+}
+
+func TestMemoryStoreForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	noDelay := func(int) time.Duration { return 0 }
+
+	for range 3 {
+		if _, _, err := store.Reserve(ctx, testIPKey, time.Millisecond, noDelay); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	count, _, err := store.Reserve(ctx, testIPKey, time.Millisecond, noDelay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Errorf("failures after window = %d, want 1", count)
+	}
+}
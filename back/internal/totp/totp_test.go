@@ -0,0 +1,77 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA1 seed of the test vectors in RFC 6238 Appendix B
+const rfc6238Key = "12345678901234567890"
+
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		step := Step(time.Unix(vector.unix, 0))
+
+		if got := code([]byte(rfc6238Key), step, 8); got != vector.code {
+			t.Errorf("code at %d = %s, want %s", vector.unix, got, vector.code)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	secret := encoding.EncodeToString([]byte(rfc6238Key))
+
+	for _, vector := range rfc6238Vectors {
+		got, err := Code(secret, Step(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// shorter codes are the last digits of the longer ones
+		if want := vector.code[len(vector.code)-Digits:]; got != want {
+			t.Errorf("Code at %d = %s, want %s", vector.unix, got, want)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := encoding.EncodeToString([]byte(rfc6238Key))
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for offset := int64(-Skew - 1); offset <= Skew+1; offset++ {
+		code, err := Code(secret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		step, ok := Validate(secret, code, now)
+		if want := offset >= -Skew && offset <= Skew; ok != want {
+			t.Errorf("Validate of code %d steps away = %v, want %v", offset, ok, want)
+		} else if ok && step != current+offset {
+			t.Errorf("Validate of code %d steps away matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+
+	for _, code := range []string{"", "05081", "0508180", "abcdef"} {
+		if _, ok := Validate(secret, code, now); ok {
+			t.Errorf("Validate accepted %q", code)
+		}
+	}
+}
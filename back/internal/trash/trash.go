@@ -0,0 +1,47 @@
+// Package trash deletes projects, columns and rows for good once they spent the retention period in trash
+package trash
+
+import (
+	"context"
+	"time"
+
+	"github.com/finkabaj/squid/back/internal/config"
+	"github.com/finkabaj/squid/back/internal/logger"
+	"github.com/finkabaj/squid/back/internal/repository"
+	"github.com/pkg/errors"
+)
+
+// purgeInterval is how often trash is checked for expired projects, columns and rows
+const purgeInterval = time.Hour
+
+// InitTrash purges expired trash and keeps purging it every purgeInterval
+func InitTrash() error {
+	if config.Data.TrashRetentionDays < 1 {
+		return errors.New("trash retention days must be at least 1")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := purge(ctx); err != nil {
+		return err
+	}
+
+	go purgeLoop()
+
+	return nil
+}
+
+func purge(ctx context.Context) error {
+	return errors.Wrap(repository.PurgeTrash(ctx, config.Data.TrashRetentionDays), "error purging trash")
+}
+
+func purgeLoop() {
+	for range time.Tick(purgeInterval) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := purge(ctx); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to purge trash")
+		}
+		cancel()
+	}
+}
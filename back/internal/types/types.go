@@ -4,22 +4,75 @@ import (
 	"time"
 )
 
+// DeletedUserID is the placeholder user that inherits authored content of deleted accounts
+const DeletedUserID = "deleted-user"
+
 type User struct {
-	ID           string    `json:"id"`
-	Username     string    `json:"username"`
-	FirstName    string    `json:"first_name"`
-	LastName     string    `json:"last_name"`
-	DateOfBirth  time.Time `json:"date_of_birth"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	// DateOfBirth is nil for users provisioned through single sign-on
+	DateOfBirth      *time.Time `json:"date_of_birth"`
+	Email            string     `json:"email"`
+	PasswordHash     string     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	EmailVerified    bool       `json:"email_verified"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	// AvatarKey is storage key of the largest avatar rendition, other sizes are its siblings
+	AvatarKey *string `json:"-"`
+	// AvatarURL points to the largest avatar rendition, replace its file name size for smaller ones
+	AvatarURL *string `json:"avatar_url"`
+	// IsAdmin grants access to system administration, it is granted with the cli only
+	IsAdmin bool `json:"is_admin"`
+	// DisabledAt is set while an administrator keeps the user from signing in
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+type UserSearch struct {
+	Query  string `validate:"required,max=100"`
+	Limit  int    `validate:"min=1,max=50"`
+	Offset int    `validate:"min=0"`
+}
+
+// AdminUserSearch lists all users, matching Query when it is not empty
+type AdminUserSearch struct {
+	Query  string `validate:"max=100"`
+	Limit  int    `validate:"min=1,max=100"`
+	Offset int    `validate:"min=0"`
+}
+
+type UserPage struct {
+	Users  []User `json:"users"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+type PageQuery struct {
+	Limit  int `validate:"min=1,max=100"`
+	Offset int `validate:"min=0"`
+}
+
+type ProjectPage struct {
+	Projects []Project `json:"projects"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
 }
 
 type ProjectUsers struct {
-	Admins  []User `json:"admins"`
-	Members []User `json:"members"`
-	Creator User   `json:"creator"`
+	Creator User `json:"creator"`
+	// Users are everyone in the project except creator, who is its owner
+	Users []ProjectUserDetails `json:"users"`
+	// Permissions lists what each role is allowed to do in the project
+	Permissions map[ProjectRole][]ProjectPermission `json:"permissions"`
+}
+
+type ProjectUserDetails struct {
+	User
+	Role ProjectRole `json:"role"`
 }
 
 type TokenPair struct {
@@ -32,6 +85,59 @@ type TokenPair struct {
 type AuthUser struct {
 	User      User      `json:"user"`
 	TokenPair TokenPair `json:"token_pair"`
+	// Challenge is set instead of TokenPair when login has to be completed with second factor
+	Challenge *LoginChallenge `json:"challenge,omitempty"`
+	// JoinedProjects are projects the user joined by invitations accepted along the way
+	JoinedProjects []Project `json:"-"`
+}
+
+type LoginChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	Challenge         string    `json:"challenge"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type LoginTwoFactor struct {
+	Challenge string `json:"challenge" validate:"required,min=10,max=100"`
+	// Code is either TOTP code or one of recovery codes
+	Code string `json:"code" validate:"required,min=6,max=20"`
+}
+
+type TwoFactorChallenge struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	TokenHash string    `json:"-"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type UserTOTP struct {
+	UserID       string     `json:"user_id"`
+	Secret       string     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	LastUsedStep *int64     `json:"-"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TwoFactorCode struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// PasswordConfirmation confirms sensitive changes with the password. Users signed up with SSO have no password,
+// they send two-factor or recovery code instead, or nothing when they signed in with SSO recently
+type PasswordConfirmation struct {
+	Password string `json:"password,omitempty" validate:"omitempty,min=8,max=128"`
+	Code     string `json:"code,omitempty" validate:"omitempty,min=6,max=20"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
 }
 
 type RegisterUser struct {
@@ -40,7 +146,7 @@ type RegisterUser struct {
 	LastName    string    `json:"last_name" validate:"required,min=3,max=100"`
 	DateOfBirth time.Time `json:"date_of_birth" validate:"required,date_of_birth"`
 	Email       string    `json:"email" validate:"required,email"`
-	Password    string    `json:"password" validate:"required,min=8,max=50"`
+	Password    string    `json:"password" validate:"required,min=8,max=128"`
 }
 
 type UpdateUser struct {
@@ -51,61 +157,491 @@ type UpdateUser struct {
 }
 
 type UpdatePassword struct {
-	OldPassword string `json:"old_password" validate:"required,min=8,max=50"`
-	Password    string `json:"password" validate:"required,min=8,max=50"`
+	OldPassword string `json:"old_password" validate:"required,min=8,max=128"`
+	Password    string `json:"password" validate:"required,min=8,max=128"`
+}
+
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPassword struct {
+	Token    string `json:"token" validate:"required,min=10,max=100"`
+	Password string `json:"password" validate:"required,min=8,max=128"`
+}
+
+type PasswordResetToken struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	TokenHash string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+type VerifyEmail struct {
+	Token string `json:"token" validate:"required,min=10,max=100"`
+}
+
+type ResendVerification struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ChangeEmail struct {
+	NewEmail string `json:"new_email" validate:"required,email,max=255"`
+	PasswordConfirmation
+}
+
+type ConfirmEmailChange struct {
+	Token string `json:"token" validate:"required,min=10,max=100"`
+}
+
+// EmailChangeToken confirms that the user controls NewEmail. SessionID is the session that requested
+// the change, it survives the change while every other session is revoked
+type EmailChangeToken struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	OldEmail  string     `json:"old_email"`
+	NewEmail  string     `json:"new_email"`
+	SessionID string     `json:"session_id"`
+	TokenHash string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// EmailChanged is the user after email change along with sessions revoked and projects joined by it
+type EmailChanged struct {
+	User              User      `json:"user"`
+	OldEmail          string    `json:"-"`
+	RevokedSessionIDs []string  `json:"-"`
+	JoinedProjects    []Project `json:"-"`
+}
+
+type EmailVerificationToken struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Email     string     `json:"email"`
+	TokenHash string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+type OIDCState struct {
+	StateHash    string    `json:"-"`
+	Nonce        string    `json:"-"`
+	CodeVerifier string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type OIDCCallback struct {
+	Code             string `validate:"required_without=Error,max=2048"`
+	State            string `validate:"required,max=100"`
+	Error            string `validate:"max=256"`
+	ErrorDescription string `validate:"max=1024"`
+}
+
+type UserIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AccessTokenScope string
+
+const (
+	AccessTokenScopeRead      AccessTokenScope = "read"
+	AccessTokenScopeReadWrite AccessTokenScope = "read_write"
+)
+
+type PersonalAccessToken struct {
+	ID         string           `json:"id"`
+	UserID     string           `json:"user_id"`
+	Name       string           `json:"name"`
+	TokenHash  string           `json:"-"`
+	Scope      AccessTokenScope `json:"scope"`
+	CreatedAt  time.Time        `json:"created_at"`
+	ExpiresAt  time.Time        `json:"expires_at"`
+	LastUsedAt *time.Time       `json:"last_used_at"`
+}
+
+type CreatePersonalAccessToken struct {
+	Name          string           `json:"name" validate:"required,min=1,max=100"`
+	Scope         AccessTokenScope `json:"scope" validate:"required,oneof=read read_write"`
+	ExpiresInDays int              `json:"expires_in_days" validate:"required,min=1,max=365"`
+}
+
+// CreatedPersonalAccessToken is the only place plain token is returned
+type CreatedPersonalAccessToken struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
+
+type ProjectTransfer struct {
+	ProjectID  string `json:"project_id" validate:"required,uuid"`
+	NewOwnerID string `json:"new_owner_id" validate:"required,uuid"`
+}
+
+type DeleteAccount struct {
+	PasswordConfirmation
+	// DeleteOwnedProjects deletes owned projects that are not listed in Transfers instead of
+	// handing them over to one of their admins or members
+	DeleteOwnedProjects bool              `json:"delete_owned_projects"`
+	Transfers           []ProjectTransfer `json:"transfers" validate:"omitempty,max=100,dive"`
+}
+
+// AdminDeleteAccount is DeleteAccount of another user, which administrators do without password confirmation
+type AdminDeleteAccount struct {
+	DeleteOwnedProjects bool              `json:"delete_owned_projects"`
+	Transfers           []ProjectTransfer `json:"transfers" validate:"omitempty,max=100,dive"`
+}
+
+type DeletedAccount struct {
+	UserID          string    `json:"user_id"`
+	DeletedProjects []Project `json:"deleted_projects"`
+	// UpdatedProjects are projects the user was part of, including transferred ones
+	UpdatedProjects []Project `json:"updated_projects"`
 }
 
 type Login struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=100"`
+	Password string `json:"password" validate:"required,min=8,max=128"`
 }
 
 type RefreshToken struct {
-	ID        string    `json:"id"`
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	SessionID  string    `json:"session_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	// ParentID is the token this one was rotated from. SessionID is shared by the whole rotation family
+	ParentID  *string    `json:"parent_id"`
+	RotatedAt *time.Time `json:"rotated_at"`
+}
+
+// SigningKey is a key JWTs are signed with. Retired keys only verify tokens until ExpiresAt
+type SigningKey struct {
+	ID         string     `json:"id"`
+	Algorithm  string     `json:"algorithm"`
+	PrivateKey []byte     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `json:"retired_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// RevokedAccessToken is an access token rejected before it expires, identified by its jti claim
+type RevokedAccessToken struct {
+	JTI       string    `json:"jti"`
 	UserID    string    `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
+	SessionID string    `json:"session_id"`
+	RevokedAt time.Time `json:"revoked_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
+// ClientInfo describes the device a request came from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+type AuthEventType string
+
+const (
+	AuthEventLoginSucceeded      AuthEventType = "login_succeeded"
+	AuthEventLoginFailed         AuthEventType = "login_failed"
+	AuthEventLockout             AuthEventType = "auth_lockout"
+	AuthEventTokenRefreshed      AuthEventType = "token_refreshed"
+	AuthEventRefreshTokenReuse   AuthEventType = "refresh_token_reuse"
+	AuthEventLogout              AuthEventType = "logout"
+	AuthEventPasswordChanged     AuthEventType = "password_changed"
+	AuthEventPasswordReset       AuthEventType = "password_reset"
+	AuthEventSessionRevoked      AuthEventType = "session_revoked"
+	AuthEventAccessTokenRevoked  AuthEventType = "access_token_revoked"
+	AuthEventSSOAccountLinked    AuthEventType = "sso_account_linked"
+	AuthEventAccountDeleted      AuthEventType = "account_deleted"
+	AuthEventAccountDisabled     AuthEventType = "account_disabled"
+	AuthEventAccountEnabled      AuthEventType = "account_enabled"
+	AuthEventPasswordResetForced AuthEventType = "password_reset_forced"
+	AuthEventEmailChanged        AuthEventType = "email_changed"
+	AuthEventTwoFactorEnabled    AuthEventType = "two_factor_enabled"
+	AuthEventTwoFactorDisabled   AuthEventType = "two_factor_disabled"
+)
+
+// AuthEvent is a persisted record of account activity. UserID is nil when the account is unknown,
+// e.g. failed login with unregistered email
+type AuthEvent struct {
+	ID        string         `json:"id"`
+	UserID    *string        `json:"user_id"`
+	Type      AuthEventType  `json:"type"`
+	IP        string         `json:"ip"`
+	UserAgent string         `json:"user_agent"`
+	Details   map[string]any `json:"details"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// AuthEventQuery filters auth events, From and To are RFC 3339 timestamps bounding createdAt
+type AuthEventQuery struct {
+	UserID string        `validate:"omitempty,max=255"`
+	Type   AuthEventType `validate:"omitempty,oneof=login_succeeded login_failed auth_lockout token_refreshed refresh_token_reuse logout password_changed password_reset session_revoked access_token_revoked sso_account_linked account_deleted account_disabled account_enabled password_reset_forced email_changed two_factor_enabled two_factor_disabled"`
+	From   string        `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To     string        `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Limit  int           `validate:"min=1,max=100"`
+	Offset int           `validate:"min=0"`
+}
+
+type AuthEventPage struct {
+	Events []AuthEvent `json:"events"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
 type Project struct {
-	ID          string    `json:"id"`
-	CreatorID   string    `json:"creator_id"`
-	AdminIDs    []string  `json:"admin_ids"`
-	MembersIDs  []string  `json:"members_ids"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID        string `json:"id"`
+	CreatorID string `json:"creator_id"`
+	// Users are everyone in the project except creator, who is its owner
+	Users       []ProjectUser `json:"users"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	// ArchivedAt is set while the project is archived, archived projects are read-only
+	ArchivedAt *time.Time `json:"archived_at"`
+	// DeletedAt is set while the project is in trash, it is deleted for good once retention period passes
+	DeletedAt *time.Time `json:"deleted_at"`
+	// IsTemplate is set for templates, they are edited like projects but only listed with templates
+	IsTemplate bool `json:"is_template"`
 
 	Columns *[]KanbanColumn `json:"columns,omitempty"`
 }
 
-type ProjectAdmin struct {
-	ProjectID string `json:"project_id"`
-	UserID    string `json:"user_id"`
+// ProjectsQuery lists projects of the user, archived ones are only listed with Archived
+type ProjectsQuery struct {
+	Archived bool
 }
 
-type ProjectMember struct {
-	ProjectID string `json:"project_id"`
-	UserID    string `json:"user_id"`
+// CloneProject copies columns and labels of a project or template into a new one, the rest is only copied
+// when asked for. Description of the source is kept when none is given
+type CloneProject struct {
+	Name              string  `json:"name" validate:"required,min=3,max=50"`
+	Description       *string `json:"description,omitempty" validate:"omitempty,max=500"`
+	IncludeRows       bool    `json:"include_rows"`
+	IncludeChecklists bool    `json:"include_checklists" validate:"excluded_without=IncludeRows"`
+	// IncludeMembers invites users of the project with their roles, owner of the source is invited as admin
+	IncludeMembers bool `json:"include_members"`
+	// IncludeAssignments keeps assignments of users that are part of the new project, which is only its creator
+	// until the invited members join
+	IncludeAssignments bool `json:"include_assignments" validate:"excluded_without=IncludeRows"`
+}
+
+// ProjectClone is a copy of the source project to create with id, the rest of CloneProject decides what is copied.
+// Invitations are filled with invitations of the members of the source
+type ProjectClone struct {
+	CloneProject
+	SourceID   string
+	ID         string
+	CreatorID  string
+	IsTemplate bool
+	// InvitationsExpireAt is when invitations of the members of the source expire
+	InvitationsExpireAt time.Time
+	Invitations         []ProjectInvitation
+}
+
+// ProjectTrash is what was moved to trash in a project and can still be restored
+type ProjectTrash struct {
+	Columns []KanbanColumn `json:"columns"`
+	Rows    []KanbanRow    `json:"rows"`
+}
+
+type ProjectUser struct {
+	ProjectID string      `json:"project_id"`
+	UserID    string      `json:"user_id"`
+	Role      ProjectRole `json:"role"`
 }
 
+type UpdateProjectRole struct {
+	UserID string      `json:"user_id" validate:"required,uuid"`
+	Role   ProjectRole `json:"role" validate:"required,oneof=viewer commenter member admin"`
+}
+
+// CreateProject invites people with admin and member emails, they join once they accept
 type CreateProject struct {
-	AdminEmails  []string `json:"admin_emails,omitempty" validate:"omitempty,dive,email"`
-	MemberEmails []string `json:"member_emails,omitempty" validate:"omitempty,dive,email"`
-	AdminIDs     []string `json:"-"`
-	MemberIDs    []string `json:"-"`
-	Name         string   `json:"name" validate:"required,min=3,max=50"`
-	Description  string   `json:"description" validate:"max=500"`
+	AdminEmails  []string            `json:"admin_emails,omitempty" validate:"omitempty,dive,email"`
+	MemberEmails []string            `json:"member_emails,omitempty" validate:"omitempty,dive,email"`
+	Invitations  []ProjectInvitation `json:"-"`
+	Name         string              `json:"name" validate:"required,min=3,max=50"`
+	Description  string              `json:"description" validate:"max=500"`
 }
 
+// UpdateProject replaces admins and members with the listed users that are already part of the project,
+// the rest of the emails are invited
 type UpdateProject struct {
-	AdminEmails  *[]string `json:"admin_emails,omitempty" validate:"omitempty,dive,email"`
-	MemberEmails *[]string `json:"member_emails,omitempty" validate:"omitempty,dive,email"`
-	AdminIDs     []string  `json:"-"`
-	MembersIDs   []string  `json:"-"`
-	Name         *string   `json:"name,omitempty" validate:"omitempty,min=3,max=50"`
-	Description  *string   `json:"description,omitempty" validate:"omitempty,max=500"`
+	AdminEmails  *[]string           `json:"admin_emails,omitempty" validate:"omitempty,dive,email"`
+	MemberEmails *[]string           `json:"member_emails,omitempty" validate:"omitempty,dive,email"`
+	AdminIDs     []string            `json:"-"`
+	MembersIDs   []string            `json:"-"`
+	Invitations  []ProjectInvitation `json:"-"`
+	Name         *string             `json:"name,omitempty" validate:"omitempty,min=3,max=50"`
+	Description  *string             `json:"description,omitempty" validate:"omitempty,max=500"`
+}
+
+type ProjectRole string
+
+const (
+	// ProjectRoleOwner is the role of project creator, it is not stored among project users
+	ProjectRoleOwner     ProjectRole = "owner"
+	ProjectRoleAdmin     ProjectRole = "admin"
+	ProjectRoleMember    ProjectRole = "member"
+	ProjectRoleCommenter ProjectRole = "commenter"
+	ProjectRoleViewer    ProjectRole = "viewer"
+)
+
+type ProjectPermission string
+
+const (
+	ProjectPermissionView    ProjectPermission = "view"
+	ProjectPermissionComment ProjectPermission = "comment"
+	// ProjectPermissionEditRows covers rows, their checklists and assignees
+	ProjectPermissionEditRows ProjectPermission = "edit_rows"
+	// ProjectPermissionManageBoard covers project details, columns, labels and comment sections
+	ProjectPermissionManageBoard   ProjectPermission = "manage_board"
+	ProjectPermissionManageMembers ProjectPermission = "manage_members"
+	ProjectPermissionDeleteProject ProjectPermission = "delete_project"
+	// ProjectPermissionTransferProject allows to hand the project over to another user
+	ProjectPermissionTransferProject ProjectPermission = "transfer_project"
+	ProjectPermissionArchiveProject  ProjectPermission = "archive_project"
+)
+
+// ProjectRolePermissions is what each role is allowed to do in a project
+var ProjectRolePermissions = map[ProjectRole][]ProjectPermission{
+	ProjectRoleViewer:    {ProjectPermissionView},
+	ProjectRoleCommenter: {ProjectPermissionView, ProjectPermissionComment},
+	ProjectRoleMember:    {ProjectPermissionView, ProjectPermissionComment, ProjectPermissionEditRows},
+	ProjectRoleAdmin: {ProjectPermissionView, ProjectPermissionComment, ProjectPermissionEditRows,
+		ProjectPermissionManageBoard, ProjectPermissionManageMembers, ProjectPermissionArchiveProject},
+	ProjectRoleOwner: {ProjectPermissionView, ProjectPermissionComment, ProjectPermissionEditRows,
+		ProjectPermissionManageBoard, ProjectPermissionManageMembers, ProjectPermissionArchiveProject,
+		ProjectPermissionDeleteProject, ProjectPermissionTransferProject},
+}
+
+// ArchivedProjectPermissions is what can still be done in archived projects, the rest of the project is read-only
+var ArchivedProjectPermissions = []ProjectPermission{ProjectPermissionView, ProjectPermissionManageMembers,
+	ProjectPermissionArchiveProject, ProjectPermissionDeleteProject, ProjectPermissionTransferProject}
+
+// ProjectResource is kind of the resource that belongs to a project, the value is used in error messages
+type ProjectResource string
+
+const (
+	ProjectResourceProject        ProjectResource = "project"
+	ProjectResourceColumn         ProjectResource = "column"
+	ProjectResourceColumnLabel    ProjectResource = "column label"
+	ProjectResourceRow            ProjectResource = "row"
+	ProjectResourceRowLabel       ProjectResource = "row label"
+	ProjectResourceChecklist      ProjectResource = "checklist"
+	ProjectResourcePoint          ProjectResource = "point"
+	ProjectResourceCommentSection ProjectResource = "comment section"
+	ProjectResourceComment        ProjectResource = "comment"
+	ProjectResourceInvitation     ProjectResource = "invitation"
+)
+
+// ProjectAccess is the project a resource belongs to and role of the user in it
+type ProjectAccess struct {
+	ProjectID string `json:"project_id"`
+	CreatorID string `json:"creator_id"`
+	// Role is empty when the user is not part of the project
+	Role ProjectRole `json:"role"`
+	// Archived is set when the project is archived
+	Archived bool `json:"archived"`
+	// Trashed is set when the resource, or anything it belongs to, is in trash
+	Trashed bool `json:"trashed"`
+}
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationDeclined InvitationStatus = "declined"
+)
+
+type ProjectInvitation struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	Email     string `json:"email"`
+	// InviteeID is nil while nobody is registered with the email
+	InviteeID   *string          `json:"invitee_id"`
+	InviterID   string           `json:"inviter_id"`
+	Role        ProjectRole      `json:"role"`
+	Status      InvitationStatus `json:"status"`
+	CreatedAt   time.Time        `json:"created_at"`
+	ExpiresAt   time.Time        `json:"expires_at"`
+	RespondedAt *time.Time       `json:"responded_at"`
+}
+
+// ReceivedProjectInvitation is invitation listed to the invitee, along with what they are invited to
+type ReceivedProjectInvitation struct {
+	ProjectInvitation
+	ProjectName     string `json:"project_name"`
+	InviterUsername string `json:"inviter_username"`
+}
+
+type CreateProjectInvitation struct {
+	ProjectID string      `json:"project_id" validate:"required,uuid"`
+	Email     string      `json:"email" validate:"required,email,max=255"`
+	Role      ProjectRole `json:"role" validate:"required,oneof=viewer commenter member admin"`
+}
+
+// OwnershipTransfer hands the project over to another user of the project once they accept it, previous owner
+// stays in the project as admin
+type OwnershipTransfer struct {
+	ID          string           `json:"id"`
+	ProjectID   string           `json:"project_id"`
+	FromUserID  string           `json:"from_user_id"`
+	ToUserID    string           `json:"to_user_id"`
+	Status      InvitationStatus `json:"status"`
+	CreatedAt   time.Time        `json:"created_at"`
+	ExpiresAt   time.Time        `json:"expires_at"`
+	RespondedAt *time.Time       `json:"responded_at"`
+}
+
+// ReceivedOwnershipTransfer is transfer listed to the new owner, along with what is transferred to them
+type ReceivedOwnershipTransfer struct {
+	OwnershipTransfer
+	ProjectName  string `json:"project_name"`
+	FromUsername string `json:"from_username"`
+}
+
+type CreateOwnershipTransfer struct {
+	UserID string `json:"user_id" validate:"required,uuid"`
+}
+
+// ReassignProjectOwner names the new owner an admin hands the project over to
+type ReassignProjectOwner struct {
+	UserID string `json:"user_id" validate:"required,uuid"`
+}
+
+// LeftProject is the project the user left, along with rows they were unassigned from
+type LeftProject struct {
+	Project     Project     `json:"project"`
+	UpdatedRows []KanbanRow `json:"updated_rows"`
 }
 
 type KanbanColumn struct {
@@ -113,6 +649,8 @@ type KanbanColumn struct {
 	ProjectID string `json:"project_id"`
 	Name      string `json:"name"`
 	Order     int    `json:"order"`
+	// DeletedAt is set while the column is in trash, its rows are hidden along with it
+	DeletedAt *time.Time `json:"deleted_at"`
 
 	Label *KanbanColumnLabel `json:"label,omitempty"`
 	Rows  *[]KanbanRow       `json:"rows,omitempty"`
@@ -183,6 +721,8 @@ type KanbanRow struct {
 	CreatedAt        time.Time  `json:"created_at"`
 	UpdatedAt        time.Time  `json:"updated_at"`
 	DueDate          *time.Time `json:"due_date"`
+	// DeletedAt is set while the row is in trash
+	DeletedAt *time.Time `json:"deleted_at"`
 
 	Label          *KanbanRowLabel `json:"label,omitempty"`
 	History        *[]HistoryPoint `json:"history,omitempty"`
@@ -221,6 +761,12 @@ type UpdateKanbanRow struct {
 	DeleteLabel *bool   `json:"delete_label,omitempty" validate:"omitempty,oneof=true false"`
 }
 
+type MoveKanbanRow struct {
+	ProjectID string `json:"project_id" validate:"required,uuid"`
+	ColumnID  string `json:"column_id" validate:"required,uuid"`
+	Order     int    `json:"order" validate:"required,min=0,max=20"`
+}
+
 type KanbanRowLabel struct {
 	ProjectID string `json:"project_id"`
 	ID        string `json:"id"`
@@ -2,7 +2,10 @@ package utils
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/finkabaj/squid/back/internal/logger"
 	"github.com/pkg/errors"
@@ -22,6 +25,10 @@ var (
 		Status:  http.StatusUnauthorized,
 		Message: "unauthorized",
 	}
+	ErrorTypeTooManyRequests = ErrorType{
+		Status:  http.StatusTooManyRequests,
+		Message: "too many requests",
+	}
 	ErrorTypeNotFound = ErrorType{
 		Status:  http.StatusNotFound,
 		Message: "not found",
@@ -40,6 +47,7 @@ type AppError struct {
 	Type          ErrorType
 	OriginalError error
 	Fields        map[string]string // For validation errors
+	RetryAfter    time.Duration     // Sent as Retry-After header when set
 }
 
 func (e AppError) Error() string {
@@ -84,6 +92,14 @@ func NewNotFoundError(err error) error {
 	}
 }
 
+func NewTooManyRequestsError(err error, retryAfter time.Duration) error {
+	return AppError{
+		Type:          ErrorTypeTooManyRequests,
+		OriginalError: errors.WithStack(err),
+		RetryAfter:    retryAfter,
+	}
+}
+
 type ErrorResponse struct {
 	Error   string            `json:"error"`
 	Message string            `json:"message,omitempty"`
@@ -107,6 +123,9 @@ func HandleError(w http.ResponseWriter, err error) {
 			Status:  e.Type.Status,
 			Fields:  e.Fields,
 		}
+		if e.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		}
 		if e.Type == ErrorTypeInternal {
 			if stackTracer, ok := e.OriginalError.(interface{ StackTrace() errors.StackTrace }); ok {
 				logger.Logger.Debug().
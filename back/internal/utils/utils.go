@@ -1,19 +1,25 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"reflect"
 	"time"
 
 	"github.com/finkabaj/squid/back/internal/config"
-
-	"golang.org/x/crypto/bcrypt"
+	"github.com/finkabaj/squid/back/internal/passhash"
+	"github.com/finkabaj/squid/back/internal/signing"
 
 	"github.com/finkabaj/squid/back/internal/types"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -68,26 +74,48 @@ func ValidateSliceOrStruct(w http.ResponseWriter, validate *validator.Validate,
 	return
 }
 
+// HashPassword Hashes password with the preferred algorithm. Returns passhash.ErrTooLong if the algorithm cannot hash all of it
 func HashPassword(password *string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(*password), config.Data.SaltRounds)
-	return string(bytes), err
+	return passhash.Default.Hash(*password)
 }
 
 func CheckPasswordHash(password, hash *string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(*hash), []byte(*password))
-	return err == nil
+	return passhash.Default.Verify(*password, *hash)
+}
+
+// PasswordNeedsRehash Reports whether the hash was produced by other than the preferred algorithm or parameters
+func PasswordNeedsRehash(hash *string) bool {
+	return passhash.Default.NeedsRehash(*hash)
+}
+
+// GenerateToken Creates random url safe token and its hash. Only the hash should be persisted
+func GenerateToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	return token, HashToken(token), nil
+}
+
+// PersonalAccessTokenPrefix Makes personal access tokens recognizable, e.g. by secret scanners
+const PersonalAccessTokenPrefix = "squid_pat_"
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func CreateJWTRefresh(refreshToken *types.RefreshToken) (string, time.Time, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	tokenStr, err := signing.Default.Sign(jwt.MapClaims{
 		"id":         refreshToken.ID,
 		"user_id":    refreshToken.UserID,
 		"created_at": refreshToken.CreatedAt.Unix(),
 		"expires_at": refreshToken.ExpiresAt.Unix(),
 	})
 
-	tokenStr, err := token.SignedString(config.Data.JWTSecret)
-
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -95,17 +123,17 @@ func CreateJWTRefresh(refreshToken *types.RefreshToken) (string, time.Time, erro
 	return tokenStr, refreshToken.ExpiresAt, nil
 }
 
-func CreateJWT(user *types.User) (string, time.Time, error) {
+func CreateJWT(user *types.User, sessionID string) (string, time.Time, error) {
 	expAt := time.Now().Add(time.Minute * time.Duration(config.Data.AccessTokenExpMinutes))
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	tokenStr, err := signing.Default.Sign(jwt.MapClaims{
+		"jti":        uuid.New().String(),
 		"user_id":    user.ID,
+		"session_id": sessionID,
 		"email":      user.Email,
 		"created_at": time.Now().Unix(),
 		"expires_at": expAt.Unix(),
 	})
 
-	tokenStr, err := token.SignedString(config.Data.JWTSecret)
-
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -124,7 +152,7 @@ func CreateJWTPair(user *types.User, refreshToken *types.RefreshToken) (map[stri
 		return nil, nil, err
 	}
 
-	accessTokenStr, accessTokenExpAt, err := CreateJWT(user)
+	accessTokenStr, accessTokenExpAt, err := CreateJWT(user, refreshToken.SessionID)
 
 	if err != nil {
 		return nil, nil, err
@@ -139,6 +167,19 @@ func CreateJWTPair(user *types.User, refreshToken *types.RefreshToken) (map[stri
 		}, nil
 }
 
+// GetClientInfo Extracts user agent and ip address of the client from request
+func GetClientInfo(r *http.Request) types.ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return types.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}
+}
+
 func Map[T any, F any](mapper func(int, T) F, values []T) []F {
 	result := make([]F, len(values))
 
@@ -159,6 +200,24 @@ func Have[T any](haveF func(int, T) bool, data []T) bool {
 	return false
 }
 
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// SetCSRFCookie Sets CSRF token cookie. Unlike token cookies it is readable by scripts, they have to repeat it in CSRFHeaderName header
+func SetCSRFCookie(w http.ResponseWriter, token string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Expires:  expiry,
+		HttpOnly: false,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	})
+}
+
 func SetTokenCookie(w http.ResponseWriter, name, token string, expiry time.Time) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     name,
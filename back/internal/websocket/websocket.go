@@ -3,6 +3,7 @@ package websocket
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/finkabaj/squid/back/internal/middleware"
 
@@ -15,32 +16,45 @@ import (
 type EventType string
 
 const (
-	PingEvent                     EventType = "PING"
-	PongEvent                     EventType = "PONG"
-	UndefinedEvent                EventType = "UNDEFINED"
-	ProjectCreatedEvent           EventType = "PROJECT_CREATED"
-	ProjectUpdatedEvent           EventType = "PROJECT_UPDATED"
-	ProjectDeletedEvent           EventType = "PROJECT_DELETED"
-	KanbanColumnCreatedEvent      EventType = "KANBAN_COLUMN_CREATED"
-	KanbanColumnUpdatedEvent      EventType = "KANBAN_COLUMN_UPDATED"
-	KanbanColumnDeletedEvent      EventType = "KANBAN_COLUMN_DELETED"
-	KanbanColumnLabelCreatedEvent EventType = "KANBAN_COLUMN_LABEL_CREATED"
-	KanbanColumnLabelUpdatedEvent EventType = "KANBAN_COLUMN_LABEL_UPDATED"
-	KanbanColumnLabelDeletedEvent EventType = "KANBAN_COLUMN_LABEL_DELETED"
-	KanbanRowCreatedEvent         EventType = "KANBAN_ROW_CREATED"
-	KanbanRowUpdatedEvent         EventType = "KANBAN_ROW_UPDATED"
-	KanbanRowDeletedEvent         EventType = "KANBAN_ROW_DELETED"
-	KanbanRowLabelCreatedEvent    EventType = "KANBAN_ROW_LABEL_CREATED"
-	KanbanRowLabelUpdatedEvent    EventType = "KANBAN_ROW_LABEL_UPDATED"
-	KanbanRowLabelDeletedEvent    EventType = "KANBAN_ROW_LABEL_DELETED"
-	KanbanChecklistCreatedEvent   EventType = "KANBAN_CHECKLIST_CREATED"
-	KanbanChecklistDeletedEvent   EventType = "KANBAN_CHECKLIST_DELETED"
-	KanbanPointCreatedEvent       EventType = "KANBAN_POINT_CREATED"
-	KanbanPointUpdatedEvent       EventType = "KANBAN_POINT_UPDATED"
-	KanbanPointDeletedEvent       EventType = "KANBAN_POINT_DELETED"
-	KanbanCanCommentEvent         EventType = "KANBAN_CAN_COMMENT"
-	KanbanCommendDeletedEvent     EventType = "KANBAN_COMMENT_DELETED"
-	KanbanCommentCreatedEvent     EventType = "KANBAN_COMMENT_CREATED"
+	PingEvent                      EventType = "PING"
+	PongEvent                      EventType = "PONG"
+	UndefinedEvent                 EventType = "UNDEFINED"
+	ProjectCreatedEvent            EventType = "PROJECT_CREATED"
+	ProjectUpdatedEvent            EventType = "PROJECT_UPDATED"
+	ProjectDeletedEvent            EventType = "PROJECT_DELETED"
+	ProjectArchivedEvent           EventType = "PROJECT_ARCHIVED"
+	ProjectUnarchivedEvent         EventType = "PROJECT_UNARCHIVED"
+	ProjectRestoredEvent           EventType = "PROJECT_RESTORED"
+	ProjectInvitationCreatedEvent  EventType = "PROJECT_INVITATION_CREATED"
+	ProjectInvitationRevokedEvent  EventType = "PROJECT_INVITATION_REVOKED"
+	ProjectInvitationDeclinedEvent EventType = "PROJECT_INVITATION_DECLINED"
+	ProjectTransferCreatedEvent    EventType = "PROJECT_TRANSFER_CREATED"
+	ProjectTransferCancelledEvent  EventType = "PROJECT_TRANSFER_CANCELLED"
+	ProjectTransferDeclinedEvent   EventType = "PROJECT_TRANSFER_DECLINED"
+	ProjectLeftEvent               EventType = "PROJECT_LEFT"
+	KanbanColumnCreatedEvent       EventType = "KANBAN_COLUMN_CREATED"
+	KanbanColumnUpdatedEvent       EventType = "KANBAN_COLUMN_UPDATED"
+	KanbanColumnDeletedEvent       EventType = "KANBAN_COLUMN_DELETED"
+	KanbanColumnRestoredEvent      EventType = "KANBAN_COLUMN_RESTORED"
+	KanbanColumnLabelCreatedEvent  EventType = "KANBAN_COLUMN_LABEL_CREATED"
+	KanbanColumnLabelUpdatedEvent  EventType = "KANBAN_COLUMN_LABEL_UPDATED"
+	KanbanColumnLabelDeletedEvent  EventType = "KANBAN_COLUMN_LABEL_DELETED"
+	KanbanRowCreatedEvent          EventType = "KANBAN_ROW_CREATED"
+	KanbanRowUpdatedEvent          EventType = "KANBAN_ROW_UPDATED"
+	KanbanRowDeletedEvent          EventType = "KANBAN_ROW_DELETED"
+	KanbanRowRestoredEvent         EventType = "KANBAN_ROW_RESTORED"
+	KanbanRowMovedEvent            EventType = "KANBAN_ROW_MOVED"
+	KanbanRowLabelCreatedEvent     EventType = "KANBAN_ROW_LABEL_CREATED"
+	KanbanRowLabelUpdatedEvent     EventType = "KANBAN_ROW_LABEL_UPDATED"
+	KanbanRowLabelDeletedEvent     EventType = "KANBAN_ROW_LABEL_DELETED"
+	KanbanChecklistCreatedEvent    EventType = "KANBAN_CHECKLIST_CREATED"
+	KanbanChecklistDeletedEvent    EventType = "KANBAN_CHECKLIST_DELETED"
+	KanbanPointCreatedEvent        EventType = "KANBAN_POINT_CREATED"
+	KanbanPointUpdatedEvent        EventType = "KANBAN_POINT_UPDATED"
+	KanbanPointDeletedEvent        EventType = "KANBAN_POINT_DELETED"
+	KanbanCanCommentEvent          EventType = "KANBAN_CAN_COMMENT"
+	KanbanCommendDeletedEvent      EventType = "KANBAN_COMMENT_DELETED"
+	KanbanCommentCreatedEvent      EventType = "KANBAN_COMMENT_CREATED"
 )
 
 type Event struct {
@@ -52,13 +66,16 @@ type Event struct {
 type Server struct {
 	sync.RWMutex
 	// userID to ws conn
-	Conns    map[string][]*websocket.Conn
-	upgrader websocket.Upgrader
+	Conns map[string][]*websocket.Conn
+	// ws conn to sessionID it was opened with
+	connSessions map[*websocket.Conn]string
+	upgrader     websocket.Upgrader
 }
 
 func NewServer() *Server {
 	return &Server{
-		Conns: make(map[string][]*websocket.Conn),
+		Conns:        make(map[string][]*websocket.Conn),
+		connSessions: make(map[*websocket.Conn]string),
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -85,6 +102,7 @@ func (s *Server) HandleWs(w http.ResponseWriter, r *http.Request) {
 		s.Conns[user.ID] = make([]*websocket.Conn, 0)
 	}
 	s.Conns[user.ID] = append(s.Conns[user.ID], ws)
+	s.connSessions[ws] = middleware.SessionIDFromContext(r.Context())
 	s.Unlock()
 
 	s.readLoop(ws, user.ID)
@@ -155,9 +173,46 @@ func (s *Server) removeConnection(ws *websocket.Conn, userID string) {
 		delete(s.Conns, userID)
 	}
 
+	delete(s.connSessions, ws)
+
 	ws.Close()
 }
 
+// CloseSessions closes every connection of the user that was opened with one of sessionIDs
+func (s *Server) CloseSessions(userID string, sessionIDs ...string) {
+	s.RLock()
+	var toClose []*websocket.Conn
+	for _, conn := range s.Conns[userID] {
+		if slices.Contains(sessionIDs, s.connSessions[conn]) {
+			toClose = append(toClose, conn)
+		}
+	}
+	s.RUnlock()
+
+	for _, conn := range toClose {
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked")
+		if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+			logger.Logger.Debug().Err(err).Msgf("error sending close message to user %s", userID)
+		}
+		s.removeConnection(conn, userID)
+	}
+}
+
+// CloseUser closes every connection of the user
+func (s *Server) CloseUser(userID string) {
+	s.RLock()
+	toClose := slices.Clone(s.Conns[userID])
+	s.RUnlock()
+
+	for _, conn := range toClose {
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "account deleted")
+		if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+			logger.Logger.Debug().Err(err).Msgf("error sending close message to user %s", userID)
+		}
+		s.removeConnection(conn, userID)
+	}
+}
+
 func (s *Server) BroadcastToUser(userID string, eventType EventType, msg string, payload any) {
 	evt := Event{
 		Type:    eventType,
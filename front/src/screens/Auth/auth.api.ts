@@ -4,36 +4,41 @@ import { ILoginValues, IRefreshResponse, IRegisterValues } from './auth.types.ts
 import { handleHttpError, handleHttpResponse } from '../../services/http'
 import { IUser } from '../Profile/profile.types.ts'
 import { initialProfileState } from '../Profile/profile.atom.ts'
+import { applyCSRF, csrfDefaults } from '../../services/http/csrf.ts'
+
+// requests here skip interceptors of the shared instance, which refresh the session before every request
+const authHttp = applyCSRF(axios.create({
+  baseURL: config.API_URL,
+  withCredentials: true,
+  ...csrfDefaults,
+}))
 
 const login = (data: ILoginValues) => {
-  return axios
-    .post(config.API_URL + '/auth/login', data, { withCredentials: true })
+  return authHttp
+    .post('/auth/login', data)
     .then(handleHttpResponse)
     .catch(handleHttpError)
 }
 
 const register = (data: IRegisterValues) => {
-  return axios
-    .post(config.API_URL + '/auth/register', data, { withCredentials: true })
+  return authHttp
+    .post('/auth/register', data)
     .then(handleHttpResponse)
     .catch(handleHttpError)
 }
 
 const logout = () => {
-  return axios
-    .post(config.API_URL + '/auth/logout', {}, { withCredentials: true })
+  return authHttp
+    .post('/auth/logout', {})
     .then(handleHttpResponse)
     .catch(handleHttpError)
 }
 
 const refresh = (): Promise<IRefreshResponse> => {
-  return axios
+  return authHttp
     .post<IUser>(
-      config.API_URL + '/auth/refresh',
-      {},
-      {
-        withCredentials: true,
-      }
+      '/auth/refresh',
+      {}
     )
     .then((r) => ({
       status: 'success',
@@ -0,0 +1,38 @@
+import { AxiosInstance, AxiosResponse, CreateAxiosDefaults, InternalAxiosRequestConfig } from 'axios'
+
+const CSRF_COOKIE_NAME = 'csrf_token'
+const CSRF_HEADER_NAME = 'X-CSRF-Token'
+
+// axios repeats the csrf cookie in the header when scripts can read it
+export const csrfDefaults: CreateAxiosDefaults = {
+  xsrfCookieName: CSRF_COOKIE_NAME,
+  xsrfHeaderName: CSRF_HEADER_NAME,
+  withXSRFToken: true,
+}
+
+// the API sends the token in a header as well, for when the API is on a domain scripts cannot read cookies of
+let csrfToken = ''
+
+const rememberCSRFToken = (response: AxiosResponse) => {
+  const token = response.headers[CSRF_HEADER_NAME.toLowerCase()]
+  if (typeof token === 'string' && token !== '') {
+    csrfToken = token
+  }
+
+  return response
+}
+
+const sendCSRFToken = (config: InternalAxiosRequestConfig) => {
+  if (csrfToken !== '' && !config.headers.has(CSRF_HEADER_NAME)) {
+    config.headers.set(CSRF_HEADER_NAME, csrfToken)
+  }
+
+  return config
+}
+
+export const applyCSRF = (instance: AxiosInstance) => {
+  instance.interceptors.request.use(sendCSRFToken)
+  instance.interceptors.response.use(rememberCSRFToken)
+
+  return instance
+}
@@ -6,12 +6,14 @@ import { Dispatch, SetStateAction, MutableRefObject } from 'react'
 import { IHTTPErrorResponse, IHTTPSuccessResponse } from './http.types.ts'
 import authApi from '../../screens/Auth/auth.api.ts'
 import { initialProfileState } from '../../screens/Profile/profile.atom.ts'
+import { applyCSRF, csrfDefaults } from './csrf.ts'
 
 
-const http = axios.create({
+const http = applyCSRF(axios.create({
   baseURL: config.API_URL,
   withCredentials: true,
-})
+  ...csrfDefaults,
+}))
 
 let interceptorsApplied: boolean = false
 